@@ -0,0 +1,126 @@
+package config
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxHostnameLen = 30
+	maxAliasLen    = 64
+	aliasSuffix    = "-go" // Distinguishes localsend-go from other LocalSend implementations
+)
+
+// HostnameAlias derives a device alias from the system hostname, falling back
+// to a random name when no usable hostname is available
+func HostnameAlias() string {
+	host := hostname()
+	if host == "" {
+		return generateRandomName()
+	}
+	return host + aliasSuffix
+}
+
+// hostname returns the printable part of the system hostname, cut to 30 characters
+func hostname() string {
+	host, err := os.Hostname()
+	if runtime.GOOS == "windows" && os.Getenv("COMPUTERNAME") != "" {
+		host, err = os.Getenv("COMPUTERNAME"), nil
+	}
+	if err != nil {
+		return ""
+	}
+
+	host = strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(host))
+	if r := []rune(host); len(r) > maxHostnameLen {
+		host = string(r[:maxHostnameLen])
+	}
+	return host
+}
+
+// aliasVariable matches the {name} variables of an alias format
+var aliasVariable = regexp.MustCompile(`\{[^{}]*\}`)
+
+// random4 is the {random4} alias variable, the same for the whole run
+var random4 = sync.OnceValue(func() string {
+	b := make([]byte, 2)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "0000"
+	}
+	return hex.EncodeToString(b)
+})
+
+// FormatAlias renders an alias format such as "{hostname}-{os}". The variables are
+// {hostname}, {os}, {arch}, {username} and {random4}, 4 hex characters chosen per run.
+func FormatAlias(format string) (string, error) {
+	var err error
+	alias := aliasVariable.ReplaceAllStringFunc(format, func(v string) string {
+		switch v {
+		case "{hostname}":
+			return hostname()
+		case "{os}":
+			return runtime.GOOS
+		case "{arch}":
+			return runtime.GOARCH
+		case "{username}":
+			return username()
+		case "{random4}":
+			return random4()
+		}
+		if err == nil {
+			err = fmt.Errorf("unknown variable %s", v)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateAlias(alias); err != nil {
+		return "", err
+	}
+	return alias, nil
+}
+
+// username returns the login name of the current user, without a Windows domain
+func username() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	name := u.Username
+	if i := strings.LastIndex(name, "\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// ValidateAlias checks that an alias has 1-64 printable characters
+func ValidateAlias(alias string) error {
+	n := utf8.RuneCountInString(alias)
+	if n == 0 || n > maxAliasLen {
+		return fmt.Errorf("alias must be 1-%d characters, got %d", maxAliasLen, n)
+	}
+	if !utf8.ValidString(alias) {
+		return fmt.Errorf("alias is not valid UTF-8")
+	}
+	for _, r := range alias {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("alias contains non-printable character %q", r)
+		}
+	}
+	return nil
+}
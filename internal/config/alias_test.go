@@ -0,0 +1,27 @@
+package config
+
+import (
+	"regexp"
+	"runtime"
+	"testing"
+)
+
+func TestFormatAlias(t *testing.T) {
+	alias, err := FormatAlias("{os}/{arch}-{random4}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile("^" + runtime.GOOS + "/" + runtime.GOARCH + "-[0-9a-f]{4}$").MatchString(alias) {
+		t.Errorf("got %q", alias)
+	}
+	// {random4} is the same for the whole run
+	if again, _ := FormatAlias("{os}/{arch}-{random4}"); again != alias {
+		t.Errorf("got %q, then %q", alias, again)
+	}
+
+	for _, format := range []string{"{nope}", "", "{os}\t", "{os}-" + string(make([]byte, 64))} {
+		if alias, err := FormatAlias(format); err == nil {
+			t.Errorf("FormatAlias(%q) = %q, want an error", format, alias)
+		}
+	}
+}
@@ -8,20 +8,106 @@ import (
 	"time"
 
 	"github.com/meowrain/localsend-go/internal/utils/logger"
-	"gopkg.in/yaml.v2"
 )
 
-//go:embed config.yaml
+//go:embed config.yaml config.toml
 var embeddedConfig embed.FS
 
 type Config struct {
-	NameOfDevice string
-	Functions    struct {
+	NameOfDevice  string
+	Alias         string `yaml:"alias"`        // Overrides the generated device name
+	AliasFormat   string `yaml:"alias_format"` // Template for the generated name, e.g. "{hostname}-{os}"
+	DeviceType    string `yaml:"device_type"`  // Advertised device type, detected when empty
+	DeviceModel   string `yaml:"device_model"` // Advertised device model, the OS when empty
+	Port          int    `yaml:"port"`
+	AutoPort      bool   `yaml:"auto_port"`
+	Transport     string `yaml:"transport"` // tcp or quic (experimental)
+	QUICPort      int    `yaml:"quic_port"` // UDP port of the HTTP/3 server, port+1 when 0
+	UPnP          bool   `yaml:"upnp"`      // Map the port on the router with UPnP IGD
+	Proxy         string `yaml:"proxy"`     // HTTP proxy for file transfers, overrides HTTP(S)_PROXY
+	Relay         string `yaml:"relay"`     // Relay server for peers behind firewalls, e.g. wss://relay.example.com
+	Encrypt       string `yaml:"encrypt"`   // Passphrase to encrypt uploads with, end to end
+	Decrypt       string `yaml:"decrypt"`   // Passphrase to decrypt received encrypted files
+	PIN           string `yaml:"pin"`       // PIN senders must give to send to this device
+	MaxSessions   int    `yaml:"max_sessions"`
+	DiscoveryMode string `yaml:"discovery"`
+	// Announcements back off from 1s up to DiscoveryInterval, plus up to DiscoveryJitter
+	DiscoveryInterval time.Duration `yaml:"discovery_interval"`
+	DiscoveryJitter   time.Duration `yaml:"discovery_jitter"`
+	DiscoverUPnP      bool          `yaml:"discover_upnp"` // Also search for devices with UPnP SSDP
+	LocalOnly         bool          `yaml:"local_only"`    // Only accept connections from this machine, no discovery
+	ReportFormat      string        `yaml:"report_format"`
+	ReportFile        string        `yaml:"report_file"`
+	ExcludeHashes     string        `yaml:"exclude_hashes"`  // File of SHA256 hashes to skip when sending
+	VerifyManifest    string        `yaml:"verify_manifest"` // sha256sum file checked against each received session
+	ReceiveDir        string        `yaml:"receive_dir"`
+	WebUploadDir      string        `yaml:"web_upload_dir"` // Served by the web mode and receiving its uploads, receive_dir when empty
+	AutoAccept        bool          `yaml:"auto_accept"`
+	ConflictPolicy    string        `yaml:"conflict_policy"`     // Sync conflicts, or prompt for received files that exist
+	OrganizeBy        string        `yaml:"organize_by"`         // Receive into subdirectories by sender, date or type
+	ReceiveMode       string        `yaml:"receive_mode"`        // "append" continues existing files instead of replacing them
+	AllowSync         bool          `yaml:"allow_sync"`          // Let peers list and pull the receive directory with sync
+	FuseMount         string        `yaml:"fuse_mount"`          // Expose received files in a FUSE filesystem (Linux, -tags fuse)
+	Quiet             bool          `yaml:"quiet"`               // Only print errors
+	JSON              bool          `yaml:"json"`                // Emit machine-readable events on stdout
+	NoProgress        bool          `yaml:"no_progress"`         // Log transfers as text instead of drawing progress bars
+	Zip               bool          `yaml:"zip"`                 // Send directories as a single ZIP archive
+	PreserveEmptyDirs bool          `yaml:"preserve_empty_dirs"` // Send empty directories as directory entries
+	FollowSymlinks    bool          `yaml:"follow_symlinks"`     // Send the targets of symlinks, skipped by default
+	Compress          bool          `yaml:"compress"`            // Compress uploads (zstd or gzip) if the receiver supports it
+	LogLevel          string        `yaml:"log_level"`           // debug, info, warn or error
+	Unzip             bool          `yaml:"unzip"`               // Extract received ZIP archives
+	StrictClipboard   bool          `yaml:"strict_clipboard"`    // Fail the prepare request when received text can't be copied
+	AutoOpen          bool          `yaml:"auto_open"`           // Open received files with the default application
+	AutoOpenTypes     []string      `yaml:"auto_open_types"`     // MIME patterns for auto_open, all when empty
+	NoHistory         bool          `yaml:"no_history"`          // Don't record transfers in the history file
+	WebhookURLs       []string      `yaml:"webhook_urls"`        // POSTed after each received file
+	// Apply the permission bits sent with each file instead of the umask default. Off by
+	// default: a sender could make received files executable or readable by everyone.
+	PreservePermissions bool `yaml:"preserve_permissions"`
+	// HTTP server timeouts, 0 disables one. Uploads and downloads extend them while data
+	// moves, so only stalled connections time out.
+	ServerReadTimeout  time.Duration `yaml:"server_read_timeout"`
+	ServerWriteTimeout time.Duration `yaml:"server_write_timeout"`
+	ServerIdleTimeout  time.Duration `yaml:"server_idle_timeout"`
+	// When max_sessions are active, new sessions wait up to QueueTimeout for a slot
+	// in a queue of QueueSize, or are rejected right away with queue_mode "reject"
+	QueueMode    string        `yaml:"queue_mode"`
+	QueueSize    int           `yaml:"queue_size"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	// Retries when the receiver answers 409 (busy with another session)
+	SessionRetryDelay time.Duration `yaml:"session_retry_delay"`
+	SessionRetryCount int           `yaml:"session_retry_count"`
+	AutoTune          bool          `yaml:"auto_tune"`         // Measure bandwidth before large sends
+	ProgressInterval  time.Duration `yaml:"progress_interval"` // Progress log interval, 0 = off (10s with --json)
+	// Prepared sessions expire after this long without uploads or pings
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout"`
+	// Send target selection and scheduling
+	SendTo        string        `yaml:"-"` // Alias or IP of the receiver, skips the device picker
+	SendPIN       string        `yaml:"-"` // PIN for receivers that require one, asked for when empty
+	SendAt        string        `yaml:"-"`
+	SendIn        string        `yaml:"-"`
+	RetryDuration time.Duration `yaml:"retry_duration"` // How long to wait for the --to device
+	RetryExpiry   time.Duration `yaml:"retry_expiry"`   // How long failed uploads stay in the retry queue
+	SendFilters   []PathFilter  `yaml:"-"`              // --exclude and --include, in order
+	// How long a send waits for a receiver that timed out to be discovered again
+	ReconnectTimeout time.Duration `yaml:"reconnect_timeout"`
+	// Auto-accept only these senders, all when empty
+	AllowFrom []AllowedSender `yaml:"allow_from"`
+	// Per-device overrides, matched by fingerprint
+	Devices   []DeviceProfile `yaml:"devices"`
+	Functions struct {
 		HttpFileServer  bool `yaml:"http_file_server"`
 		LocalSendServer bool `yaml:"local_send_server"`
 	} `yaml:"functions"`
 }
 
+// PathFilter is an --include or --exclude glob. Filters apply in order, the last match wins.
+type PathFilter struct {
+	Pattern string
+	Include bool
+}
+
 // random device name
 var (
 	adjectives = []string{
@@ -44,19 +130,82 @@ func generateRandomName() string {
 	return fmt.Sprintf("%s %s", adj, noun)
 }
 
-func init() {
-	bytes, err := os.ReadFile("internal/config/config.yaml")
-	if err != nil {
+// DefaultPort is the LocalSend port, used unless another one is configured and for
+// peers that don't announce theirs
+const DefaultPort = 53317
+
+// fileData is the configuration as last read from the file, before command line flags
+var fileData Config
+
+// defaults returns the configuration used for settings missing from the file
+func defaults() Config {
+	var c Config
+	c.Port = DefaultPort
+	c.Transport = "tcp"
+	c.MaxSessions = 3
+	c.QueueMode = "wait"
+	c.QueueSize = 8
+	c.QueueTimeout = 30 * time.Second
+	c.ServerReadTimeout = time.Minute
+	c.ServerWriteTimeout = time.Minute
+	c.ServerIdleTimeout = 2 * time.Minute
+	c.SessionIdleTimeout = 5 * time.Minute
+	c.DiscoveryMode = "multicast"
+	c.DiscoveryInterval = 30 * time.Second
+	c.DiscoveryJitter = time.Second
+	c.ReceiveDir = "uploads"
+	c.AutoAccept = true
+	c.ConflictPolicy = "newer-wins"
+	c.SessionRetryDelay = 5 * time.Second
+	c.SessionRetryCount = 6
+	c.RetryDuration = 30 * time.Minute
+	c.ReconnectTimeout = 30 * time.Second
+	c.RetryExpiry = 24 * time.Hour
+	return c
+}
+
+// load reads the first config file found, falling back to the embedded config
+func load() (Config, error) {
+	c := defaults()
+	var path string
+	var bytes []byte
+	for _, candidate := range configFiles() {
+		if data, err := os.ReadFile(candidate); err == nil {
+			path, bytes = candidate, data
+			break
+		}
+	}
+	if path == "" {
 		logger.Debug("读取外部配置文件失败，使用内置配置")
-		bytes, err = embeddedConfig.ReadFile("config.yaml")
+		path = "config.yaml"
+		var err error
+		bytes, err = embeddedConfig.ReadFile(path)
 		if err != nil {
-			logger.Failedf("无法读取嵌入式配置文件: %v", err)
+			return c, fmt.Errorf("无法读取嵌入式配置文件: %w", err)
 		}
 	}
+	if err := unmarshal(path, bytes, &c); err != nil {
+		return c, fmt.Errorf("解析配置文件出错: %s: %w", path, err)
+	}
+	c.ReceiveDir = ExpandHome(c.ReceiveDir)
+	c.WebUploadDir = ExpandHome(c.WebUploadDir)
+	c.NameOfDevice = HostnameAlias()
+	return c, nil
+}
 
-	if err := yaml.Unmarshal(bytes, &ConfigData); err != nil {
-		logger.Failedf("解析配置文件出错: %v", err)
+// WebDir is the directory the web mode serves and stores browser uploads in:
+// web_upload_dir, or receive_dir when it is not set
+func (c *Config) WebDir() string {
+	if c.WebUploadDir != "" {
+		return c.WebUploadDir
 	}
+	return c.ReceiveDir
+}
 
-	ConfigData.NameOfDevice = generateRandomName()
+func init() {
+	var err error
+	if ConfigData, err = load(); err != nil {
+		logger.Failedf("%v", err)
+	}
+	fileData = ConfigData
 }
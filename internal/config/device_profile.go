@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DeviceProfile overrides receive settings for one sender, matched by fingerprint
+type DeviceProfile struct {
+	Fingerprint  string   `yaml:"fingerprint"`
+	AutoAccept   *bool    `yaml:"auto_accept"`
+	ReceiveDir   string   `yaml:"receive_dir"`
+	MaxFileSize  int64    `yaml:"max_file_size"`
+	AllowedTypes []string `yaml:"allowed_types"`
+}
+
+// ReceivePolicy is the effective set of receive settings for a session
+type ReceivePolicy struct {
+	AutoAccept   bool
+	ReceiveDir   string
+	MaxFileSize  int64 // Zero means unlimited
+	AllowedTypes []string
+}
+
+// ReceivePolicyFor resolves the receive settings for a sender. Profiles are
+// matched on the exact fingerprint only, since aliases can be spoofed.
+// Unknown senders get the global defaults.
+func (c *Config) ReceivePolicyFor(fingerprint string) ReceivePolicy {
+	policy := ReceivePolicy{
+		AutoAccept: c.AutoAccept,
+		ReceiveDir: c.ReceiveDir,
+	}
+	if fingerprint == "" {
+		return policy
+	}
+	for _, profile := range c.Devices {
+		if profile.Fingerprint != fingerprint {
+			continue
+		}
+		if profile.AutoAccept != nil {
+			policy.AutoAccept = *profile.AutoAccept
+		}
+		if profile.ReceiveDir != "" {
+			policy.ReceiveDir = ExpandHome(profile.ReceiveDir)
+		}
+		policy.MaxFileSize = profile.MaxFileSize
+		policy.AllowedTypes = profile.AllowedTypes
+		break
+	}
+	return policy
+}
+
+// AllowedSender is an auto-accept filter entry. When both fields are set, both must match.
+type AllowedSender struct {
+	Fingerprint string `yaml:"fingerprint"`
+	Alias       string `yaml:"alias"` // Easy to spoof, prefer the fingerprint
+}
+
+// AllowsSender reports whether auto-accept applies to a sender. Without allow_from
+// entries every sender is allowed.
+func (c *Config) AllowsSender(fingerprint, alias string) bool {
+	if len(c.AllowFrom) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowFrom {
+		if allowed.Fingerprint == "" && allowed.Alias == "" {
+			continue
+		}
+		if (allowed.Fingerprint == "" || allowed.Fingerprint == fingerprint) &&
+			(allowed.Alias == "" || allowed.Alias == alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether a file of the given name, type and size may be received
+func (p ReceivePolicy) Allows(fileName, fileType string, size int64) bool {
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return false
+	}
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, allowed := range p.AllowedTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == ext || allowed == strings.ToLower(fileType) {
+			return true
+		}
+		// MIME patterns such as "image/*"
+		if ok, _ := path.Match(allowed, strings.ToLower(fileType)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandHome replaces a leading "~" with the user's home directory
+func ExpandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
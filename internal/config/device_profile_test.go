@@ -0,0 +1,75 @@
+package config
+
+import "testing"
+
+func TestReceivePolicyFor(t *testing.T) {
+	deny := false
+	cfg := Config{
+		ReceiveDir: "uploads",
+		AutoAccept: true,
+		Devices: []DeviceProfile{
+			{Fingerprint: "alice", ReceiveDir: "from-alice", MaxFileSize: 10, AllowedTypes: []string{"image/*", ".pdf"}},
+			{Fingerprint: "mallory", AutoAccept: &deny},
+		},
+	}
+
+	unknown := cfg.ReceivePolicyFor("bob")
+	if !unknown.AutoAccept || unknown.ReceiveDir != "uploads" {
+		t.Fatalf("unknown device should use global defaults, got %+v", unknown)
+	}
+	if !unknown.Allows("big.iso", "application/octet-stream", 1<<30) {
+		t.Fatal("global defaults should not restrict files")
+	}
+
+	if cfg.ReceivePolicyFor("mallory").AutoAccept {
+		t.Fatal("profile auto_accept=false should disable auto-accept")
+	}
+
+	alice := cfg.ReceivePolicyFor("alice")
+	if alice.ReceiveDir != "from-alice" {
+		t.Fatalf("expected profile receive dir, got %q", alice.ReceiveDir)
+	}
+	cases := []struct {
+		name, fileType string
+		size           int64
+		want           bool
+	}{
+		{"photo.jpg", "image/jpeg", 5, true},
+		{"doc.pdf", ".pdf", 5, true},
+		{"notes.txt", "text/plain", 5, false},
+		{"photo.jpg", "image/jpeg", 11, false},
+	}
+	for _, c := range cases {
+		if got := alice.Allows(c.name, c.fileType, c.size); got != c.want {
+			t.Errorf("Allows(%q, %q, %d) = %v, want %v", c.name, c.fileType, c.size, got, c.want)
+		}
+	}
+}
+
+func TestAllowsSender(t *testing.T) {
+	if !(&Config{}).AllowsSender("any", "Any") {
+		t.Fatal("an empty allow list should allow every sender")
+	}
+
+	cfg := Config{AllowFrom: []AllowedSender{
+		{Fingerprint: "alice"},
+		{Fingerprint: "bob", Alias: "Bob"},
+		{Alias: "Carol"},
+	}}
+	cases := []struct {
+		fingerprint, alias string
+		want               bool
+	}{
+		{"alice", "Anything", true},
+		{"bob", "Bob", true},
+		{"bob", "Mallory", false},
+		{"mallory", "Bob", false},
+		{"", "Carol", true},
+		{"mallory", "Mallory", false},
+	}
+	for _, c := range cases {
+		if got := cfg.AllowsSender(c.fingerprint, c.alias); got != c.want {
+			t.Errorf("AllowsSender(%q, %q) = %v, want %v", c.fingerprint, c.alias, got, c.want)
+		}
+	}
+}
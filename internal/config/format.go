@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// Config file formats, also the file extensions
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+)
+
+// configFiles are the config files tried in order: TOML, then YAML in the config
+// directory, then the YAML file of earlier versions in the working directory
+func configFiles() []string {
+	return []string{
+		filepath.Join(ConfigDir(), "config."+FormatTOML),
+		filepath.Join(ConfigDir(), "config."+FormatYAML),
+		filepath.Join("internal", "config", "config.yaml"),
+	}
+}
+
+// File returns the config file in use, or "" when the built-in config is used
+func File() string {
+	for _, candidate := range configFiles() {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// unmarshal parses a config file into c, by the format of its extension
+func unmarshal(path string, data []byte, c *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		// TOML uses the YAML keys: the document is converted rather than tagging
+		// every field twice
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		converted, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return yaml.Unmarshal(converted, c)
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, c)
+	}
+	return fmt.Errorf("unknown config format %q", filepath.Ext(path))
+}
+
+// DefaultConfig returns the commented default config file in format
+func DefaultConfig(format string) ([]byte, error) {
+	switch format {
+	case FormatTOML, FormatYAML:
+		return embeddedConfig.ReadFile("config." + format)
+	}
+	return nil, fmt.Errorf("unknown config format %q (toml|yaml)", format)
+}
+
+// Init writes the default config file in format to the config directory and returns
+// its path. An existing file is never overwritten.
+func Init(format string) (string, error) {
+	data, err := DefaultConfig(format)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(ConfigDir(), 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(ConfigDir(), "config."+format)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
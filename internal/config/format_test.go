@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalTOMLMatchesYAML(t *testing.T) {
+	const tomlConfig = `
+alias = "laptop"
+port = 53318
+auto_accept = false
+queue_timeout = "45s"
+webhook_urls = ["http://localhost:8080/hook"]
+
+[functions]
+http_file_server = false
+local_send_server = true
+
+[[devices]]
+fingerprint = "abc123"
+auto_accept = true
+max_file_size = 1024
+allowed_types = ["image/*"]
+`
+	const yamlConfig = `
+alias: laptop
+port: 53318
+auto_accept: false
+queue_timeout: 45s
+webhook_urls: ["http://localhost:8080/hook"]
+functions:
+  http_file_server: false
+  local_send_server: true
+devices:
+  - fingerprint: abc123
+    auto_accept: true
+    max_file_size: 1024
+    allowed_types: ["image/*"]
+`
+	fromTOML, fromYAML := defaults(), defaults()
+	if err := unmarshal("config.toml", []byte(tomlConfig), &fromTOML); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmarshal("config.yaml", []byte(yamlConfig), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromTOML, fromYAML) {
+		t.Errorf("TOML and YAML differ:\n%+v\n%+v", fromTOML, fromYAML)
+	}
+	if fromTOML.QueueTimeout != 45*time.Second || fromTOML.Functions.HttpFileServer || len(fromTOML.Devices) != 1 {
+		t.Errorf("unexpected config %+v", fromTOML)
+	}
+}
+
+func TestUnmarshalUnknownFormat(t *testing.T) {
+	c := defaults()
+	if err := unmarshal("config.ini", []byte("port=1"), &c); err == nil {
+		t.Error("config.ini parsed")
+	}
+}
+
+func TestDefaultConfigs(t *testing.T) {
+	for _, format := range []string{FormatTOML, FormatYAML} {
+		data, err := DefaultConfig(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := defaults()
+		if err := unmarshal("config."+format, data, &c); err != nil {
+			t.Fatalf("default %s config: %v", format, err)
+		}
+		if !c.Functions.LocalSendServer || !c.Functions.HttpFileServer {
+			t.Errorf("default %s config disables functions: %+v", format, c.Functions)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path, err := Init(FormatTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("port = 1\n"), 0o644)
+	if _, err := Init(FormatTOML); err == nil {
+		t.Error("existing config overwritten")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "port = 1\n" {
+		t.Errorf("config changed to %q", data)
+	}
+	if _, err := Init("ini"); err == nil {
+		t.Error("unknown format written")
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import "path/filepath"
+
+// ConfigDir is the per-user directory for localsend-go state, ~/.config/localsend-go
+func ConfigDir() string {
+	return ExpandHome(filepath.Join("~", ".config", "localsend-go"))
+}
+
+// RetryQueueFile holds the uploads that failed, see the retry-queue command
+func RetryQueueFile() string {
+	return filepath.Join(ConfigDir(), "retry_queue.json")
+}
+
+// HistoryFile is the transfer history log, see the history command
+func HistoryFile() string {
+	return filepath.Join(ConfigDir(), "history.jsonl")
+}
+
+// PartialsFile indexes the partial files of interrupted uploads that can be resumed
+func PartialsFile() string {
+	return filepath.Join(ConfigDir(), "partials.json")
+}
+
+// KnownDevicesFile remembers the certificate fingerprints of devices connected to
+func KnownDevicesFile() string {
+	return filepath.Join(ConfigDir(), "known_devices.json")
+}
+
+// CertificateFile holds the certificate and key of this device, see certificate.LoadOrCreate
+func CertificateFile() string {
+	return filepath.Join(ConfigDir(), "certificate.pem")
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+)
+
+// ReloadResult lists the settings, by yaml key, that changed in the config file
+type ReloadResult struct {
+	Applied         []string // Applied to the running process
+	RestartRequired []string // Only take effect after a restart
+}
+
+// Reload re-reads the config file and applies the settings that changed in it since
+// it was last read. Settings that were only given on the command line are kept.
+func Reload() (ReloadResult, error) {
+	var result ReloadResult
+	next, err := load()
+	if err != nil {
+		return result, err
+	}
+	old := fileData
+	fileData = next
+
+	applied := func(key string) { result.Applied = append(result.Applied, key) }
+	if next.Alias != old.Alias {
+		ConfigData.Alias = next.Alias
+		applied("alias")
+	}
+	if next.ReceiveDir != old.ReceiveDir {
+		ConfigData.ReceiveDir = next.ReceiveDir
+		applied("receive_dir")
+	}
+	if next.AutoAccept != old.AutoAccept {
+		ConfigData.AutoAccept = next.AutoAccept
+		applied("auto_accept")
+	}
+	if next.LogLevel != old.LogLevel {
+		ConfigData.LogLevel = next.LogLevel
+		applied("log_level")
+	}
+	if !slices.Equal(next.WebhookURLs, old.WebhookURLs) {
+		ConfigData.WebhookURLs = next.WebhookURLs
+		applied("webhook_urls")
+	}
+	if next.MaxSessions != old.MaxSessions {
+		ConfigData.MaxSessions = next.MaxSessions
+		applied("max_sessions")
+	}
+	if !slices.Equal(next.AllowFrom, old.AllowFrom) {
+		// Keeps the --allow-fingerprint/--allow-alias entry, it was appended last
+		ConfigData.AllowFrom = append(next.AllowFrom, ConfigData.AllowFrom[len(old.AllowFrom):]...)
+		applied("allow_from")
+	}
+	if !reflect.DeepEqual(next.Devices, old.Devices) {
+		ConfigData.Devices = next.Devices
+		applied("devices")
+	}
+
+	restart := func(key string) { result.RestartRequired = append(result.RestartRequired, key) }
+	if next.Port != old.Port {
+		restart("port")
+	}
+	if next.AutoPort != old.AutoPort {
+		restart("auto_port")
+	}
+	if next.UPnP != old.UPnP {
+		restart("upnp")
+	}
+	if next.Transport != old.Transport {
+		restart("transport")
+	}
+	if next.DiscoveryMode != old.DiscoveryMode {
+		restart("discovery")
+	}
+	if next.FuseMount != old.FuseMount {
+		restart("fuse_mount")
+	}
+	if next.Functions != old.Functions {
+		restart("functions")
+	}
+	return result, nil
+}
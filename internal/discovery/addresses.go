@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"net"
+	"sort"
+)
+
+// LocalAddresses returns the addresses of the up, non-loopback interfaces, advertised
+// in the discovery message so peers can pick the one they reach best. IPv6 link-local
+// addresses are left out, they are useless without a zone.
+func LocalAddresses() []string {
+	var addresses []string
+	for _, ipNet := range localNets() {
+		if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		addresses = append(addresses, ipNet.IP.String())
+	}
+	return addresses
+}
+
+// localNets returns the networks of the up, non-loopback interfaces
+func localNets() []*net.IPNet {
+	var nets []*net.IPNet
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				nets = append(nets, ipNet)
+			}
+		}
+	}
+	return nets
+}
+
+// PreferredAddresses orders the addresses of a peer for connecting: addresses on a
+// subnet of a local interface first (link-local before others), then private RFC 1918
+// addresses, then the rest. Duplicates and unparsable addresses are dropped.
+func PreferredAddresses(addresses []string) []string {
+	return sortAddresses(addresses, localNets())
+}
+
+func sortAddresses(addresses []string, local []*net.IPNet) []string {
+	rank := func(ip net.IP) int {
+		onLink := false
+		for _, ipNet := range local {
+			if ipNet.Contains(ip) {
+				onLink = true
+				break
+			}
+		}
+		switch {
+		case onLink && ip.IsLinkLocalUnicast():
+			return 0
+		case onLink:
+			return 1
+		case ip.IsLinkLocalUnicast():
+			return 4 // Unreachable from another link
+		case ip.IsPrivate():
+			return 2
+		default:
+			return 3
+		}
+	}
+
+	type candidate struct {
+		address string
+		rank    int
+	}
+	var candidates []candidate
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		candidates = append(candidates, candidate{ip.String(), rank(ip)})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].rank < candidates[j].rank })
+
+	sorted := make([]string, len(candidates))
+	for i, c := range candidates {
+		sorted[i] = c.address
+	}
+	return sorted
+}
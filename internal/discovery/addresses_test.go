@@ -0,0 +1,26 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSortAddresses(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.10.0/24")
+	_, linkLocal, _ := net.ParseCIDR("169.254.0.0/16")
+	local := []*net.IPNet{lan, linkLocal}
+
+	got := sortAddresses([]string{"10.8.0.5", "203.0.113.7", "192.168.1.10", "192.168.10.20", "169.254.3.4", "10.8.0.5", "bogus"}, local)
+	want := []string{"169.254.3.4", "192.168.10.20", "10.8.0.5", "192.168.1.10", "203.0.113.7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Link-local addresses of another link go last
+	got = sortAddresses([]string{"169.254.3.4", "203.0.113.7"}, []*net.IPNet{lan})
+	want = []string{"203.0.113.7", "169.254.3.4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
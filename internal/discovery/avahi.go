@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery/avahi"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// DiscoveryAvahi finds and announces devices with DNS-SD through the Avahi daemon
+const DiscoveryAvahi = "avahi"
+
+// avahiRefresh is how often devices Avahi still sees are marked as seen. Avahi only
+// reports appearing and disappearing services, not the periodic announcements that
+// keep other devices from expiring after deviceTTL.
+const avahiRefresh = deviceTTL / 4
+
+// startAvahi publishes this device with Avahi and browses for others in the
+// background. It fails when the daemon can't be reached.
+func startAvahi(updates chan<- []models.SendModel) error {
+	client, err := avahi.Connect()
+	if err != nil {
+		return err
+	}
+	if err := client.Publish(shared.Message.Alias, shared.Message.Port, avahiTXT(shared.Message)); err != nil {
+		client.Close()
+		return err
+	}
+	logger.Infof("Published %s as %s with Avahi", shared.Message.Alias, avahi.ServiceType)
+	go ListenForAvahiDevices(client, updates)
+	return nil
+}
+
+// ListenForAvahiDevices adds the LocalSend services found by client to the discovered
+// devices and removes them when they disappear
+func ListenForAvahiDevices(client *avahi.Client, updates chan<- []models.SendModel) {
+	var mu sync.Mutex
+	ips := make(map[string]string) // Service name to the IP it was stored under
+
+	go func() {
+		for range time.Tick(avahiRefresh) {
+			mu.Lock()
+			shared.DevicesMutex.Lock()
+			for _, ip := range ips {
+				if device, ok := shared.DiscoveredDevices[ip]; ok {
+					device.LastSeen = time.Now()
+					shared.DiscoveredDevices[ip] = device
+				}
+			}
+			shared.DevicesMutex.Unlock()
+			mu.Unlock()
+		}
+	}()
+
+	found := func(service avahi.Service) {
+		message, ok := avahiMessage(service)
+		if !ok {
+			logger.Debugf("Ignoring Avahi service %q: not a LocalSend device", service.Name)
+			return
+		}
+		logger.Debugf("Found %s at %s:%d with Avahi", message.Alias, service.Address, service.Port)
+		mu.Lock()
+		ips[service.Name] = service.Address
+		mu.Unlock()
+		shared.DevicesMutex.Lock()
+		shared.DiscoveredDevices[service.Address] = message
+		shared.DevicesMutex.Unlock()
+		sendDeviceUpdates(updates)
+	}
+	removed := func(name string) {
+		mu.Lock()
+		ip, ok := ips[name]
+		delete(ips, name)
+		mu.Unlock()
+		if !ok {
+			return
+		}
+		logger.Debugf("Avahi service %q at %s disappeared", name, ip)
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, ip)
+		shared.DevicesMutex.Unlock()
+		sendDeviceUpdates(updates)
+	}
+	if err := client.Browse(found, removed); err != nil {
+		logger.Errorf("Avahi discovery stopped: %v", err)
+	}
+}
+
+// sendDeviceUpdates sends the discovered devices to updates without blocking
+func sendDeviceUpdates(updates chan<- []models.SendModel) {
+	shared.DevicesMutex.RLock()
+	devices := make([]models.SendModel, 0, len(shared.DiscoveredDevices))
+	for ip, device := range shared.DiscoveredDevices {
+		devices = append(devices, models.SendModel{
+			IP:         ip,
+			DeviceName: device.Alias,
+			Addresses:  device.Addresses,
+		})
+	}
+	shared.DevicesMutex.RUnlock()
+
+	select {
+	case updates <- devices:
+	default:
+		logger.Debug("Updates channel is full, skipping update")
+	}
+}
+
+// avahiTXT is the TXT record of message, the fields of a multicast announcement that
+// the service's name, address and port don't already carry
+func avahiTXT(message models.BroadcastMessage) map[string]string {
+	return map[string]string{
+		"alias":       message.Alias,
+		"version":     message.Version,
+		"deviceModel": message.DeviceModel,
+		"deviceType":  message.DeviceType,
+		"fingerprint": message.Fingerprint,
+		"protocol":    message.Protocol,
+		"download":    strconv.FormatBool(message.Download),
+	}
+}
+
+// avahiMessage translates a resolved service to the announcement of its device. TXT
+// keys arrive lowered. Services without a fingerprint are not LocalSend devices.
+func avahiMessage(service avahi.Service) (models.BroadcastMessage, bool) {
+	txt := service.TXT
+	if txt["fingerprint"] == "" || service.Address == "" {
+		return models.BroadcastMessage{}, false
+	}
+	message := models.BroadcastMessage{
+		Alias:       txt["alias"],
+		Version:     txt["version"],
+		DeviceModel: txt["devicemodel"],
+		DeviceType:  txt["devicetype"],
+		Fingerprint: txt["fingerprint"],
+		Port:        service.Port,
+		Protocol:    txt["protocol"],
+		Download:    txt["download"] == "true",
+		Announce:    true,
+		LastSeen:    time.Now(),
+	}
+	if message.Alias == "" {
+		message.Alias = service.Name
+	}
+	if message.Protocol == "" {
+		message.Protocol = "https"
+	}
+	return message, true
+}
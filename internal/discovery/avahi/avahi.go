@@ -0,0 +1,48 @@
+// Package avahi browses for and publishes LocalSend devices with DNS-SD through the
+// Avahi daemon's D-Bus API (--discovery avahi). It is only available on Linux, where
+// Avahi also answers for devices on other subnets through a reflector and keeps
+// working where UDP multicast from unprivileged processes is filtered.
+package avahi
+
+import (
+	"errors"
+	"strings"
+)
+
+// ServiceType is the DNS-SD service type of LocalSend devices
+const ServiceType = "_localsend._tcp"
+
+var errUnsupported = errors.New("avahi discovery is only available on Linux")
+
+// Service is a resolved LocalSend service
+type Service struct {
+	Name    string            // Instance name, the device alias
+	Host    string            // mDNS host name, e.g. "laptop.local"
+	Address string            // IPv4 address of Host
+	Port    int               // Server port
+	TXT     map[string]string // TXT record entries
+}
+
+// EncodeTXT returns the TXT record of entries as Avahi's array of "key=value" strings
+func EncodeTXT(entries map[string]string) [][]byte {
+	txt := make([][]byte, 0, len(entries))
+	for key, value := range entries {
+		txt = append(txt, []byte(key+"="+value))
+	}
+	return txt
+}
+
+// DecodeTXT parses a TXT record. Keys are case-insensitive and lowered, the first of
+// repeated keys wins, and a key without "=" has an empty value (RFC 6763 6.3-6.4).
+func DecodeTXT(txt [][]byte) map[string]string {
+	entries := make(map[string]string, len(txt))
+	for _, entry := range txt {
+		key, value, _ := strings.Cut(string(entry), "=")
+		key = strings.ToLower(key)
+		if _, ok := entries[key]; ok || key == "" {
+			continue
+		}
+		entries[key] = value
+	}
+	return entries
+}
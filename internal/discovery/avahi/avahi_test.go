@@ -0,0 +1,27 @@
+package avahi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeTXT(t *testing.T) {
+	txt := [][]byte{
+		[]byte("Alias=laptop"),
+		[]byte("alias=ignored"),
+		[]byte("download"),
+		[]byte("url=http://x/?a=b"),
+		[]byte("=nokey"),
+	}
+	want := map[string]string{"alias": "laptop", "download": "", "url": "http://x/?a=b"}
+	if got := DecodeTXT(txt); !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeTXT = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeTXTRoundTrip(t *testing.T) {
+	entries := map[string]string{"alias": "my laptop", "port": "53317", "empty": ""}
+	if got := DecodeTXT(EncodeTXT(entries)); !reflect.DeepEqual(got, entries) {
+		t.Errorf("round trip = %v, want %v", got, entries)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package avahi
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	avahiService   = "org.freedesktop.Avahi"
+	serverIface    = "org.freedesktop.Avahi.Server"
+	browserIface   = "org.freedesktop.Avahi.ServiceBrowser"
+	groupIface     = "org.freedesktop.Avahi.EntryGroup"
+	collisionError = "org.freedesktop.Avahi.CollisionError"
+
+	ifaceUnspec = int32(-1) // All interfaces
+	protoUnspec = int32(-1) // IPv4 and IPv6
+	protoInet   = int32(0)  // IPv4, the address family LocalSend devices are keyed by
+
+	lookupResultOurOwn = uint32(16) // AVAHI_LOOKUP_RESULT_OUR_OWN, a service of this host
+
+	maxRenames = 10 // Alternative names tried when the service name is taken
+)
+
+// Client is a connection to the Avahi daemon on the system bus
+type Client struct {
+	conn   *dbus.Conn
+	server dbus.BusObject
+}
+
+// Connect connects to the Avahi daemon, failing when it isn't running
+func Connect() (*Client, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the system bus: %w", err)
+	}
+	c := &Client{conn: conn, server: conn.Object(avahiService, "/")}
+	var version string
+	if err := c.server.Call(serverIface+".GetVersionString", 0).Store(&version); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("avahi daemon: %w", err)
+	}
+	return c, nil
+}
+
+// Publish announces a LocalSend service named name on port. A name taken by another
+// device is replaced by the alternative Avahi suggests, e.g. "laptop #2".
+func (c *Client) Publish(name string, port int, txt map[string]string) error {
+	var path dbus.ObjectPath
+	if err := c.server.Call(serverIface+".EntryGroupNew", 0).Store(&path); err != nil {
+		return fmt.Errorf("creating entry group: %w", err)
+	}
+	group := c.conn.Object(avahiService, path)
+	for i := 0; ; i++ {
+		err := group.Call(groupIface+".AddService", 0, ifaceUnspec, protoUnspec, uint32(0),
+			name, ServiceType, "", "", uint16(port), EncodeTXT(txt)).Err
+		if err == nil {
+			break
+		}
+		if dbusErr, ok := err.(dbus.Error); !ok || dbusErr.Name != collisionError || i == maxRenames {
+			return fmt.Errorf("adding service %q: %w", name, err)
+		}
+		if err := c.server.Call(serverIface+".GetAlternativeServiceName", 0, name).Store(&name); err != nil {
+			return fmt.Errorf("renaming service: %w", err)
+		}
+	}
+	if err := group.Call(groupIface+".Commit", 0).Err; err != nil {
+		return fmt.Errorf("publishing service %q: %w", name, err)
+	}
+	return nil
+}
+
+// Browse calls found for every LocalSend service that appears on the network and
+// removed with the name of every one that disappears, until the connection is closed.
+// Services of this host and services that fail to resolve are skipped.
+func (c *Client) Browse(found func(Service), removed func(name string)) error {
+	// Subscribe before creating the browser, its first signals follow right away
+	if err := c.conn.AddMatchSignal(dbus.WithMatchInterface(browserIface)); err != nil {
+		return fmt.Errorf("subscribing to browser signals: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 32)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	var path dbus.ObjectPath
+	err := c.server.Call(serverIface+".ServiceBrowserNew", 0, ifaceUnspec, protoInet, ServiceType, "", uint32(0)).Store(&path)
+	if err != nil {
+		return fmt.Errorf("creating service browser: %w", err)
+	}
+
+	for signal := range signals {
+		if signal.Path != path {
+			continue
+		}
+		switch signal.Name {
+		case browserIface + ".ItemNew":
+			var (
+				iface, proto      int32
+				name, typ, domain string
+				flags             uint32
+			)
+			if dbus.Store(signal.Body, &iface, &proto, &name, &typ, &domain, &flags) != nil || flags&lookupResultOurOwn != 0 {
+				continue
+			}
+			if service, err := c.resolve(iface, proto, name, typ, domain); err == nil {
+				found(service)
+			}
+		case browserIface + ".ItemRemove":
+			if len(signal.Body) > 2 {
+				if name, ok := signal.Body[2].(string); ok {
+					removed(name)
+				}
+			}
+		case browserIface + ".Failure":
+			return fmt.Errorf("service browser failed: %v", signal.Body)
+		}
+	}
+	return nil
+}
+
+// resolve looks up the address, port and TXT record of a browsed service
+func (c *Client) resolve(iface, proto int32, name, typ, domain string) (Service, error) {
+	var (
+		aproto        int32
+		host, address string
+		port          uint16
+		txt           [][]byte
+		flags         uint32
+	)
+	err := c.server.Call(serverIface+".ResolveService", 0, iface, proto, name, typ, domain, protoInet, uint32(0)).
+		Store(&iface, &proto, &name, &typ, &domain, &host, &aproto, &address, &port, &txt, &flags)
+	if err != nil {
+		return Service{}, err
+	}
+	return Service{Name: name, Host: host, Address: address, Port: int(port), TXT: DecodeTXT(txt)}, nil
+}
+
+// Close disconnects from the daemon, which withdraws the published service and ends
+// Browse
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package avahi
+
+// Client is a connection to the Avahi daemon, which is unavailable on this platform
+type Client struct{}
+
+// Connect fails, Avahi is only available on Linux
+func Connect() (*Client, error) {
+	return nil, errUnsupported
+}
+
+// Publish announces a service, unsupported on this platform
+func (c *Client) Publish(name string, port int, txt map[string]string) error {
+	return errUnsupported
+}
+
+// Browse looks for services, unsupported on this platform
+func (c *Client) Browse(found func(Service), removed func(name string)) error {
+	return errUnsupported
+}
+
+// Close does nothing on this platform
+func (c *Client) Close() error {
+	return nil
+}
@@ -0,0 +1,48 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/discovery/avahi"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestAvahiMessage(t *testing.T) {
+	sent := models.BroadcastMessage{
+		Alias:       "laptop",
+		Version:     "2.0",
+		DeviceModel: "linux",
+		DeviceType:  "desktop",
+		Fingerprint: "abc123",
+		Port:        53317,
+		Protocol:    "http",
+		Download:    true,
+	}
+	service := avahi.Service{
+		Name:    "laptop #2",
+		Address: "192.168.1.20",
+		Port:    53318,
+		TXT:     avahi.DecodeTXT(avahi.EncodeTXT(avahiTXT(sent))),
+	}
+	got, ok := avahiMessage(service)
+	if !ok {
+		t.Fatal("service not recognized")
+	}
+	if got.Alias != "laptop" || got.DeviceModel != "linux" || got.DeviceType != "desktop" ||
+		got.Fingerprint != "abc123" || got.Protocol != "http" || !got.Download || got.Port != 53318 {
+		t.Errorf("unexpected message %+v", got)
+	}
+	if got.LastSeen.IsZero() {
+		t.Error("LastSeen not set")
+	}
+
+	service.TXT = map[string]string{"fingerprint": "abc123"}
+	if got, _ := avahiMessage(service); got.Alias != "laptop #2" || got.Protocol != "https" {
+		t.Errorf("defaults not applied: %+v", got)
+	}
+
+	service.TXT = map[string]string{"alias": "printer"}
+	if _, ok := avahiMessage(service); ok {
+		t.Error("service without fingerprint accepted")
+	}
+}
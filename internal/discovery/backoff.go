@@ -0,0 +1,47 @@
+package discovery
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	initialAnnounceInterval = time.Second
+	defaultAnnounceInterval = 30 * time.Second
+	defaultAnnounceJitter   = time.Second
+)
+
+// announceBackoff spaces out announcements: the interval starts at 1s and doubles
+// up to max, with a random jitter added so devices started together drift apart.
+type announceBackoff struct {
+	interval time.Duration
+	max      time.Duration
+	jitter   time.Duration
+}
+
+func newAnnounceBackoff(max, jitter time.Duration) *announceBackoff {
+	if max <= 0 {
+		max = defaultAnnounceInterval
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	interval := initialAnnounceInterval
+	if interval > max {
+		interval = max
+	}
+	return &announceBackoff{interval: interval, max: max, jitter: jitter}
+}
+
+// Next returns how long to sleep before the next announcement
+func (b *announceBackoff) Next() time.Duration {
+	sleep := b.interval
+	if b.jitter > 0 {
+		sleep += time.Duration(rand.Int63n(int64(b.jitter)))
+	}
+	b.interval *= 2
+	if b.interval > b.max {
+		b.interval = b.max
+	}
+	return sleep
+}
@@ -0,0 +1,24 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnnounceBackoff(t *testing.T) {
+	b := newAnnounceBackoff(10*time.Second, 0)
+	want := []time.Duration{1, 2, 4, 8, 10, 10}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Second {
+			t.Errorf("step %d: got %s, want %s", i, got, w*time.Second)
+		}
+	}
+
+	b = newAnnounceBackoff(10*time.Second, 500*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		got := b.Next()
+		if got < time.Second || got >= 10*time.Second+500*time.Millisecond {
+			t.Errorf("step %d: %s out of range", i, got)
+		}
+	}
+}
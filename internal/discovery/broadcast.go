@@ -3,6 +3,8 @@ package discovery
 import (
 	"time"
 
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 
 	"github.com/meowrain/localsend-go/internal/models"
@@ -10,16 +12,51 @@ import (
 
 const (
 	multicastIP   = "224.0.0.167"
-	broadcastPort = 53317
+	broadcastPort = config.DefaultPort
 	httpTimeout   = 2 * time.Second
 	scanInterval  = 2 * time.Second
 	deviceTTL     = 200 * time.Second // Device TTL
 )
 
+// DiscoveryPort is the UDP port of multicast and broadcast discovery
+const DiscoveryPort = broadcastPort
+
+// Discovery modes selectable with --discovery
+const (
+	DiscoveryMulticast = "multicast"
+	DiscoveryBroadcast = "broadcast"
+	DiscoveryBoth      = "both"
+)
+
 func ListenAndStartBroadcasts(updates chan<- []models.SendModel) {
+	if config.ConfigData.LocalOnly {
+		logger.Info("Local-only mode, discovery is disabled")
+		return
+	}
+	switch config.ConfigData.DiscoveryMode {
+	case DiscoveryMulticast, DiscoveryBroadcast, DiscoveryBoth, DiscoveryAvahi:
+	default:
+		logger.Warnf("Unknown discovery mode %q, using %s", config.ConfigData.DiscoveryMode, DiscoveryMulticast)
+		config.ConfigData.DiscoveryMode = DiscoveryMulticast
+	}
+	shared.BuildMessage()
+	if config.ConfigData.DiscoveryMode == DiscoveryAvahi {
+		err := startAvahi(updates)
+		if err == nil {
+			if config.ConfigData.DiscoverUPnP {
+				go ListenForUPnPDevices(updates)
+			}
+			return
+		}
+		logger.Warnf("Avahi discovery unavailable, using %s: %v", DiscoveryMulticast, err)
+		config.ConfigData.DiscoveryMode = DiscoveryMulticast
+	}
 	logger.Info("Listening for broadcasts...")
 	go ListenForUDPBroadcasts(updates)
 	go ListenForHttpBroadCast(updates)
+	if config.ConfigData.DiscoverUPnP {
+		go ListenForUPnPDevices(updates)
+	}
 	logger.Info("Start broadcasts...")
 	go StartUDPBroadcast()
 }
@@ -70,6 +70,10 @@ func ListenForHttpBroadCast(updates chan<- []models.SendModel) {
 					return
 				}
 
+				if !certificateMatches(resp, response.Fingerprint) {
+					logger.Warnf("Ignoring %s at %s: its certificate does not match the fingerprint it announces", response.Alias, ip)
+					return
+				}
 				response.LastSeen = time.Now()
 
 				shared.DevicesMutex.Lock()
@@ -86,6 +90,7 @@ func ListenForHttpBroadCast(updates chan<- []models.SendModel) {
 			devices = append(devices, models.SendModel{
 				IP:         ip,
 				DeviceName: device.Alias,
+				Addresses:  device.Addresses,
 			})
 		}
 		shared.DevicesMutex.RUnlock()
@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// errNoDefaultRoute is returned when the routing table has no default route
+var errNoDefaultRoute = errors.New("no default route")
+
+// DefaultRouteSubnets returns the IPv4 networks of the interface the default route
+// goes through, narrowed to /16 at most, or nil when it can't be determined
+func DefaultRouteSubnets() []*net.IPNet {
+	name, err := defaultRouteInterface()
+	if err != nil {
+		return nil
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var subnets []*net.IPNet
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		mask := ipNet.Mask
+		if ones, _ := mask.Size(); ones < ScanMaxPrefix {
+			mask = net.CIDRMask(ScanMaxPrefix, 32)
+		}
+		subnets = append(subnets, &net.IPNet{IP: ipNet.IP.To4().Mask(mask), Mask: mask})
+	}
+	return subnets
+}
+
+// parseProcNetRoute returns the interface of the default route with the lowest metric
+// from the Linux /proc/net/route table
+func parseProcNetRoute(r io.Reader) (string, error) {
+	const rtfUp = 0x1
+	iface, best := "", -1
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfUp == 0 {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+		if best < 0 || metric < best {
+			iface, best = fields[0], metric
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if iface == "" {
+		return "", errNoDefaultRoute
+	}
+	return iface, nil
+}
+
+// parseRouteGet returns the interface from the output of macOS "route -n get default"
+func parseRouteGet(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && key == "interface" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errNoDefaultRoute
+}
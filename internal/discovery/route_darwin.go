@@ -0,0 +1,15 @@
+package discovery
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// defaultRouteInterface returns the name of the interface used by the default route
+func defaultRouteInterface() (string, error) {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return "", err
+	}
+	return parseRouteGet(bytes.NewReader(out))
+}
@@ -0,0 +1,13 @@
+package discovery
+
+import "os"
+
+// defaultRouteInterface returns the name of the interface used by the default route
+func defaultRouteInterface() (string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseProcNetRoute(f)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package discovery
+
+import "errors"
+
+// defaultRouteInterface is not implemented on this platform, the scan falls back to
+// the subnets of all interfaces
+func defaultRouteInterface() (string, error) {
+	return "", errors.New("default route detection is not supported on this platform")
+}
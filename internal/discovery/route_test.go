@@ -0,0 +1,33 @@
+package discovery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetRoute(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+eth0	00000000	0100000A	0003	0	0	100	00000000	0	0	0
+eth0	0000000A	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`
+	if iface, err := parseProcNetRoute(strings.NewReader(table)); err != nil || iface != "eth0" {
+		t.Errorf("got %q, %v", iface, err)
+	}
+	if _, err := parseProcNetRoute(strings.NewReader(strings.Split(table, "\n")[0])); err == nil {
+		t.Error("expected an error without a default route")
+	}
+}
+
+func TestParseRouteGet(t *testing.T) {
+	out := `   route to: default
+destination: default
+       mask: default
+    gateway: 192.168.1.1
+  interface: en0
+      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING>
+`
+	if iface, err := parseRouteGet(strings.NewReader(out)); err != nil || iface != "en0" {
+		t.Errorf("got %q, %v", iface, err)
+	}
+}
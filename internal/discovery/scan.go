@@ -0,0 +1,229 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/certificate"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	scanConcurrency    = 256
+	localSubnetPrefix  = 24                     // Interface subnets larger than this are narrowed to a /24
+	scanProgressPeriod = 2 * time.Second        // Time between progress lines of a scan
+	DefaultScanTimeout = 500 * time.Millisecond // Connect timeout of each probe
+	ScanMaxPrefix      = 16                     // Largest subnet scanned, 65534 hosts
+)
+
+// ScanResult is a LocalSend device found by Scan
+type ScanResult struct {
+	IP   string
+	Info models.BroadcastMessage
+}
+
+// LocalSubnets returns the IPv4 networks of the local interfaces, narrowed to /24 at most
+func LocalSubnets() []*net.IPNet {
+	var subnets []*net.IPNet
+	seen := make(map[string]bool)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			mask := ipNet.Mask
+			if ones, _ := mask.Size(); ones < localSubnetPrefix {
+				mask = net.CIDRMask(localSubnetPrefix, 32)
+			}
+			subnet := &net.IPNet{IP: ipNet.IP.To4().Mask(mask), Mask: mask}
+			if !seen[subnet.String()] {
+				seen[subnet.String()] = true
+				subnets = append(subnets, subnet)
+			}
+		}
+	}
+	return subnets
+}
+
+// ParseScanSubnet parses an IPv4 subnet in CIDR notation, at most a /16
+func ParseScanSubnet(cidr string) (*net.IPNet, error) {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil || subnet.IP.To4() == nil {
+		return nil, fmt.Errorf("invalid IPv4 subnet %q", cidr)
+	}
+	if ones, _ := subnet.Mask.Size(); ones < ScanMaxPrefix {
+		return nil, fmt.Errorf("subnet %s is larger than /%d", subnet, ScanMaxPrefix)
+	}
+	return subnet, nil
+}
+
+// subnetHosts lists the host addresses of an IPv4 subnet, without network and broadcast address
+func subnetHosts(subnet *net.IPNet) []net.IP {
+	base := subnet.IP.To4()
+	if base == nil {
+		return nil
+	}
+	ones, bits := subnet.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	start := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+
+	first, last := uint32(0), size-1
+	if size > 2 {
+		first, last = 1, size-2
+	}
+	hosts := make([]net.IP, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		n := start + i
+		hosts = append(hosts, net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)))
+	}
+	return hosts
+}
+
+// Scan probes port on every host of subnets and returns the hosts that answer the
+// LocalSend info endpoint. Found devices are added to the discovered devices. Each
+// probe gives up connecting after timeout; progress is logged every few seconds.
+func Scan(ctx context.Context, subnets []*net.IPNet, port int, timeout time.Duration) []ScanResult {
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	var (
+		results []ScanResult
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	// Don't report this device itself
+	own := make(map[string]bool)
+	if ips, err := GetLocalIP(); err == nil {
+		for _, ip := range ips {
+			own[ip.String()] = true
+		}
+	}
+
+	found := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(results)
+	}
+	sem := make(chan struct{}, scanConcurrency)
+	for _, subnet := range subnets {
+		hosts := subnetHosts(subnet)
+		logger.Infof("Scanning %s (%d hosts)...", subnet, len(hosts))
+		progress := time.NewTicker(scanProgressPeriod)
+		for _, host := range hosts {
+			if own[host.String()] {
+				continue
+			}
+			select {
+			case <-progress.C:
+				logger.Infof("Scanning %s (%d hosts)... found %d so far", subnet, len(hosts), found())
+			default:
+			}
+			select {
+			case <-ctx.Done():
+				progress.Stop()
+				wg.Wait()
+				return results
+			case sem <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(ip string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				info, ok := probeHost(ctx, client, ip, port, timeout)
+				if !ok {
+					return
+				}
+				mu.Lock()
+				results = append(results, ScanResult{IP: ip, Info: info})
+				mu.Unlock()
+
+				shared.DevicesMutex.Lock()
+				shared.DiscoveredDevices[ip] = info
+				shared.DevicesMutex.Unlock()
+			}(host.String())
+		}
+		progress.Stop()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(results[i].IP).To4(), net.ParseIP(results[j].IP).To4()) < 0
+	})
+	return results
+}
+
+// certificateMatches reports whether the certificate a response came with is the one
+// of fingerprint, the SHA-256 LocalSend peers announce. Plain http has nothing to check.
+func certificateMatches(resp *http.Response, fingerprint string) bool {
+	if resp.TLS == nil {
+		return true
+	}
+	certs := resp.TLS.PeerCertificates
+	return len(certs) > 0 && strings.EqualFold(certificate.Fingerprint(certs[0].Raw), fingerprint)
+}
+
+// probeHost checks that port is open and serves the LocalSend info endpoint
+func probeHost(ctx context.Context, client *http.Client, ip string, port int, timeout time.Duration) (models.BroadcastMessage, bool) {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return models.BroadcastMessage{}, false
+	}
+	conn.Close()
+
+	// LocalSend apps serve https, localsend-go serves http
+	for _, protocol := range []string{"https", "http"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/api/localsend/v2/info", protocol, addr), nil)
+		if err != nil {
+			return models.BroadcastMessage{}, false
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		var info models.BroadcastMessage
+		err = json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil || info.Alias == "" {
+			continue
+		}
+		if !certificateMatches(resp, info.Fingerprint) {
+			logger.Warnf("Ignoring %s at %s: its certificate does not match the fingerprint it announces", info.Alias, ip)
+			return models.BroadcastMessage{}, false
+		}
+		info.Port = port
+		info.Protocol = protocol
+		info.LastSeen = time.Now()
+		return info, true
+	}
+	return models.BroadcastMessage{}, false
+}
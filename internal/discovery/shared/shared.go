@@ -1,11 +1,13 @@
 package shared
 
 import (
+	"runtime"
 	"sync"
 
 	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/models"
 	"github.com/meowrain/localsend-go/internal/utils"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
 )
 
 // 全局设备记录哈希表和互斥锁,Message信息
@@ -20,10 +22,25 @@ var Message = models.BroadcastMessage{
 	Alias:       config.ConfigData.NameOfDevice,
 	Version:     "2.0",
 	DeviceModel: utils.CheckOSType(),
-	DeviceType:  "headless",      // CLI工具使用headless类型
 	Fingerprint: "random-string", // 应该生成一个唯一的指纹
-	Port:        53317,
+	Port:        config.DefaultPort,
 	Protocol:    "http",
 	Download:    true,
 	Announce:    true,
+	OS:          runtime.GOOS,
+	GOArch:      runtime.GOARCH,
+}
+
+var buildOnce sync.Once
+
+// BuildMessage completes Message before it is first announced. The device type is
+// detected here, not at startup, as detection runs system_profiler or powershell;
+// --device-type skips it.
+func BuildMessage() {
+	buildOnce.Do(func() {
+		if Message.DeviceType == "" {
+			Message.DeviceType = utils.DetectDeviceType()
+		}
+		logger.Debugf("Device type: %s", Message.DeviceType)
+	})
 }
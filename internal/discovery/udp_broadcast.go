@@ -2,22 +2,82 @@ package discovery
 
 import (
 	"encoding/json"
-	"fmt"
 	"net"
 	"time"
 
+	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/discovery/shared"
 	"github.com/meowrain/localsend-go/internal/models"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 )
 
-func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
-	multicastAddr := &net.UDPAddr{
+// listenUDP opens the UDP socket announcements are received on for the given discovery mode
+func listenUDP(mode string) (*net.UDPConn, error) {
+	if mode == DiscoveryBroadcast {
+		return net.ListenUDP("udp4", &net.UDPAddr{Port: broadcastPort})
+	}
+	// The multicast socket is bound to the wildcard address, so it also receives broadcasts
+	return net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{
 		IP:   net.ParseIP(multicastIP),
 		Port: broadcastPort,
+	})
+}
+
+// announceAddrs returns the addresses announcements are sent to for the given discovery mode
+func announceAddrs(mode string) []*net.UDPAddr {
+	var addrs []*net.UDPAddr
+	if mode == DiscoveryMulticast || mode == DiscoveryBoth {
+		addrs = append(addrs, &net.UDPAddr{IP: net.ParseIP(multicastIP), Port: broadcastPort})
+	}
+	if mode == DiscoveryBroadcast || mode == DiscoveryBoth {
+		for _, ip := range broadcastIPs() {
+			addrs = append(addrs, &net.UDPAddr{IP: ip, Port: broadcastPort})
+		}
+	}
+	return addrs
+}
+
+// broadcastIPs returns the directed broadcast address of every IPv4 interface network
+func broadcastIPs() []net.IP {
+	var ips []net.IP
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return []net.IP{net.IPv4bcast}
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLoopback() {
+				continue
+			}
+			ip4 := ipNet.IP.To4()
+			mask := net.IP(ipNet.Mask).To4()
+			if mask == nil {
+				continue
+			}
+			bcast := make(net.IP, net.IPv4len)
+			for i := range ip4 {
+				bcast[i] = ip4[i] | ^mask[i]
+			}
+			ips = append(ips, bcast)
+		}
+	}
+	if len(ips) == 0 {
+		ips = append(ips, net.IPv4bcast)
 	}
+	return ips
+}
 
-	conn, err := net.ListenMulticastUDP("udp", nil, multicastAddr)
+func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
+	mode := config.ConfigData.DiscoveryMode
+	conn, err := listenUDP(mode)
 	if err != nil {
 		logger.Errorf("Failed to listen for UDP broadcasts: %v", err)
 		return
@@ -26,7 +86,7 @@ func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
 
 	conn.SetReadBuffer(4096)
 
-	logger.Info("Started listening for UDP broadcasts on ", multicastAddr.String())
+	logger.Infof("Started listening for UDP %s announcements on %s", mode, conn.LocalAddr().String())
 
 	for {
 		buf := make([]byte, 4096)
@@ -65,6 +125,7 @@ func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
 			devices = append(devices, models.SendModel{
 				IP:         ip,
 				DeviceName: device.Alias,
+				Addresses:  device.Addresses,
 			})
 		}
 		shared.DevicesMutex.Unlock()
@@ -81,37 +142,37 @@ func ListenForUDPBroadcasts(updates chan<- []models.SendModel) {
 }
 
 func StartUDPBroadcast() {
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", multicastIP, broadcastPort))
-	if err != nil {
-		logger.Errorf("Failed to resolve UDP address: %v", err)
+	addrs := announceAddrs(config.ConfigData.DiscoveryMode)
+	if len(addrs) == 0 {
+		logger.Errorf("No UDP announcement addresses for discovery mode %q", config.ConfigData.DiscoveryMode)
 		return
 	}
 
-	conn, err := net.DialUDP("udp", nil, addr)
+	conn, err := net.ListenUDP("udp4", nil)
 	if err != nil {
-		logger.Errorf("Failed to dial UDP: %v", err)
+		logger.Errorf("Failed to open UDP socket: %v", err)
 		return
 	}
 	defer conn.Close()
 
 	logger.Info("Started UDP broadcast")
 
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+	backoff := newAnnounceBackoff(config.ConfigData.DiscoveryInterval, config.ConfigData.DiscoveryJitter)
 
 	const maxFailCount = 3 // Maximum failure count
 	failCount := 0         // Failure counter
 
 	refreshConnection := func() {
 		conn.Close()
-		conn, err = net.DialUDP("udp", nil, addr)
+		conn, err = net.ListenUDP("udp4", nil)
 		if err != nil {
 			logger.Errorf("Failed to refresh UDP connection: %v", err)
 			return
 		}
 	}
 
-	for range ticker.C {
+	for {
+		time.Sleep(backoff.Next())
 		data, err := json.Marshal(shared.Message)
 		if err != nil {
 			logger.Errorf("Failed to marshal broadcast message: %v", err)
@@ -124,8 +185,15 @@ func StartUDPBroadcast() {
 			continue
 		}
 
-		_, err = conn.Write(data)
-		if err != nil {
+		sent := 0
+		for _, addr := range addrs {
+			if _, err = conn.WriteToUDP(data, addr); err != nil {
+				logger.Debugf("Failed to send UDP announcement to %s: %v", addr, err)
+				continue
+			}
+			sent++
+		}
+		if sent == 0 {
 			logger.Errorf("Failed to send UDP broadcast: %v", err)
 			failCount++
 			if failCount >= maxFailCount {
@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huin/goupnp"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	// upnpInterval is the time between SSDP searches, they are answered by every UPnP device
+	upnpInterval = 30 * time.Second
+	// upnpSearchTarget asks all UPnP devices to answer, LocalSend has no registered type
+	upnpSearchTarget = "ssdp:all"
+)
+
+// upnpCandidate is a UPnP device that describes itself as LocalSend
+type upnpCandidate struct {
+	IP   string
+	Port int
+}
+
+// ListenForUPnPDevices searches for LocalSend devices with SSDP (--discover-upnp), for
+// networks that block UDP multicast but where devices register with UPnP. Devices whose
+// description mentions LocalSend are checked on their info endpoint before being added.
+func ListenForUPnPDevices(updates chan<- []models.SendModel) {
+	client := &http.Client{
+		Timeout: httpTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), upnpInterval)
+		roots, err := goupnp.DiscoverDevicesCtx(ctx, upnpSearchTarget)
+		if err != nil {
+			logger.Debugf("UPnP search failed: %v", err)
+		}
+		found := false
+		for _, candidate := range upnpCandidates(roots) {
+			info, ok := probeHost(ctx, client, candidate.IP, candidate.Port, DefaultScanTimeout)
+			if !ok {
+				continue
+			}
+			logger.Debugf("Found %s at %s:%d with UPnP", info.Alias, candidate.IP, candidate.Port)
+			shared.DevicesMutex.Lock()
+			shared.DiscoveredDevices[candidate.IP] = info
+			shared.DevicesMutex.Unlock()
+			found = true
+		}
+		cancel()
+
+		if found {
+			shared.DevicesMutex.RLock()
+			devices := make([]models.SendModel, 0, len(shared.DiscoveredDevices))
+			for ip, device := range shared.DiscoveredDevices {
+				devices = append(devices, models.SendModel{
+					IP:         ip,
+					DeviceName: device.Alias,
+					Addresses:  device.Addresses,
+				})
+			}
+			shared.DevicesMutex.RUnlock()
+
+			select {
+			case updates <- devices:
+			default:
+				logger.Debug("Updates channel is full, skipping update")
+			}
+		}
+		time.Sleep(upnpInterval)
+	}
+}
+
+// upnpCandidates picks the devices whose UPnP description mentions LocalSend. The IP
+// comes from the description's location, the port from its presentation URL when set.
+func upnpCandidates(roots []goupnp.MaybeRootDevice) []upnpCandidate {
+	var candidates []upnpCandidate
+	seen := make(map[upnpCandidate]bool)
+	for _, root := range roots {
+		if root.Err != nil || root.Root == nil || root.Location == nil {
+			continue
+		}
+		root.Root.Device.VisitDevices(func(device *goupnp.Device) {
+			if !isLocalSendDevice(device) {
+				return
+			}
+			candidate := upnpCandidate{IP: root.Location.Hostname(), Port: broadcastPort}
+			if device.PresentationURL.Str != "" && device.PresentationURL.URL.Port() != "" {
+				if port, err := strconv.Atoi(device.PresentationURL.URL.Port()); err == nil {
+					candidate.Port = port
+				}
+			}
+			if net.ParseIP(candidate.IP) == nil || seen[candidate] {
+				return
+			}
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		})
+	}
+	return candidates
+}
+
+// isLocalSendDevice reports whether a UPnP device or one of its services names LocalSend
+func isLocalSendDevice(device *goupnp.Device) bool {
+	for _, field := range []string{device.DeviceType, device.FriendlyName, device.Manufacturer, device.ModelName} {
+		if strings.Contains(strings.ToLower(field), "localsend") {
+			return true
+		}
+	}
+	for _, service := range device.Services {
+		if strings.Contains(strings.ToLower(service.ServiceType), "localsend") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package discovery
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/huin/goupnp"
+)
+
+func TestUPnPCandidates(t *testing.T) {
+	root := func(location string, device goupnp.Device) goupnp.MaybeRootDevice {
+		loc, _ := url.Parse(location)
+		return goupnp.MaybeRootDevice{Location: loc, Root: &goupnp.RootDevice{Device: device}}
+	}
+	presentation, _ := url.Parse("http://192.168.1.20:53318/")
+	roots := []goupnp.MaybeRootDevice{
+		root("http://192.168.1.1:1900/rootDesc.xml", goupnp.Device{FriendlyName: "Router",
+			Devices: []goupnp.Device{{ModelName: "LocalSend"}}}),
+		root("http://192.168.1.20:49152/desc.xml", goupnp.Device{FriendlyName: "Alice",
+			PresentationURL: goupnp.URLField{URL: *presentation, Ok: true, Str: presentation.String()},
+			Services:        []goupnp.Service{{ServiceType: "urn:localsend-org:service:LocalSend:1"}}}),
+		root("http://192.168.1.30:8200/desc.xml", goupnp.Device{FriendlyName: "Media server"}),
+		root("http://192.168.1.1:1900/rootDesc.xml", goupnp.Device{ModelName: "localsend"}), // Same device again
+	}
+
+	want := []upnpCandidate{{IP: "192.168.1.1", Port: 53317}, {IP: "192.168.1.20", Port: 53318}}
+	if got := upnpCandidates(roots); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// DeviceEvent is a device appearing on or disappearing from the network
+type DeviceEvent struct {
+	Lost      bool // The device was not seen for deviceTTL and was removed
+	IP        string
+	Device    models.BroadcastMessage
+	FirstSeen time.Time
+}
+
+// WatchDevices calls onEvent for every device discovered and every device whose
+// announcements stopped for longer than deviceTTL, until ctx is done. Expired devices
+// are removed from shared.DiscoveredDevices.
+func WatchDevices(ctx context.Context, onEvent func(DeviceEvent)) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	firstSeen := make(map[string]time.Time)
+	for {
+		var events []DeviceEvent
+		now := time.Now()
+		shared.DevicesMutex.Lock()
+		for ip, device := range shared.DiscoveredDevices {
+			if now.Sub(device.LastSeen) > deviceTTL {
+				delete(shared.DiscoveredDevices, ip)
+				if seen, ok := firstSeen[ip]; ok {
+					delete(firstSeen, ip)
+					events = append(events, DeviceEvent{Lost: true, IP: ip, Device: device, FirstSeen: seen})
+				}
+				continue
+			}
+			if _, ok := firstSeen[ip]; !ok {
+				firstSeen[ip] = device.LastSeen
+				events = append(events, DeviceEvent{IP: ip, Device: device, FirstSeen: device.LastSeen})
+			}
+		}
+		shared.DevicesMutex.Unlock()
+		for _, event := range events {
+			onEvent(event)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package fusefs exposes received files in a FUSE filesystem while they are still
+// arriving, so they can be streamed without writing them to disk (--fuse-mount).
+// It is only available on Linux in builds with -tags fuse.
+package fusefs
+
+import (
+	"io"
+	"strings"
+)
+
+// File is a received file that is being written into the FUSE filesystem
+type File interface {
+	io.Writer
+	// Close marks the file as complete; readers get EOF at its end
+	Close() error
+	// Abort drops the file, readers get an I/O error
+	Abort()
+}
+
+// dirName turns a sender alias into a single safe path element
+func dirName(alias string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 {
+			return '_'
+		}
+		return r
+	}, alias)
+	if name == "" || name == "." || name == ".." {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,27 @@
+//go:build !(fuse && linux)
+
+package fusefs
+
+import "errors"
+
+var errUnsupported = errors.New("FUSE support requires Linux and a build with -tags fuse")
+
+// Mount is unavailable in this build
+func Mount(mountpoint string) error {
+	return errUnsupported
+}
+
+// Unmount is a no-op in this build
+func Unmount() error {
+	return nil
+}
+
+// Enabled reports whether a FUSE filesystem is mounted
+func Enabled() bool {
+	return false
+}
+
+// Create is unavailable in this build
+func Create(sender, name string, size int64) (File, string, error) {
+	return nil, "", errUnsupported
+}
@@ -0,0 +1,108 @@
+//go:build fuse && linux
+
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+var (
+	mu         sync.Mutex
+	server     *fuse.Server
+	root       *dirNode
+	mountPoint string
+)
+
+// dirNode is a directory; its children are added as files arrive
+type dirNode struct {
+	fs.Inode
+}
+
+// Mount mounts an empty filesystem at mountpoint and serves it in the background
+func Mount(mountpoint string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if server != nil {
+		return errors.New("FUSE filesystem already mounted")
+	}
+
+	rootNode := &dirNode{}
+	srv, err := fs.Mount(mountpoint, rootNode, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: "localsend",
+			Name:   "localsend",
+			// Mount without fusermount when running as root, falls back otherwise
+			DirectMount: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	server, root, mountPoint = srv, rootNode, mountpoint
+	return nil
+}
+
+// Unmount unmounts the filesystem
+func Unmount() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	err := server.Unmount()
+	server, root = nil, nil
+	return err
+}
+
+// Enabled reports whether a FUSE filesystem is mounted
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return server != nil
+}
+
+// Create adds <sender>/<name> to the filesystem and returns it for writing, together
+// with its path under the mountpoint. An existing file with the same name is replaced.
+func Create(sender, name string, size int64) (File, string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if server == nil {
+		return nil, "", errors.New("FUSE filesystem not mounted")
+	}
+
+	parts := []string{dirName(sender)}
+	for _, part := range strings.Split(path.Clean("/"+filepath.ToSlash(name)), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) < 2 {
+		return nil, "", errors.New("invalid file name")
+	}
+
+	ctx := context.Background()
+	dir := root.EmbeddedInode()
+	for _, part := range parts[:len(parts)-1] {
+		child := dir.GetChild(part)
+		if child == nil {
+			child = dir.NewPersistentInode(ctx, &dirNode{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+			dir.AddChild(part, child, false)
+		} else if !child.IsDir() {
+			return nil, "", errors.New("path conflicts with an existing file")
+		}
+		dir = child
+	}
+
+	file := newStreamFile(size)
+	base := parts[len(parts)-1]
+	dir.AddChild(base, dir.NewPersistentInode(ctx, file, fs.StableAttr{Mode: fuse.S_IFREG}), true)
+	return file, filepath.Join(append([]string{mountPoint}, parts...)...), nil
+}
@@ -0,0 +1,122 @@
+//go:build fuse && linux
+
+package fusefs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// streamFile is a read-only file whose content is appended while it is received.
+// Reads past the received data block until more arrives or the file is complete.
+type streamFile struct {
+	fs.Inode
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	data     []byte
+	size     int64 // Declared size, shown until the file is complete
+	complete bool
+	aborted  bool
+}
+
+var (
+	_ fs.NodeOpener    = (*streamFile)(nil)
+	_ fs.NodeReader    = (*streamFile)(nil)
+	_ fs.NodeGetattrer = (*streamFile)(nil)
+)
+
+func newStreamFile(size int64) *streamFile {
+	f := &streamFile{size: size}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Write appends received data
+func (f *streamFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.aborted {
+		return 0, syscall.EIO
+	}
+	f.data = append(f.data, p...)
+	f.cond.Broadcast()
+	return len(p), nil
+}
+
+// Close marks the file as complete
+func (f *streamFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.aborted {
+		f.complete = true
+		f.size = int64(len(f.data))
+	}
+	f.cond.Broadcast()
+	return nil
+}
+
+// Abort drops the data; pending and later reads fail
+func (f *streamFile) Abort() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = true
+	f.data = nil
+	f.cond.Broadcast()
+}
+
+// Open uses direct I/O so reads are not cut off at the size the kernel cached
+func (f *streamFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (f *streamFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out.Mode = 0o444
+	out.Size = uint64(f.size)
+	return 0
+}
+
+func (f *streamFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	// Wake up the wait below if the reader goes away
+	stop := context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		if f.aborted {
+			return nil, syscall.EIO
+		}
+		if off < int64(len(f.data)) || f.complete {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, syscall.EINTR
+		}
+		f.cond.Wait()
+	}
+
+	if off >= int64(len(f.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(f.data)) {
+		end = int64(len(f.data))
+	}
+	// Copy, the slice may be reallocated by the next Write
+	n := copy(dest, f.data[off:end])
+	return fuse.ReadResultData(dest[:n]), 0
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// acceptTimeout bounds the accept prompt, senders give up on the prepare request
+// after a minute
+var acceptTimeout = 45 * time.Second
+
+// promptAccept shows the accept prompt, tests answer it instead
+var promptAccept = tui.AskAccept
+
+// terminal is held while a prompt is shown, so prompts of concurrent sessions and
+// uploads don't share the terminal
+var terminal = make(chan struct{}, 1)
+
+// askAccept asks the user whether to receive the files of an incoming transfer and
+// returns the IDs of the accepted ones, none when rejected or unanswered in time
+func askAccept(r *http.Request, sender models.Info, files map[string]models.FileInfo) []string {
+	ctx, cancel := context.WithTimeout(r.Context(), acceptTimeout)
+	defer cancel()
+
+	select {
+	case terminal <- struct{}{}:
+		defer func() { <-terminal }()
+	case <-ctx.Done():
+		logger.Warnf("No answer to accept the transfer from %s in time", sender.Alias)
+		return nil
+	}
+	accepted := promptAccept(ctx, sender, files)
+	if ctx.Err() != nil {
+		logger.Warnf("No answer to accept the transfer from %s in time", sender.Alias)
+	}
+	return accepted
+}
+
+// acceptedFiles returns the accepted files of a transfer
+func acceptedFiles(files map[string]models.FileInfo, accepted []string) map[string]models.FileInfo {
+	kept := make(map[string]models.FileInfo, len(accepted))
+	for _, id := range accepted {
+		if fileInfo, ok := files[id]; ok {
+			kept[id] = fileInfo
+		}
+	}
+	return kept
+}
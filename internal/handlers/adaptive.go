@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	adaptiveWarmup = 1 << 20         // Bytes sent before the first throughput check
+	adaptiveWindow = 5 * time.Second // Sampling window of the feedback loop
+
+	adaptiveLowRatio  = 0.3 // Below this share of the link speed the buffer grows
+	adaptiveDropRatio = 0.5 // A window this much slower than the last one shrinks it
+)
+
+// adaptiveBuffer sizes the upload copy buffer from the measured throughput: it
+// grows while the link is underused and shrinks when throughput suddenly drops
+type adaptiveBuffer struct {
+	size    int
+	linkBps float64 // Estimated link capacity in bytes/s, 0 if unknown
+
+	start       time.Time
+	total       int64
+	warmedUp    bool
+	windowStart time.Time
+	windowBytes int64
+	lastBps     float64
+}
+
+func newAdaptiveBuffer(size int, linkBps float64, now time.Time) *adaptiveBuffer {
+	return &adaptiveBuffer{size: size, linkBps: linkBps, start: now, windowStart: now}
+}
+
+// observe records n bytes written at now and returns the buffer size to use next
+func (a *adaptiveBuffer) observe(n int, now time.Time) int {
+	a.total += int64(n)
+	a.windowBytes += int64(n)
+
+	if !a.warmedUp {
+		if a.total < adaptiveWarmup {
+			return a.size
+		}
+		a.warmedUp = true
+		if bps := rate(a.total, now.Sub(a.start)); a.underused(bps) {
+			a.resize(a.size*2, "throughput %.1f MB/s is below 30%% of the link", bps/1e6)
+		}
+		a.windowStart, a.windowBytes = now, 0
+		return a.size
+	}
+
+	if now.Sub(a.windowStart) < adaptiveWindow {
+		return a.size
+	}
+	bps := rate(a.windowBytes, now.Sub(a.windowStart))
+	switch {
+	case a.lastBps > 0 && bps < a.lastBps*adaptiveDropRatio:
+		a.resize(a.size/2, "throughput dropped from %.1f to %.1f MB/s", a.lastBps/1e6, bps/1e6)
+	case a.underused(bps):
+		a.resize(a.size*2, "throughput %.1f MB/s is below 30%% of the link", bps/1e6)
+	}
+	a.lastBps = bps
+	a.windowStart, a.windowBytes = now, 0
+	return a.size
+}
+
+func (a *adaptiveBuffer) underused(bps float64) bool {
+	return a.linkBps > 0 && bps < a.linkBps*adaptiveLowRatio
+}
+
+func (a *adaptiveBuffer) resize(size int, reason string, args ...interface{}) {
+	size = min(max(size, minUploadBufferSize), maxUploadBufferSize)
+	if size == a.size {
+		return
+	}
+	logger.Debugf("Upload buffer %d -> %d bytes: "+reason, append([]interface{}{a.size, size}, args...)...)
+	a.size = size
+}
+
+// rate returns bytes per second
+func rate(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// adaptiveCopy copies src to dst like io.CopyBuffer, resizing the buffer as it goes
+func adaptiveCopy(dst io.Writer, src io.Reader, size int, linkBps float64) (int64, error) {
+	tuner := newAdaptiveBuffer(size, linkBps, time.Now())
+	buf := make([]byte, size)
+	var written int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+			if next := tuner.observe(n, time.Now()); next != len(buf) {
+				buf = make([]byte, next)
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// linkSpeed estimates the capacity, in bytes/s, of the interface that reaches ip.
+// Link speeds aren't exposed portably, so the MTU is used as a hint: jumbo frames
+// usually mean 10 Gbit/s, a standard Ethernet MTU 1 Gbit/s. 0 means unknown.
+func linkSpeed(ip string) float64 {
+	peer := net.ParseIP(ip)
+	if peer == nil || peer.IsLoopback() {
+		return 0
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 0
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || !ipNet.Contains(peer) {
+				continue
+			}
+			switch {
+			case iface.MTU >= 9000:
+				return 10e9 / 8
+			case iface.MTU >= 1500:
+				return 1e9 / 8
+			default:
+				return 100e6 / 8
+			}
+		}
+	}
+	return 0
+}
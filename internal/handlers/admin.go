@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// logLevelBody is the request and response of /api/admin/log-level
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+// isLoopback reports whether a request comes from this machine
+func isLoopback(r *http.Request) bool {
+	ip := net.ParseIP(remoteIP(r.RemoteAddr))
+	return ip != nil && ip.IsLoopback()
+}
+
+// LogLevelHandler reads (GET) or changes (PUT) the log level at runtime.
+// Only local requests are allowed; SIGHUP reverts to the configured level.
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if !isLoopback(r) {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "Forbidden")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body logLevelBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_body", "Invalid request body")
+			return
+		}
+		level, err := logrus.ParseLevel(body.Level)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_log_level", "Invalid log level")
+			return
+		}
+		logger.SetLevel(level)
+		logger.Infof("Log level set to %s", level)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevelBody{Level: logger.GetLevel().String()})
+}
+
+// pauseBody is the response of /api/admin/pause-transfers and resume-transfers
+type pauseBody struct {
+	Paused bool `json:"paused"`
+}
+
+// PauseTransfersHandler pauses all transfers (POST), like SIGUSR1. Only local requests are allowed.
+func PauseTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	setPaused(w, r, PauseTransfers)
+}
+
+// ResumeTransfersHandler resumes paused transfers (POST), like SIGUSR2. Only local requests are allowed.
+func ResumeTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	setPaused(w, r, ResumeTransfers)
+}
+
+// setPaused applies change and answers with the resulting state
+func setPaused(w http.ResponseWriter, r *http.Request, change func() bool) {
+	if !isLoopback(r) {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "Forbidden")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	change()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pauseBody{Paused: TransfersPaused()})
+}
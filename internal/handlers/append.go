@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/fusefs"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// ReceiveModeAppend appends incoming data to existing files (--receive-mode append)
+const ReceiveModeAppend = "append"
+
+// appendOffsets returns, with --receive-mode append, the files of the session that
+// already exist and their size, where the upload continues. Their content is not read
+// here: hashing every existing file would hold up the prepare request, so the prefix
+// is checked against the sender's SHA256 of it when the upload arrives.
+func appendOffsets(session *ReceiveSession) map[string]models.FileOffset {
+	if config.ConfigData.ReceiveMode != ReceiveModeAppend || fusefs.Enabled() {
+		return nil
+	}
+	offsets := make(map[string]models.FileOffset)
+	for id, fileInfo := range session.Files {
+		filePath, err := appendPath(session, fileInfo)
+		if err != nil {
+			continue
+		}
+		info, err := os.Lstat(filePath)
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+			continue
+		}
+		offsets[id] = models.FileOffset{Offset: info.Size()}
+	}
+	return offsets
+}
+
+// openAppendFile opens the existing file of an append upload after checking its content
+// against prefixSum, the sender's SHA256 of the part it skipped. The existing content is
+// fed to hasher so the SHA256 check covers the whole file; remove truncates the file
+// back to its previous size.
+func openAppendFile(session *ReceiveSession, fileInfo models.FileInfo, offset models.FileOffset, prefixSum string, hasher hash.Hash) (io.WriteCloser, string, func(), error) {
+	filePath, err := appendPath(session, fileInfo)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	sum, err := hashPrefix(filePath, offset.Offset, hasher)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !strings.EqualFold(sum, prefixSum) {
+		return nil, "", nil, fmt.Errorf("%s differs from the start of the sender's file", filePath)
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.Size() != offset.Offset {
+		file.Close()
+		return nil, "", nil, fmt.Errorf("%s changed since the session was prepared", filePath)
+	}
+	return file, filePath, func() { os.Truncate(filePath, offset.Offset) }, nil
+}
+
+// appendPath returns the existing file an upload appends to, which must be inside the receive directory
+func appendPath(session *ReceiveSession, fileInfo models.FileInfo) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(fileInfo.FileName)) {
+		return "", fmt.Errorf("invalid file name %q", fileInfo.FileName)
+	}
+	return filepath.Join(session.Dir, filepath.FromSlash(fileInfo.FileName)), nil
+}
+
+// hashPrefix returns the SHA256 of the first n bytes of a file, also writing them to w if set
+func hashPrefix(filePath string, n int64, w io.Writer) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	dst := io.Writer(h)
+	if w != nil {
+		dst = io.MultiWriter(h, w)
+	}
+	if _, err := io.CopyN(dst, file, n); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// appendedPrefix is the part of a file the receiver already has and the sender skips
+type appendedPrefix struct {
+	Offset int64
+	SHA256 string // Of the skipped data, the receiver checks its copy against it
+}
+
+// skipAppended consumes the part of r the receiver already has when it appends to an
+// existing file or resumes one, hashing it for the receiver to check
+func skipAppended(sessionID, fileID string, r io.Reader, size int64) (appendedPrefix, error) {
+	offset, ok := getOutgoingSession(sessionID).Offsets[fileID]
+	if !ok || offset.Offset == 0 {
+		return appendedPrefix{}, nil
+	}
+	if size >= 0 && offset.Offset > size {
+		return appendedPrefix{}, fmt.Errorf("the receiver's %s is larger than this file (%d > %d bytes)", fileID, offset.Offset, size)
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, r, offset.Offset); err != nil {
+		return appendedPrefix{}, err
+	}
+	if offset.Partial {
+		logger.Infof("Resuming %s after the first %d bytes", fileID, offset.Offset)
+	} else {
+		logger.Infof("Receiver has the first %d bytes of %s, appending the rest", offset.Offset, fileID)
+	}
+	return appendedPrefix{Offset: offset.Offset, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestAppendOffsetsStayInReceiveDir(t *testing.T) {
+	dir := t.TempDir()
+	recv := filepath.Join(dir, "recv")
+	if err := os.MkdirAll(recv, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "secret"), []byte("outside"), 0o644)
+	os.WriteFile(filepath.Join(recv, "log.txt"), []byte("line1\n"), 0o644)
+	os.Symlink(filepath.Join(dir, "secret"), filepath.Join(recv, "link"))
+
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = recv
+	config.ConfigData.ReceiveMode = ReceiveModeAppend
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.OrganizeBy = ""
+
+	prepare := func(name string) *httptest.ResponseRecorder {
+		req := models.PrepareReceiveRequest{
+			Info:  models.Info{Alias: "peer"},
+			Files: map[string]models.FileInfo{"f": {ID: "f", FileName: name, Size: 100, FileType: "text/plain"}},
+		}
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		PrepareReceive(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))))
+		return rec
+	}
+
+	// A name outside the receive directory is dropped before any offset is computed
+	for _, name := range []string{"../secret", "sub/../../secret", "/etc/passwd"} {
+		rec := prepare(name)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "offsets") {
+			t.Errorf("%s: got %d %s", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Symlinks are not followed
+	if rec := prepare("link"); strings.Contains(rec.Body.String(), "offsets") {
+		t.Errorf("link: got offsets %s", rec.Body.String())
+	}
+
+	rec := prepare("log.txt")
+	var resp models.PrepareReceiveResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Offsets["f"].Offset != 6 {
+		t.Errorf("got offsets %+v", resp.Offsets)
+	}
+	CancelReceiveSession(resp.SessionID)
+}
+
+func TestAppendChecksPrefixOnUpload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	recv := t.TempDir()
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = recv
+	config.ConfigData.ReceiveMode = ReceiveModeAppend
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.OrganizeBy = ""
+	config.ConfigData.PIN = ""
+	path := filepath.Join(recv, "log.txt")
+
+	upload := func(existing, sent, body string) (int, string) {
+		t.Helper()
+		os.WriteFile(path, []byte(existing), 0o644)
+		req := models.PrepareReceiveRequest{
+			Info:  models.Info{Alias: "peer"},
+			Files: map[string]models.FileInfo{"f": {ID: "f", FileName: "log.txt", Size: int64(len(sent + body)), FileType: "text/plain"}},
+		}
+		data, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		PrepareReceive(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data))))
+		var resp models.PrepareReceiveResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("prepare: %d", rec.Code)
+		}
+		defer CancelReceiveSession(resp.SessionID)
+
+		sum := sha256.Sum256([]byte(sent))
+		url := fmt.Sprintf("/?sessionId=%s&fileId=f&token=%s&offset=%d&offsetSha256=%s",
+			resp.SessionID, resp.Files["f"], resp.Offsets["f"].Offset, hex.EncodeToString(sum[:]))
+		rec = httptest.NewRecorder()
+		ReceiveHandler(rec, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		got, _ := os.ReadFile(path)
+		return rec.Code, string(got)
+	}
+
+	// The sender's file starts with what the receiver has
+	if code, got := upload("line1\n", "line1\n", "line2\n"); code != http.StatusOK || got != "line1\nline2\n" {
+		t.Errorf("matching prefix: %d %q", code, got)
+	}
+	// It doesn't, the existing file is left alone
+	if code, got := upload("other\n", "line1\n", "line2\n"); code != http.StatusPreconditionFailed || got != "other\n" {
+		t.Errorf("different prefix: %d %q", code, got)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/open"
+)
+
+// autoOpenTimeout bounds the command that opens a received file
+const autoOpenTimeout = 10 * time.Second
+
+// autoOpen opens a received file with the default application when --auto-open is set
+func autoOpen(filePath string, fileInfo models.FileInfo) {
+	if !config.ConfigData.AutoOpen || !matchesAutoOpenTypes(filePath, fileInfo.FileType) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), autoOpenTimeout)
+		defer cancel()
+		if err := open.Run(ctx, filePath); err != nil {
+			logger.Warnf("Failed to open %s: %v", filePath, err)
+			return
+		}
+		logger.Infof("Opened %s", filePath)
+	}()
+}
+
+// matchesAutoOpenTypes reports whether a file's MIME type is in --auto-open-types,
+// every type matches when it is empty
+func matchesAutoOpenTypes(filePath, fileType string) bool {
+	if len(config.ConfigData.AutoOpenTypes) == 0 {
+		return true
+	}
+	mimeType := fileType
+	if !strings.Contains(mimeType, "/") {
+		mimeType = mime.TypeByExtension(filepath.Ext(filePath))
+	}
+	mimeType, _, _ = strings.Cut(strings.ToLower(mimeType), ";")
+	if mimeType == "" {
+		return false
+	}
+	for _, pattern := range config.ConfigData.AutoOpenTypes {
+		if ok, _ := path.Match(strings.ToLower(strings.TrimSpace(pattern)), mimeType); ok {
+			return true
+		}
+	}
+	return false
+}
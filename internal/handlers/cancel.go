@@ -1,12 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"sync"
+	"time"
 
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/events"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 )
 
+// cancelNotifyTimeout bounds the cancel request sent to the receiver, so cancelling
+// never hangs on an unreachable peer
+const cancelNotifyTimeout = 3 * time.Second
+
 var (
 	cancelHandlers = make(map[string]func())
 	handlersLock   sync.RWMutex
@@ -26,8 +36,61 @@ func UnregisterCancelHandler(sessionID string) {
 	delete(cancelHandlers, sessionID)
 }
 
+// withCancelNotify returns a cancel function that tells the receiver at ip that the
+// session is cancelled before calling cancel, so it removes partial files instead of
+// seeing the upload connection break. Only the first call notifies.
+func withCancelNotify(ip, sessionID string, cancel func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { notifyCancel(ip, sessionID) })
+		cancel()
+	}
+}
+
+// notifyCancel sends DELETE /api/localsend/v2/cancel for sessionID to the receiver,
+// or POST /api/localsend/v1/cancel to a v1 receiver
+func notifyCancel(ip, sessionID string) {
+	client := &http.Client{
+		Timeout: cancelNotifyTimeout,
+		Transport: transport.RoundTripper(&http.Transport{
+			TLSClientConfig: peerTLSConfig(ip),
+		}),
+	}
+	method, cancelURL := http.MethodDelete, fmt.Sprintf("%s%s?sessionId=%s", peerBaseURL(ip), sessionAPIPath(sessionID, "cancel"), url.QueryEscape(sessionID))
+	if isLegacy(getOutgoingSession(sessionID).Version) {
+		// v1 cancels the sender's session
+		method, cancelURL = http.MethodPost, peerBaseURL(ip)+sessionAPIPath(sessionID, "cancel")
+	}
+	req, err := http.NewRequest(method, cancelURL, nil)
+	if err != nil {
+		logger.Debugf("Failed to create cancel request: %v", err)
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Debugf("Could not notify the receiver of the cancellation: %v", err)
+		return
+	}
+	resp.Body.Close()
+	logger.Debugf("Receiver answered %d to the cancellation of session %s", resp.StatusCode, sessionID)
+}
+
+// CancelSends cancels all running sends and returns how many there were
+func CancelSends() int {
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+	for _, cancelFunc := range cancelHandlers {
+		cancelFunc()
+	}
+	return len(cancelHandlers)
+}
+
 // HandleCancel 处理取消请求
 func HandleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		handleReceiveCancel(w, r)
+		return
+	}
 	if r.Method != "POST" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -52,3 +115,33 @@ func HandleCancel(w http.ResponseWriter, r *http.Request) {
 	cancelFunc()
 	w.WriteHeader(http.StatusOK)
 }
+
+// handleReceiveCancel cancels an incoming session (DELETE /api/localsend/v2/cancel)
+func handleReceiveCancel(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing_parameters", "Missing parameters")
+		return
+	}
+
+	switch CancelReceiveSession(sessionID) {
+	case SessionNotFound:
+		writeJSONError(w, http.StatusNotFound, "session_not_found", "Session not found")
+	case SessionAlreadyCompleted:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "session already completed"})
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// CancelReceiveSession cancels an incoming session, aborting its running uploads
+func CancelReceiveSession(sessionID string) CancelResult {
+	result := sessionManager.Cancel(sessionID)
+	if result == SessionCancelled {
+		logger.Infof("Receive session %s cancelled", sessionID)
+		events.Emit("session_cancelled", map[string]interface{}{"session_id": sessionID})
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestWithCancelNotify(t *testing.T) {
+	recv, ip := newFakeReceiver(t)
+	calls := 0
+	cancel := withCancelNotify(ip, "session", func() {
+		recv.mu.Lock()
+		notified := len(recv.cancelled)
+		recv.mu.Unlock()
+		if notified == 0 {
+			t.Error("cancelled before the receiver was notified")
+		}
+		calls++
+	})
+	cancel()
+	cancel()
+	if calls != 2 {
+		t.Errorf("cancel called %d times, want 2", calls)
+	}
+	if want := []string{"session"}; !reflect.DeepEqual(recv.cancelled, want) {
+		t.Errorf("receiver got cancellations %v, want %v", recv.cancelled, want)
+	}
+}
+
+func TestWithCancelNotifyUnreachable(t *testing.T) {
+	// A receiver that went away: its port no longer accepts connections
+	server := httptest.NewServer(http.NotFoundHandler())
+	host, portText, _ := net.SplitHostPort(server.Listener.Addr().String())
+	server.Close()
+	port, _ := strconv.Atoi(portText)
+	shared.DevicesMutex.Lock()
+	shared.DiscoveredDevices[host] = models.BroadcastMessage{Alias: "gone", Port: port, Protocol: "http"}
+	shared.DevicesMutex.Unlock()
+	defer func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, host)
+		shared.DevicesMutex.Unlock()
+	}()
+
+	called := false
+	withCancelNotify(host, "session", func() { called = true })()
+	if !called {
+		t.Error("cancel not called when the receiver is unreachable")
+	}
+}
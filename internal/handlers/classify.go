@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrNetwork is an upload that failed below HTTP: the receiver could not be reached
+// or the connection broke. Timeouts are retryable, refused connections are not.
+type ErrNetwork struct {
+	Err       error
+	Retryable bool
+}
+
+func (e *ErrNetwork) Error() string { return e.Err.Error() }
+func (e *ErrNetwork) Unwrap() error { return e.Err }
+
+// ErrProtocol is a 4xx answer of the receiver: the request is refused as it is, so
+// sending it again won't help
+type ErrProtocol struct {
+	StatusCode int
+	Err        error
+	Retryable  bool
+}
+
+func (e *ErrProtocol) Error() string { return e.Err.Error() }
+func (e *ErrProtocol) Unwrap() error { return e.Err }
+
+// ErrServer is a 5xx answer of the receiver, usually a passing failure on its side
+type ErrServer struct {
+	StatusCode int
+	Err        error
+	Retryable  bool
+}
+
+func (e *ErrServer) Error() string { return e.Err.Error() }
+func (e *ErrServer) Unwrap() error { return e.Err }
+
+// classifyError is the error classifier of uploads. It wraps err in ErrProtocol or
+// ErrServer by statusCode, the status of the receiver's answer, or in ErrNetwork
+// when it is a network error and there was no answer (statusCode 0). Other errors,
+// such as failing to read the file, are returned as they are.
+func classifyError(err error, statusCode int) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case statusCode >= 400 && statusCode < 500:
+		return &ErrProtocol{StatusCode: statusCode, Err: err, Retryable: false}
+	case statusCode == http.StatusInsufficientStorage:
+		// The receiver cancels the session when its disk is full
+		return &ErrServer{StatusCode: statusCode, Err: err, Retryable: false}
+	case statusCode >= 500:
+		return &ErrServer{StatusCode: statusCode, Err: err, Retryable: true}
+	}
+	var netErr net.Error
+	if statusCode == 0 && errors.As(err, &netErr) {
+		return &ErrNetwork{Err: err, Retryable: netErr.Timeout()}
+	}
+	return err
+}
+
+// IsRetryable reports whether err was classified as worth retrying
+func IsRetryable(err error) bool {
+	var network *ErrNetwork
+	var protocol *ErrProtocol
+	var server *ErrServer
+	switch {
+	case errors.As(err, &network):
+		return network.Retryable
+	case errors.As(err, &protocol):
+		return protocol.Retryable
+	case errors.As(err, &server):
+		return server.Retryable
+	}
+	return false
+}
+
+// uploadStatusError describes an upload answer other than 200 OK
+func uploadStatusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return fmt.Errorf("missing parameters")
+	case http.StatusForbidden:
+		return fmt.Errorf("invalid token or IP address")
+	case http.StatusNotFound:
+		return fmt.Errorf("session expired on the receiver")
+	case http.StatusConflict:
+		return errSessionBlocked
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("the receiver's file differs from the start of this one, not appending")
+	case http.StatusGone:
+		return fmt.Errorf("transfer cancelled by receiver")
+	case http.StatusInternalServerError:
+		return fmt.Errorf("unknown error by receiver")
+	case http.StatusInsufficientStorage:
+		return fmt.Errorf("receiver is out of disk space")
+	}
+	return fmt.Errorf("file upload failed: received status code %d", statusCode)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		want       interface{}
+		retryable  bool
+	}{
+		{"refused", fmt.Errorf("error sending file upload request: %w", refused), 0, &ErrNetwork{}, false},
+		{"timeout", fmt.Errorf("error sending file upload request: %w", timeoutError{}), 0, &ErrNetwork{}, true},
+		{"rejected", uploadStatusError(403), 403, &ErrProtocol{}, false},
+		{"busy", uploadStatusError(409), 409, &ErrProtocol{}, false},
+		{"server error", uploadStatusError(500), 500, &ErrServer{}, true},
+		{"unavailable", uploadStatusError(503), 503, &ErrServer{}, true},
+		{"disk full", uploadStatusError(507), 507, &ErrServer{}, false},
+		{"local", errors.New("error opening file"), 0, nil, false},
+	}
+	for _, tt := range tests {
+		err := classifyError(tt.err, tt.statusCode)
+		// Classified errors keep the message and the wrapped error
+		if err.Error() != tt.err.Error() || !errors.Is(err, tt.err) {
+			t.Errorf("%s: classified as %v", tt.name, err)
+		}
+		var network *ErrNetwork
+		var protocol *ErrProtocol
+		var server *ErrServer
+		switch tt.want.(type) {
+		case *ErrNetwork:
+			if !errors.As(err, &network) {
+				t.Errorf("%s: got %T, want ErrNetwork", tt.name, err)
+			}
+		case *ErrProtocol:
+			if !errors.As(err, &protocol) || protocol.StatusCode != tt.statusCode {
+				t.Errorf("%s: got %#v, want ErrProtocol", tt.name, err)
+			}
+		case *ErrServer:
+			if !errors.As(err, &server) || server.StatusCode != tt.statusCode {
+				t.Errorf("%s: got %#v, want ErrServer", tt.name, err)
+			}
+		default:
+			if err != tt.err {
+				t.Errorf("%s: got %T, want it unchanged", tt.name, err)
+			}
+		}
+		// sendCollected wraps upload errors again
+		if got := IsRetryable(fmt.Errorf("error uploading file: %w", err)); got != tt.retryable {
+			t.Errorf("%s: retryable %t, want %t", tt.name, got, tt.retryable)
+		}
+	}
+	if classifyError(nil, 0) != nil {
+		t.Error("nil classified")
+	}
+	if !errors.Is(classifyError(uploadStatusError(409), 409), errSessionBlocked) {
+		t.Error("409 no longer reports a blocked session")
+	}
+}
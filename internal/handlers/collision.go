@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// caseInsensitiveFS reports whether the default filesystem of this OS ignores case
+// (HFS+/APFS on macOS, NTFS on Windows)
+func caseInsensitiveFS() bool {
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// renameCaseCollisions renames files whose names differ only in case, so that
+// README.txt and readme.txt don't overwrite each other. The first file (by file ID)
+// keeps its name, later ones get _1, _2... before the extension.
+func renameCaseCollisions(files map[string]models.FileInfo) {
+	ids := make([]string, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	seen := make(map[string]string, len(files))
+	for _, id := range ids {
+		fileInfo := files[id]
+		name := fileInfo.FileName
+		if _, ok := seen[strings.ToLower(name)]; !ok {
+			seen[strings.ToLower(name)] = name
+			continue
+		}
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		renamed := name
+		for i := 1; ; i++ {
+			renamed = fmt.Sprintf("%s_%d%s", base, i, ext)
+			if _, ok := seen[strings.ToLower(renamed)]; !ok {
+				break
+			}
+		}
+		seen[strings.ToLower(renamed)] = renamed
+		logger.Warnf("%s collides with %s on this case-insensitive filesystem, saving as %s", name, seen[strings.ToLower(name)], renamed)
+		fileInfo.FileName = renamed
+		files[id] = fileInfo
+	}
+}
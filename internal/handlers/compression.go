@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings for compressed uploads
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+// supportedCompression lists the encodings this client can send and receive, preferred first
+var supportedCompression = []string{encodingZstd, encodingGzip}
+
+// incompressibleExts are formats that are already compressed
+var incompressibleExts = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true, ".opus": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".avi": true, ".webm": true,
+}
+
+// negotiateCompression picks the first encoding offered by the sender that we support
+func negotiateCompression(offered []string) string {
+	for _, theirs := range offered {
+		for _, ours := range supportedCompression {
+			if strings.EqualFold(theirs, ours) {
+				return ours
+			}
+		}
+	}
+	return ""
+}
+
+// shouldCompress reports whether compressing a file is likely to pay off
+func shouldCompress(filePath string) bool {
+	return !incompressibleExts[strings.ToLower(filepath.Ext(filePath))]
+}
+
+// newCompressor wraps w so data written to it is compressed with encoding
+func newCompressor(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingZstd:
+		return zstd.NewWriter(w)
+	case encodingGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %q", encoding)
+}
+
+// decodeBody wraps an upload body according to its Content-Encoding
+func decodeBody(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case encodingZstd:
+		dec, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case encodingGzip:
+		return gzip.NewReader(body)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// ConflictPrompt asks what to do when a received file already exists (--conflict-policy prompt)
+const ConflictPrompt = "prompt"
+
+// errFileSkipped is returned by createReceiveFile when the user chose to keep the existing file
+var errFileSkipped = errors.New("file skipped, it already exists")
+
+// conflictRequest is an upload waiting for the answer to a conflict prompt
+type conflictRequest struct {
+	session  *ReceiveSession
+	name     string
+	existing os.FileInfo
+	incoming models.FileInfo
+	answer   chan rune
+}
+
+var (
+	conflictRequests     = make(chan conflictRequest)
+	startConflictPrompts sync.Once
+)
+
+// askConflict blocks the upload until the user answered the prompt for filePath.
+// Prompts of concurrent uploads are shown one at a time.
+func askConflict(session *ReceiveSession, filePath string, existing os.FileInfo, incoming models.FileInfo) rune {
+	startConflictPrompts.Do(func() { go promptConflicts() })
+	answer := make(chan rune, 1)
+	conflictRequests <- conflictRequest{session, filepath.Base(filePath), existing, incoming, answer}
+	return <-answer
+}
+
+// promptConflicts shows the conflict prompts in order
+func promptConflicts() {
+	for request := range conflictRequests {
+		// An earlier "Apply to all" answers the rest of the session
+		answer := request.session.conflictAnswer()
+		if answer == 0 {
+			var applyToAll bool
+			terminal <- struct{}{}
+			answer, applyToAll = tui.AskConflict(request.name, request.existing, request.incoming)
+			<-terminal
+			if applyToAll {
+				request.session.setConflictAnswer(answer)
+			}
+		}
+		request.answer <- answer
+	}
+}
+
+// resolveReceiveConflict returns the path to write an incoming file to. Without
+// --conflict-policy prompt, or if nothing exists at filePath, that's filePath itself.
+func resolveReceiveConflict(session *ReceiveSession, filePath string, fileInfo models.FileInfo) (string, error) {
+	if config.ConfigData.ConflictPolicy != ConflictPrompt {
+		return filePath, nil
+	}
+	existing, err := os.Stat(filePath)
+	if err != nil || existing.IsDir() {
+		return filePath, nil
+	}
+	switch askConflict(session, filePath, existing, fileInfo) {
+	case tui.ConflictOverwrite:
+		return filePath, nil
+	case tui.ConflictRename:
+		renamed := freePath(filePath)
+		logger.Infof("%s exists, saving as %s", filePath, renamed)
+		return renamed, nil
+	default:
+		logger.Infof("Skipping %s, it already exists", filePath)
+		return "", errFileSkipped
+	}
+}
+
+// freePath returns filePath with _1, _2... before the extension, the first that doesn't exist
+func freePath(filePath string) string {
+	ext := filepath.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Lstat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+)
+
+// extendReadDeadline gives the next read of an upload server_read_timeout, so a long
+// upload only times out when it stalls
+func extendReadDeadline(rc *http.ResponseController) {
+	if timeout := config.ConfigData.ServerReadTimeout; timeout > 0 {
+		// Fails with http.ErrNotSupported over HTTP/3, which has its own idle timeout
+		rc.SetReadDeadline(time.Now().Add(timeout))
+	}
+}
+
+// deadlineWriter extends the write deadline before each write of a download, so a long
+// download only times out when the client stops reading
+type deadlineWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+// newDeadlineWriter wraps w for a download, it returns w when there is no write timeout
+func newDeadlineWriter(w http.ResponseWriter) http.ResponseWriter {
+	timeout := config.ConfigData.ServerWriteTimeout
+	if timeout <= 0 {
+		return w
+	}
+	return &deadlineWriter{ResponseWriter: w, rc: http.NewResponseController(w), timeout: timeout}
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// PrepareUploadHandler is PrepareReceive with a deadline. A request may wait for the
+// user to accept it up to acceptTimeout and for a session slot up to queue_timeout,
+// then has server_write_timeout to be answered.
+func PrepareUploadHandler() http.Handler {
+	if config.ConfigData.ServerWriteTimeout <= 0 {
+		return http.HandlerFunc(PrepareReceive)
+	}
+	timeout := acceptTimeout + config.ConfigData.QueueTimeout + config.ConfigData.ServerWriteTimeout
+	body, _ := json.Marshal(errorResponse{Error: "timeout", Message: "Request timed out"})
+	handler := http.TimeoutHandler(http.HandlerFunc(PrepareReceive), timeout, string(body))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connection's write timeout would cut off a request waiting for the user or
+		// in the queue. PrepareReceive can't extend it, the writer of http.TimeoutHandler
+		// doesn't support ResponseController.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + time.Second))
+		handler.ServeHTTP(jsonTimeoutWriter{w}, r)
+	})
+}
+
+// jsonTimeoutWriter labels the timeout response of http.TimeoutHandler as JSON. The
+// answers of the handler itself keep their Content-Type, it is copied before WriteHeader.
+type jsonTimeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (w jsonTimeoutWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w jsonTimeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
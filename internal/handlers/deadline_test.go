@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/pkg/server"
+)
+
+func TestExtendReadDeadline(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ServerReadTimeout = 200 * time.Millisecond
+
+	received := make(chan int64, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		buf := make([]byte, 16)
+		var total int64
+		for {
+			extendReadDeadline(rc)
+			n, err := r.Body.Read(buf)
+			total += int64(n)
+			if err != nil {
+				break
+			}
+		}
+		received <- total
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewHTTPServer(handler, server.Timeouts{Read: config.ConfigData.ServerReadTimeout})
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// upload sends chunks with pause between them, then stalls for stall
+	upload := func(chunks int, pause, stall time.Duration) int64 {
+		body, writer := io.Pipe()
+		go func() {
+			for range chunks {
+				writer.Write([]byte("chunk"))
+				time.Sleep(pause)
+			}
+			time.Sleep(stall)
+			writer.Close()
+		}()
+		req, _ := http.NewRequest(http.MethodPost, "http://"+ln.Addr().String(), body)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		return <-received
+	}
+
+	// Longer than the read timeout in total, but never idle for that long
+	if got := upload(6, 80*time.Millisecond, 0); got != 30 {
+		t.Errorf("slow upload: received %d bytes, want 30", got)
+	}
+	start := time.Now()
+	upload(1, 0, 2*time.Second)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stalled upload held the connection for %s", elapsed)
+	}
+}
+
+func TestPrepareUploadDeadlineCoversAcceptPrompt(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	saved := config.ConfigData
+	savedTimeout, savedPrompt := acceptTimeout, promptAccept
+	defer func() {
+		config.ConfigData = saved
+		acceptTimeout, promptAccept = savedTimeout, savedPrompt
+	}()
+	config.ConfigData.ReceiveDir = t.TempDir()
+	config.ConfigData.AutoAccept = false
+	config.ConfigData.Devices = nil
+	config.ConfigData.PIN = ""
+	config.ConfigData.QueueTimeout = 0
+	config.ConfigData.ServerWriteTimeout = 100 * time.Millisecond
+	acceptTimeout = 600 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewHTTPServer(PrepareUploadHandler(), server.Timeouts{Write: config.ConfigData.ServerWriteTimeout})
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// prepare answers the prompt after delay, or not at all when the context ends first
+	prepare := func(delay time.Duration, ignoreContext bool) *http.Response {
+		t.Helper()
+		promptAccept = func(ctx context.Context, _ models.Info, files map[string]models.FileInfo) []string {
+			if ignoreContext {
+				time.Sleep(delay)
+				return nil
+			}
+			select {
+			case <-time.After(delay):
+				return []string{"f"}
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		body, _ := json.Marshal(models.PrepareReceiveRequest{
+			Info:  models.Info{Alias: "peer"},
+			Files: map[string]models.FileInfo{"f": {ID: "f", FileName: "a.txt", Size: 1, FileType: "text/plain"}},
+		})
+		resp, err := http.Post("http://"+ln.Addr().String(), "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		return resp
+	}
+
+	// Answered after the write timeout, but within the time given to the prompt
+	resp := prepare(300*time.Millisecond, false)
+	var prepared models.PrepareReceiveResponse
+	json.NewDecoder(resp.Body).Decode(&prepared)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || prepared.Files["f"] == "" {
+		t.Errorf("accepted late: got %d %+v", resp.StatusCode, prepared)
+	}
+	CancelReceiveSession(prepared.SessionID)
+
+	// Not answered in time rejects the transfer
+	resp = prepare(time.Hour, false)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unanswered: got %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	// A prompt that outlasts the whole deadline gets the JSON timeout response
+	resp = prepare(time.Second, true)
+	var timedOut errorResponse
+	json.NewDecoder(resp.Body).Decode(&timedOut)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || timedOut.Error != "timeout" ||
+		resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("timed out: got %d %q %+v", resp.StatusCode, resp.Header.Get("Content-Type"), timedOut)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package handlers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDiskFull reports whether err means the filesystem ran out of space
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// diskFree is not implemented on this platform
+func diskFree(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package handlers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDiskFull reports whether err means the filesystem ran out of space
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// diskFree returns the bytes available to this user on the filesystem of dir
+func diskFree(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// errorResponse is the body of every error answer of the API
+type errorResponse struct {
+	Error   string `json:"error"`   // Machine-readable code, e.g. "invalid_token"
+	Message string `json:"message"` // Human-readable description
+}
+
+// writeJSONError answers with statusCode and a JSON error body instead of http.Error's plain text
+func writeJSONError(w http.ResponseWriter, statusCode int, code string, message string) {
+	h := w.Header()
+	// Drop headers meant for a successful body, as http.Error does
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{Error: code, Message: message})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// loadHashSet reads a newline-delimited file of hex SHA256 hashes. Blank lines and
+// lines starting with # are ignored; "<hash>  <name>" lines from sha256sum work too.
+func loadHashSet(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash := strings.ToLower(strings.Fields(text)[0])
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("%s:%d: not a SHA256 hash: %q", path, line, hash)
+		}
+		hashes[hash] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// excludeKnownHashes drops the files whose content is listed in --exclude-hashes
+func excludeKnownHashes(files map[string]models.FileInfo) error {
+	if config.ConfigData.ExcludeHashes == "" {
+		return nil
+	}
+	hashes, err := loadHashSet(config.ConfigData.ExcludeHashes)
+	if err != nil {
+		return fmt.Errorf("error loading excluded hashes: %w", err)
+	}
+	for id, file := range files {
+		if _, ok := hashes[strings.ToLower(file.SHA256)]; ok {
+			logger.Infof("Skipping %s: hash is in %s", file.FileName, config.ConfigData.ExcludeHashes)
+			delete(files, id)
+		}
+	}
+	return nil
+}
@@ -7,10 +7,14 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/templates"
 )
 
-const uploadDir = "./uploads"
+// uploadDir returns the directory the web file server serves
+func uploadDir() string {
+	return config.ConfigData.WebDir()
+}
 
 func GetFilesFromDir(dir string) ([]os.DirEntry, error) {
 	entries, err := os.ReadDir(dir)
@@ -22,25 +26,25 @@ func GetFilesFromDir(dir string) ([]os.DirEntry, error) {
 
 func FileServerHandler(w http.ResponseWriter, r *http.Request) {
 	file := strings.TrimPrefix(r.URL.Path, "/uploads/")
-	http.ServeFile(w, r, filepath.Join(uploadDir, file))
+	http.ServeFile(newDeadlineWriter(w), r, filepath.Join(uploadDir(), file))
 }
 
 func IndexFileHandler(w http.ResponseWriter, r *http.Request) {
-	dirPath := filepath.Join(uploadDir, strings.TrimPrefix(r.URL.Path, "/uploads/"))
+	dirPath := filepath.Join(uploadDir(), strings.TrimPrefix(r.URL.Path, "/uploads/"))
 
 	info, err := os.Stat(dirPath)
 	if os.IsNotExist(err) {
 		http.NotFound(w, r)
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
 		return
 	}
 
 	if info.IsDir() {
 		files, err := GetFilesFromDir(dirPath)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
 			return
 		}
 
@@ -55,9 +59,9 @@ func IndexFileHandler(w http.ResponseWriter, r *http.Request) {
 
 		err = tmpl.Execute(w, data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
 		}
 	} else {
-		http.ServeFile(w, r, dirPath)
+		http.ServeFile(newDeadlineWriter(w), r, dirPath)
 	}
 }
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+)
+
+func TestFileServerServesReceiveDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "report.txt"), []byte("hello"), 0o644)
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = dir
+
+	rec := httptest.NewRecorder()
+	FileServerHandler(rec, httptest.NewRequest(http.MethodGet, "/uploads/report.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFileServerServesWebUploadDir(t *testing.T) {
+	web := t.TempDir()
+	os.WriteFile(filepath.Join(web, "shared.txt"), []byte("web"), 0o644)
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = t.TempDir()
+	config.ConfigData.WebUploadDir = web
+
+	rec := httptest.NewRecorder()
+	FileServerHandler(rec, httptest.NewRequest(http.MethodGet, "/uploads/shared.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "web" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/meowrain/localsend-go/internal/config"
+)
+
+// filteredOut reports whether --exclude and --include leave out the file at rel, a
+// slash-separated path relative to the sent path. Patterns without a slash match the
+// file name at any depth, others the whole relative path. The last matching filter wins.
+func filteredOut(rel string, filters []config.PathFilter) bool {
+	excluded := false
+	for _, filter := range filters {
+		target := rel
+		if !strings.Contains(filter.Pattern, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := doublestar.Match(filter.Pattern, target); ok {
+			excluded = !filter.Include
+		}
+	}
+	return excluded
+}
+
+// ValidatePathFilter checks the syntax of an --exclude or --include pattern
+func ValidatePathFilter(pattern string) error {
+	if !doublestar.ValidatePattern(pattern) {
+		return doublestar.ErrBadPattern
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/utils/history"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// recordHistory appends a transfer to the history file unless --no-history is set
+func recordHistory(direction, peerAlias, peerIP, file string, size int64, sha string, duration time.Duration, err error) {
+	if config.ConfigData.NoHistory {
+		return
+	}
+	record := history.Record{
+		Direction:  direction,
+		PeerAlias:  peerAlias,
+		PeerIP:     peerIP,
+		File:       file,
+		Size:       size,
+		SHA256:     sha,
+		DurationMs: duration.Milliseconds(),
+		OK:         err == nil,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := history.Append(config.HistoryFile(), record); err != nil {
+		logger.Warnf("Failed to record transfer history: %v", err)
+	}
+}
+
+// peerAlias returns the announced alias of a discovered device
+func peerAlias(ip string) string {
+	shared.DevicesMutex.RLock()
+	defer shared.DevicesMutex.RUnlock()
+	return shared.DiscoveredDevices[ip].Alias
+}
+
+// remoteIP strips the port from a request's remote address
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -13,15 +13,15 @@ func GetInfoHandler(w http.ResponseWriter, r *http.Request) {
 	msg := shared.Message
 	res, err := json.Marshal(msg)
 	if err != nil {
-		logger.Errorf("json convert failed:", err)
-		http.Error(w, "json convert failed", http.StatusInternalServerError)
+		logger.Errorf("json convert failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "encode_failed", "json convert failed")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(res)
 	if err != nil {
-		http.Error(w, "Failed to write file", http.StatusInternalServerError)
-		logger.Errorf("Error writing file:", err)
+		writeJSONError(w, http.StatusInternalServerError, "write_failed", "Failed to write file")
+		logger.Errorf("Error writing file: %v", err)
 		return
 	}
 }
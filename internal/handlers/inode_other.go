@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package handlers
+
+import "os"
+
+// inode is unavailable here (e.g. Windows), visited directories are tracked by path
+func inode(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package handlers
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the inode number of a file
+func inode(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Ino), true
+}
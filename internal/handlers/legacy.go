@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Protocol v1 has no session IDs: a sender has one session at a time, its uploads
+// and cancellation belong to the session it prepared last. Senders are told apart
+// by IP only, so two v1 senders behind one NAT address share a session: the one
+// preparing last takes it over, and the uploads of the other are rejected or land
+// in the wrong session. v2 senders are unaffected.
+var (
+	legacySessions     = make(map[string]string) // Sender IP to session ID
+	legacySessionsLock sync.Mutex
+)
+
+// isLegacyRequest reports whether r came to a v1 endpoint
+func isLegacyRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiPath(legacyVersion, ""))
+}
+
+// setLegacySession records the session a v1 sender prepared last
+func setLegacySession(ip, sessionID string) {
+	legacySessionsLock.Lock()
+	defer legacySessionsLock.Unlock()
+	legacySessions[ip] = sessionID
+}
+
+// legacySession returns the session the v1 sender at ip prepared last
+func legacySession(ip string) (string, bool) {
+	legacySessionsLock.Lock()
+	defer legacySessionsLock.Unlock()
+	sessionID, ok := legacySessions[ip]
+	return sessionID, ok
+}
+
+// LegacyUploadHandler receives a file of a v1 session (POST /api/localsend/v1/send)
+func LegacyUploadHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := legacySession(remoteIP(r.RemoteAddr))
+	if !ok {
+		writeJSONError(w, http.StatusForbidden, "invalid_session", "No session from this device")
+		return
+	}
+	query := r.URL.Query()
+	query.Set("sessionId", sessionID)
+	r.URL.RawQuery = query.Encode()
+	ReceiveHandler(w, r)
+}
+
+// LegacyCancelHandler cancels the session of a v1 sender (POST /api/localsend/v1/cancel)
+func LegacyCancelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	sessionID, ok := legacySession(remoteIP(r.RemoteAddr))
+	if !ok || CancelReceiveSession(sessionID) == SessionNotFound {
+		writeJSONError(w, http.StatusNotFound, "session_not_found", "Session not found")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
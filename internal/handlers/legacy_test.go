@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// A receiver that only serves v1, like older LocalSend apps, gets the files after
+// the v2 prepare request is not found
+func TestSendFallsBackToLegacy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	recv := t.TempDir()
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = recv
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.AllowFrom = nil
+	config.ConfigData.Devices = nil
+	config.ConfigData.OrganizeBy = ""
+	config.ConfigData.PIN = ""
+	config.ConfigData.SendTo = "127.0.0.1"
+
+	var legacyRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/localsend/v1/send-request", func(w http.ResponseWriter, r *http.Request) {
+		legacyRequests.Add(1)
+		PrepareReceive(w, r)
+	})
+	mux.HandleFunc("/api/localsend/v1/send", LegacyUploadHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	_, portText, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	shared.DevicesMutex.Lock()
+	shared.DiscoveredDevices["127.0.0.1"] = models.BroadcastMessage{Alias: "old", Port: port, Protocol: "http"}
+	shared.DevicesMutex.Unlock()
+	defer func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, "127.0.0.1")
+		shared.DevicesMutex.Unlock()
+	}()
+
+	path := filepath.Join(t.TempDir(), "note.txt")
+	os.WriteFile(path, []byte("hello"), 0o644)
+	if _, err := SendFilesTo("127.0.0.1", []string{path}); err != nil {
+		t.Fatal(err)
+	}
+	if n := legacyRequests.Load(); n != 1 {
+		t.Errorf("%d v1 prepare requests", n)
+	}
+	if got, _ := os.ReadFile(filepath.Join(recv, "note.txt")); string(got) != "hello" {
+		t.Errorf("received %q", got)
+	}
+}
+
+// A sender offering only v1 on the v2 endpoint is rejected, not given a v1 session
+// in a v2 response
+func TestPrepareRejectsLegacyOnV2Endpoint(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = t.TempDir()
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.AllowFrom = nil
+	config.ConfigData.PIN = ""
+
+	req := models.PrepareReceiveRequest{
+		Info:              models.Info{Alias: "old"},
+		Files:             map[string]models.FileInfo{"f": {ID: "f", FileName: "a.txt", Size: 1, FileType: "text/plain"}},
+		SupportedVersions: []string{"1.0"},
+	}
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	PrepareReceive(rec, httptest.NewRequest(http.MethodPost, apiPath(defaultVersion, "prepare-upload"), bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unsupported_version") {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+	if _, ok := legacySession("192.0.2.1"); ok {
+		t.Error("v1 session recorded")
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/utils/events"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// loadManifest reads a sha256sum style manifest, "<sha256>  <file name>" per line,
+// and returns the hashes by file name. Binary mode lines ("<sha256> *<name>") work too.
+func loadManifest(manifestPath string) (map[string]string, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, name, ok := strings.Cut(text, " ")
+		if b, err := hex.DecodeString(hash); !ok || err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("%s:%d: expected \"<sha256>  <file name>\"", manifestPath, line)
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		entries[path.Clean(strings.ReplaceAll(name, "\\", "/"))] = strings.ToLower(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// verifyManifest checks the files of a completed session against the manifest and
+// logs every file whose hash differs or that the manifest doesn't list. It returns
+// the names of those files.
+func verifyManifest(session *ReceiveSession, manifestPath string) []string {
+	entries, err := loadManifest(manifestPath)
+	if err != nil {
+		logger.Errorf("Failed to read manifest: %v", err)
+		events.Emit("manifest_error", map[string]interface{}{"session": session.ID, "message": err.Error()})
+		return nil
+	}
+
+	var mismatches []string
+	for id, fileInfo := range session.Files {
+		if !session.Received[id] {
+			continue
+		}
+		name := path.Clean(fileInfo.FileName)
+		expected, listed := entries[name]
+		switch actual := session.Sums[id]; {
+		case !listed:
+			logger.Errorf("Manifest check failed: %s is not listed in %s", name, manifestPath)
+		case !strings.EqualFold(expected, actual):
+			logger.Errorf("Manifest check failed: %s has SHA256 %s, manifest says %s", name, actual, expected)
+		default:
+			continue
+		}
+		mismatches = append(mismatches, name)
+	}
+	sort.Strings(mismatches)
+
+	if len(mismatches) == 0 {
+		logger.Successf("All %d file(s) from %s match %s", len(session.Received), session.Sender.Alias, manifestPath)
+	}
+	events.Emit("manifest_verified", map[string]interface{}{
+		"session":    session.ID,
+		"ok":         len(mismatches) == 0,
+		"mismatches": mismatches,
+	})
+	return mismatches
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// Layouts of the receive directory selectable with --organize-by
+const (
+	OrganizeBySender = "sender"
+	OrganizeByDate   = "date"
+	OrganizeByType   = "type"
+)
+
+// organizedDir returns the directory a session is received into: dir itself, or a
+// subdirectory per sender (uploads/Alice) or per day (uploads/2024/01/15)
+func organizedDir(dir, organizeBy string, sender models.Info, now time.Time) string {
+	switch organizeBy {
+	case OrganizeBySender:
+		return filepath.Join(dir, senderDirName(sender.Alias))
+	case OrganizeByDate:
+		return filepath.Join(dir, now.Format("2006"), now.Format("01"), now.Format("02"))
+	}
+	return dir
+}
+
+// organizedFileName prefixes a file name with its type directory with --organize-by type,
+// e.g. images/photo.jpg
+func organizedFileName(organizeBy string, file models.FileInfo) string {
+	if organizeBy != OrganizeByType {
+		return file.FileName
+	}
+	return typeDirName(file) + "/" + file.FileName
+}
+
+// senderDirName turns a sender alias into a single, safe path element
+func senderDirName(alias string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(alias))
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// typeDirName returns the directory of a file type: images, videos, audio, documents,
+// archives or other
+func typeDirName(file models.FileInfo) string {
+	mimeType := mime.TypeByExtension(path.Ext(file.FileName))
+	if mimeType == "" && strings.Contains(file.FileType, "/") {
+		mimeType = file.FileType
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "images"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "videos"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "text/"), mimeType == "application/pdf",
+		strings.Contains(mimeType, "document"), strings.Contains(mimeType, "msword"),
+		strings.Contains(mimeType, "spreadsheet"), strings.Contains(mimeType, "presentation"):
+		return "documents"
+	case strings.Contains(mimeType, "zip"), strings.Contains(mimeType, "tar"),
+		strings.Contains(mimeType, "compressed"), mimeType == "application/gzip":
+		return "archives"
+	}
+	return "other"
+}
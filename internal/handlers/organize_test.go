@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestOrganizedDir(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		organizeBy string
+		alias      string
+		want       string
+	}{
+		{"", "Alice", "uploads"},
+		{OrganizeBySender, "Alice", filepath.Join("uploads", "Alice")},
+		{OrganizeBySender, "..", filepath.Join("uploads", "unknown")},
+		{OrganizeBySender, "a/b", filepath.Join("uploads", "a_b")},
+		{OrganizeByDate, "Alice", filepath.Join("uploads", "2024", "01", "15")},
+		{OrganizeByType, "Alice", "uploads"},
+	}
+	for _, tt := range tests {
+		got := organizedDir("uploads", tt.organizeBy, models.Info{Alias: tt.alias}, now)
+		if got != tt.want {
+			t.Errorf("organizedDir(%q, %q) = %q, want %q", tt.organizeBy, tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestSenderDirName(t *testing.T) {
+	tests := []struct {
+		alias string
+		want  string
+	}{
+		{"Alice", "Alice"},
+		{"  Alice  ", "Alice"},
+		{"..", "unknown"},
+		{".", "unknown"},
+		{"", "unknown"},
+		{"a/b", "a_b"},
+		{`a\b`, "a_b"},
+		{"C:", "C_"},
+		{"who?*", "who__"},
+		{"a\x00b\tc\x1b", "abc"},
+		{"..hidden.", "hidden"},
+	}
+	for _, tt := range tests {
+		if got := senderDirName(tt.alias); got != tt.want {
+			t.Errorf("senderDirName(%q) = %q, want %q", tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestTypeDirName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		fileType string
+		want     string
+	}{
+		{"photo.jpg", "", "images"},
+		{"photo.png", "application/octet-stream", "images"},
+		{"report.pdf", "", "documents"},
+		{"page.html", "", "documents"},
+		{"clip", "video/mp4", "videos"},
+		{"song", "audio/mpeg", "audio"},
+		{"notes", "text/plain; charset=utf-8", "documents"},
+		{"letter", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "documents"},
+		{"letter", "application/msword", "documents"},
+		{"backup", "application/zip", "archives"},
+		{"backup", "application/x-tar", "archives"},
+		{"backup", "application/gzip", "archives"},
+		{"backup", "application/x-7z-compressed", "archives"},
+		{"blob", "application/octet-stream", "other"},
+		{"blob", "image", "other"},
+		{"blob", "", "other"},
+	}
+	for _, tt := range tests {
+		file := models.FileInfo{FileName: tt.fileName, FileType: tt.fileType}
+		if got := typeDirName(file); got != tt.want {
+			t.Errorf("typeDirName(%q, %q) = %q, want %q", tt.fileName, tt.fileType, got, tt.want)
+		}
+	}
+}
+
+func TestOrganizedFileName(t *testing.T) {
+	file := models.FileInfo{FileName: "photo.jpg"}
+	if got := organizedFileName(OrganizeByType, file); got != "images/photo.jpg" {
+		t.Errorf("organizedFileName(type) = %q, want images/photo.jpg", got)
+	}
+	if got := organizedFileName(OrganizeBySender, file); got != "photo.jpg" {
+		t.Errorf("organizedFileName(sender) = %q, want photo.jpg", got)
+	}
+}
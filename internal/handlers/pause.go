@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/meowrain/localsend-go/internal/utils/events"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+var (
+	pauseMu sync.Mutex
+	paused  chan struct{} // Set while transfers are paused, closed on resume
+)
+
+// PauseTransfers holds all uploads and downloads until ResumeTransfers. Senders stop
+// writing, receivers stop reading, so TCP backpressure stalls the other side.
+// It reports whether transfers were running.
+func PauseTransfers() bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if paused != nil {
+		return false
+	}
+	paused = make(chan struct{})
+	logger.Info("Transfers paused")
+	events.Emit("transfers_paused", nil)
+	return true
+}
+
+// ResumeTransfers continues transfers held by PauseTransfers. It reports whether
+// transfers were paused.
+func ResumeTransfers() bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if paused == nil {
+		return false
+	}
+	close(paused)
+	paused = nil
+	logger.Info("Transfers resumed")
+	events.Emit("transfers_resumed", nil)
+	return true
+}
+
+// TransfersPaused reports whether transfers are paused
+func TransfersPaused() bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return paused != nil
+}
+
+// waitIfPaused blocks while transfers are paused, or until ctx is done
+func waitIfPaused(ctx context.Context) error {
+	pauseMu.Lock()
+	wait := paused
+	pauseMu.Unlock()
+	if wait == nil {
+		return nil
+	}
+	select {
+	case <-wait:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pauseWriter holds each write while transfers are paused
+type pauseWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (p pauseWriter) Write(b []byte) (int, error) {
+	if err := waitIfPaused(p.ctx); err != nil {
+		return 0, err
+	}
+	return p.w.Write(b)
+}
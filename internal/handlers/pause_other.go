@@ -0,0 +1,7 @@
+//go:build !unix
+
+package handlers
+
+// WatchPauseSignals does nothing, SIGUSR1 and SIGUSR2 only exist on Unix; use the
+// admin API to pause transfers
+func WatchPauseSignals() {}
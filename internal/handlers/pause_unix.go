@@ -0,0 +1,24 @@
+//go:build unix
+
+package handlers
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchPauseSignals pauses transfers on SIGUSR1 and resumes them on SIGUSR2
+func WatchPauseSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				PauseTransfers()
+			} else {
+				ResumeTransfers()
+			}
+		}
+	}()
+}
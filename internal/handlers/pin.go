@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// Wrong PINs a sender IP may try before it is locked out for pinLockout
+const (
+	maxPINAttempts = 5
+	pinLockout     = time.Minute
+)
+
+// pinFailures counts the wrong PINs of each sender IP
+var pinFailures = struct {
+	sync.Mutex
+	m map[string]pinFailure
+}{m: make(map[string]pinFailure)}
+
+type pinFailure struct {
+	count int
+	last  time.Time
+}
+
+// checkPIN enforces the configured PIN on a prepare request from alias. It answers
+// 401 and returns false when the pin query parameter is missing or wrong, and 429
+// after maxPINAttempts wrong PINs until pinLockout has passed.
+func checkPIN(w http.ResponseWriter, r *http.Request, alias string) bool {
+	pin := config.ConfigData.PIN
+	if pin == "" {
+		return true
+	}
+	ip := remoteIP(r.RemoteAddr)
+	now := time.Now()
+
+	pinFailures.Lock()
+	defer pinFailures.Unlock()
+	failure := pinFailures.m[ip]
+	if now.Sub(failure.last) > pinLockout {
+		failure = pinFailure{}
+	}
+	if failure.count >= maxPINAttempts {
+		w.Header().Set("Retry-After", strconv.Itoa(int((pinLockout-now.Sub(failure.last)).Seconds())+1))
+		writeJSONError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many wrong PINs")
+		return false
+	}
+
+	given := r.URL.Query().Get("pin")
+	if given == "" {
+		logger.Infof("Asked %s for the PIN", alias)
+		writeJSONError(w, http.StatusUnauthorized, "pin_required", "PIN required")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(pin)) != 1 {
+		for other, old := range pinFailures.m {
+			if now.Sub(old.last) > pinLockout {
+				delete(pinFailures.m, other)
+			}
+		}
+		pinFailures.m[ip] = pinFailure{count: failure.count + 1, last: now}
+		logger.Warnf("Rejected request from %s (%s): wrong PIN", alias, ip)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_pin", "Invalid PIN")
+		return false
+	}
+	delete(pinFailures.m, ip)
+	return true
+}
+
+// errPINRequired is returned when a receiver requires a PIN and none was entered
+var errPINRequired = errors.New("the receiver requires a PIN, pass it with --send-pin")
+
+// errPINLockedOut is returned when a receiver locked this sender out after too many
+// wrong PINs
+var errPINLockedOut = errors.New("locked out after too many wrong PINs")
+
+// lockedOut returns errPINLockedOut with how long the receiver's Retry-After header
+// asks to wait
+func lockedOut(resp *http.Response) error {
+	wait := pinLockout
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+	return fmt.Errorf("%w, retry in %s", errPINLockedOut, wait)
+}
+
+// peerPINs are the PINs receivers accepted, by IP, so later sessions to the same
+// receiver don't ask again
+var peerPINs = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// peerPIN returns the PIN to send to ip: the one it accepted before, or --send-pin
+func peerPIN(ip string) string {
+	peerPINs.Lock()
+	defer peerPINs.Unlock()
+	if pin, ok := peerPINs.m[ip]; ok {
+		return pin
+	}
+	return config.ConfigData.SendPIN
+}
+
+// rememberPeerPIN records a PIN ip accepted
+func rememberPeerPIN(ip, pin string) {
+	if pin == "" {
+		return
+	}
+	peerPINs.Lock()
+	defer peerPINs.Unlock()
+	peerPINs.m[ip] = pin
+}
+
+// askPeerPIN asks for the PIN of the receiver at ip, after a wrong one when wrong is
+// set. It fails with errPINRequired when nothing was entered or there is no terminal.
+func askPeerPIN(ip string, wrong bool) (string, error) {
+	name := peerAlias(ip)
+	if name == "" {
+		name = ip
+	}
+	question := fmt.Sprintf("%s requires a PIN:", name)
+	if wrong {
+		question = "Wrong PIN, try again:"
+	}
+	if !interactive() {
+		return "", errPINRequired
+	}
+	pin, ok := tui.AskPIN(question)
+	if !ok {
+		return "", errPINRequired
+	}
+	return pin, nil
+}
+
+// pinURL adds pin to the query of a prepare request URL
+func pinURL(rawURL, pin string) string {
+	if pin == "" {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set("pin", pin)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestCheckPIN(t *testing.T) {
+	saved := config.ConfigData.PIN
+	defer func() { config.ConfigData.PIN = saved }()
+
+	check := func(remote, query string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/localsend/v2/prepare-upload"+query, nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		if checkPIN(rec, req, "sender") {
+			return http.StatusOK
+		}
+		return rec.Code
+	}
+
+	config.ConfigData.PIN = ""
+	if code := check("192.168.1.5:4000", ""); code != http.StatusOK {
+		t.Errorf("no PIN configured: got %d", code)
+	}
+
+	config.ConfigData.PIN = "4821"
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"?pin=0000", http.StatusUnauthorized},
+		{"?pin=4821", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := check("192.168.1.5:4000", tt.query); code != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.query, code, tt.want)
+		}
+	}
+
+	// Wrong PINs lock the sender out, even for the right one, but not other senders
+	for i := 0; i < maxPINAttempts; i++ {
+		check("192.168.1.6:4000", "?pin=0000")
+	}
+	if code := check("192.168.1.6:4000", "?pin=4821"); code != http.StatusTooManyRequests {
+		t.Errorf("after %d wrong PINs: got %d, want %d", maxPINAttempts, code, http.StatusTooManyRequests)
+	}
+	if code := check("192.168.1.7:4000", "?pin=4821"); code != http.StatusOK {
+		t.Errorf("other sender: got %d", code)
+	}
+}
+
+func TestPINURL(t *testing.T) {
+	tests := []struct {
+		url, pin, want string
+	}{
+		{"http://10.0.0.2:53317/api/localsend/v2/prepare-upload", "", "http://10.0.0.2:53317/api/localsend/v2/prepare-upload"},
+		{"http://10.0.0.2:53317/api/localsend/v2/prepare-upload", "48 21&x", "http://10.0.0.2:53317/api/localsend/v2/prepare-upload?pin=48+21%26x"},
+		{"http://10.0.0.2:53317/api/localsend/v1/send-request?a=1", "4821", "http://10.0.0.2:53317/api/localsend/v1/send-request?a=1&pin=4821"},
+	}
+	for _, tt := range tests {
+		if got := pinURL(tt.url, tt.pin); got != tt.want {
+			t.Errorf("pinURL(%q, %q) = %q, want %q", tt.url, tt.pin, got, tt.want)
+		}
+	}
+}
+
+// A receiver that locked the sender out is not asked again, the error says how long to wait
+func TestPrepareLockedOut(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.SendPIN = "0000"
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "42")
+		writeJSONError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many wrong PINs")
+	}))
+	defer server.Close()
+	_, portText, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	shared.DevicesMutex.Lock()
+	shared.DiscoveredDevices["127.0.0.1"] = models.BroadcastMessage{Alias: "locked", Port: port, Protocol: "http"}
+	shared.DevicesMutex.Unlock()
+	defer func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, "127.0.0.1")
+		shared.DevicesMutex.Unlock()
+	}()
+
+	files := map[string]models.FileInfo{"f": {ID: "f", FileName: "a.txt", Size: 1}}
+	_, err := SendFileToOtherDevicePrepare("127.0.0.1", files)
+	if !errors.Is(err, errPINLockedOut) || !strings.Contains(err.Error(), "retry in 42s") {
+		t.Fatalf("got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d prepare requests", n)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const pingInterval = 30 * time.Second
+
+// PingHandler reports whether a receive session is still active
+func PingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing_parameters", "Missing parameters")
+		return
+	}
+
+	session, ok := sessionManager.Get(sessionID)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "session_not_found", "Session not found")
+		return
+	}
+	session.Touch()
+	w.WriteHeader(http.StatusOK)
+}
+
+// startSessionPinger pings the receiver periodically to keep the connection alive
+// while the session is idle. The returned function stops the pinger.
+func startSessionPinger(ip, sessionID string) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	pingURL := fmt.Sprintf("%s%s?sessionId=%s", peerBaseURL(ip), sessionAPIPath(sessionID, "ping"), sessionID)
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: transport.RoundTripper(&http.Transport{
+			TLSClientConfig: peerTLSConfig(ip),
+		}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, pingURL, nil)
+				if err != nil {
+					logger.Debugf("Failed to create ping request: %v", err)
+					continue
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					logger.Debugf("Session ping failed: %v", err)
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusNotFound {
+					logger.Debugf("Session %s no longer exists on receiver", sessionID)
+					return
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
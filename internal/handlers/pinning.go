@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/certificate"
+	"github.com/meowrain/localsend-go/internal/utils/knowndevices"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// errCertificateMismatch is returned when a peer's certificate is not the one its
+// fingerprint stands for
+var errCertificateMismatch = errors.New("certificate does not match the device fingerprint")
+
+// peerTLSConfig returns the TLS config of connections to ip. LocalSend certificates
+// are self-signed, so instead of a CA the certificate must match the fingerprint ip
+// announced and the one remembered of the device.
+func peerTLSConfig(ip string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true, // Verified by fingerprint in VerifyConnection
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return verifyPeerCertificate(ip, state)
+		},
+	}
+}
+
+// verifyPeerCertificate checks the certificate of ip against the known devices and the
+// fingerprint ip announced. Announcements arrive unauthenticated over multicast, so
+// the known devices are checked first, whatever the announcement says:
+//   - a remembered certificate is the device it was remembered for, wherever it is now
+//   - otherwise a device announcing a remembered fingerprint, or at the address a
+//     device was last seen at, is rejected
+//   - otherwise an announced certificate fingerprint must match
+//
+// A certificate that passes is remembered on first use.
+func verifyPeerCertificate(ip string, state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: %s sent no certificate", errCertificateMismatch, ip)
+	}
+	got := certificate.Fingerprint(state.PeerCertificates[0].Raw)
+
+	shared.DevicesMutex.RLock()
+	device := shared.DiscoveredDevices[ip]
+	shared.DevicesMutex.RUnlock()
+	path := config.KnownDevicesFile()
+	remember := func() error {
+		added, err := knowndevices.Remember(path, knowndevices.Device{
+			Fingerprint: got,
+			Alias:       device.Alias,
+			Address:     ip,
+			QUIC:        config.ConfigData.Transport == transport.QUIC,
+		})
+		if err != nil {
+			logger.Warnf("Failed to remember the certificate of %s: %v", ip, err)
+		} else if added {
+			logger.Infof("Remembered the certificate of %s at %s (%s)", device.Alias, ip, got)
+		}
+		return nil
+	}
+
+	if _, ok, err := knowndevices.Find(path, got); err != nil {
+		logger.Warnf("Failed to read the known devices: %v", err)
+	} else if ok {
+		return remember()
+	}
+	if device.Fingerprint != "" {
+		if known, ok, _ := knowndevices.Find(path, device.Fingerprint); ok {
+			return fmt.Errorf("%w: %s announces the fingerprint of %s but presents %s",
+				errCertificateMismatch, ip, known.Alias, got)
+		}
+	}
+	if known, ok, _ := knowndevices.FindAddress(path, ip); ok {
+		return fmt.Errorf("%w: %s presents %s, not the certificate of %s first seen on %s. If the device was reinstalled or the address belongs to another device now, remove it from %s",
+			errCertificateMismatch, ip, got, known.Alias, known.FirstSeen.Format("2006-01-02"), path)
+	}
+
+	// Only https peers announce the certificate fingerprint, http ones a random ID,
+	// except localsend-go peers in QUIC mode that announce their HTTP/3 certificate.
+	// Without one, e.g. for an IP --to that was never discovered, the certificate is
+	// trusted on first use.
+	announced := device.Protocol == "https" || config.ConfigData.Transport == transport.QUIC
+	if announced && device.Fingerprint != "" && !strings.EqualFold(device.Fingerprint, got) {
+		return fmt.Errorf("%w: %s announced %s but presents %s", errCertificateMismatch, ip, device.Fingerprint, got)
+	}
+	return remember()
+}
+
+// knownOverHTTPS reports whether the device announcing fingerprint at ip, or the
+// device last seen at ip, was verified over https before. Such a device is only
+// connected to over https, so an announcement can't downgrade it to plain http.
+func knownOverHTTPS(ip, fingerprint string) bool {
+	path := config.KnownDevicesFile()
+	if fingerprint != "" {
+		if known, ok, _ := knowndevices.Find(path, fingerprint); ok && !known.QUIC {
+			return true
+		}
+	}
+	known, ok, _ := knowndevices.FindAddress(path, ip)
+	return ok && !known.QUIC
+}
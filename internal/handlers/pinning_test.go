@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/certificate"
+	"github.com/meowrain/localsend-go/internal/utils/knowndevices"
+)
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	const ip = "127.0.0.1"
+	defer func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, ip)
+		shared.DevicesMutex.Unlock()
+	}()
+	// Each server has its own certificate, like two LocalSend devices
+	newServer := func() *httptest.Server {
+		cert, err := certificate.GenerateSelfSigned("peer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	first, second := newServer(), newServer()
+	fingerprint := func(server *httptest.Server) string {
+		return certificate.Fingerprint(server.TLS.Certificates[0].Certificate[0])
+	}
+
+	// get connects to server as the device discovered at ip, or undiscovered with announced nil
+	get := func(server *httptest.Server, ip string, announced *models.BroadcastMessage) error {
+		shared.DevicesMutex.Lock()
+		if announced != nil {
+			shared.DiscoveredDevices[ip] = *announced
+		} else {
+			delete(shared.DiscoveredDevices, ip)
+		}
+		shared.DevicesMutex.Unlock()
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: peerTLSConfig(ip)}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(first, ip, &models.BroadcastMessage{Alias: "phone", Protocol: "https", Fingerprint: "00ff"}); !errors.Is(err, errCertificateMismatch) {
+		t.Errorf("wrong fingerprint: got %v", err)
+	}
+	if err := get(first, ip, &models.BroadcastMessage{Alias: "phone", Protocol: "https", Fingerprint: fingerprint(first)}); err != nil {
+		t.Errorf("matching fingerprint: %v", err)
+	}
+	// The remembered certificate is the device, whatever is announced now
+	if err := get(first, ip, &models.BroadcastMessage{Alias: "renamed", Protocol: "http", Fingerprint: "random"}); err != nil {
+		t.Errorf("known certificate: %v", err)
+	}
+	// Another certificate at its address, even announced correctly, is not the device seen there
+	if err := get(second, ip, &models.BroadcastMessage{Alias: "phone", Protocol: "https", Fingerprint: fingerprint(second)}); !errors.Is(err, errCertificateMismatch) {
+		t.Errorf("changed certificate: got %v", err)
+	}
+	// Nor is another certificate announcing its fingerprint elsewhere
+	if err := get(second, "10.0.0.9", &models.BroadcastMessage{Alias: "phone", Protocol: "http", Fingerprint: fingerprint(first)}); !errors.Is(err, errCertificateMismatch) {
+		t.Errorf("spoofed fingerprint: got %v", err)
+	}
+	// An undiscovered address is trusted on first use, and checked from then on
+	if err := get(second, "10.0.0.7", nil); err != nil {
+		t.Errorf("undiscovered: %v", err)
+	}
+	if err := get(newServer(), "10.0.0.7", nil); !errors.Is(err, errCertificateMismatch) {
+		t.Errorf("undiscovered, changed certificate: got %v", err)
+	}
+	// Two devices may share an alias
+	if err := get(newServer(), "10.0.0.8", &models.BroadcastMessage{Alias: "phone", Protocol: "https"}); err != nil {
+		t.Errorf("same alias: %v", err)
+	}
+}
+
+// A device verified over https can't be downgraded to http by an announcement
+func TestPeerBaseURLKeepsHTTPS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.Relay = ""
+	config.ConfigData.Transport = transport.TCP
+	const ip = "10.0.0.2"
+	defer func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, ip)
+		shared.DevicesMutex.Unlock()
+	}()
+	shared.DevicesMutex.Lock()
+	shared.DiscoveredDevices[ip] = models.BroadcastMessage{Alias: "phone", Port: 53317, Protocol: "http", Fingerprint: "random"}
+	shared.DevicesMutex.Unlock()
+
+	if got := peerBaseURL(ip); got != "http://10.0.0.2:53317" {
+		t.Errorf("unknown device: %s", got)
+	}
+	knowndevices.Remember(config.KnownDevicesFile(), knowndevices.Device{Fingerprint: "00ff", Alias: "phone", Address: ip})
+	if got := peerBaseURL(ip); got != "https://10.0.0.2:53317" {
+		t.Errorf("known device: %s", got)
+	}
+}
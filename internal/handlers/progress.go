@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/events"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/progress"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// DefaultJSONProgressInterval is the progress interval in JSON mode when --progress-interval is not given
+const DefaultJSONProgressInterval = 10 * time.Second
+
+// progressEnabled reports whether progress bars should be rendered
+func progressEnabled() bool {
+	return !config.ConfigData.Quiet && !config.ConfigData.JSON && !config.ConfigData.NoProgress
+}
+
+// progressBar is the bar of one transfer, closed when the transfer ends
+type progressBar interface {
+	io.Writer
+	Add(n int) error
+	Close() error
+}
+
+// plainBar is a bar drawn on its own, when stderr is not a terminal
+type plainBar struct {
+	*progressbar.ProgressBar
+}
+
+// Close leaves the bar as it is, it clears itself when complete
+func (plainBar) Close() error {
+	return nil
+}
+
+var (
+	barsOnce sync.Once
+	bars     *progress.Manager // Draws the bars of concurrent transfers on a terminal
+)
+
+// newProgressBar creates the transfer progress bar, or a silent one when output is
+// suppressed. On a terminal, the bars of concurrent transfers are drawn together,
+// one line each.
+func newProgressBar(size int64, description string) progressBar {
+	if !progressEnabled() {
+		return plainBar{progressbar.DefaultBytesSilent(size, description)}
+	}
+	if fd := int(os.Stderr.Fd()); term.IsTerminal(fd) {
+		barsOnce.Do(func() {
+			width, _, _ := term.GetSize(fd)
+			bars = progress.NewManager(os.Stderr, width, progress.DefaultInterval)
+			if term.IsTerminal(int(os.Stdout.Fd())) {
+				// Log messages go to stdout, print them above the bars
+				logger.SetOutput(bars.Writer(os.Stdout))
+			}
+		})
+		return bars.NewBar(size, description)
+	}
+	return plainBar{progressbar.NewOptions64(
+		size,
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionThrottle(time.Second), // Reduce refresh rate to reduce flickering
+		progressbar.OptionShowCount(),
+		progressbar.OptionClearOnFinish(), // Clear progress bar on finish
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionSetPredictTime(true), // Predict remaining time
+		progressbar.OptionFullWidth(),          // Use full width display
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "█", // Use solid block
+			SaucerHead:    "█",
+			SaucerPadding: "░", // Use gray block as background
+			BarStart:      "|",
+			BarEnd:        "|",
+		}),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, "\n")
+		}),
+	)}
+}
+
+// batchProgress is the overall progress of a send of several files, shown above the
+// bar of each file
+type batchProgress struct {
+	filesDone, filesTotal int
+	bytesDone, bytesTotal int64
+}
+
+// newBatchProgress counts the entries that will be uploaded
+func newBatchProgress(files map[string]models.FileInfo, entries []sendEntry) *batchProgress {
+	b := &batchProgress{}
+	for _, entry := range entries {
+		if _, ok := files[entry.ID]; ok {
+			b.filesTotal++
+			b.bytesTotal += entry.Size
+		}
+	}
+	return b
+}
+
+// fileDone counts an uploaded file and reports the new state
+func (b *batchProgress) fileDone(size int64) {
+	b.filesDone++
+	b.bytesDone += size
+	b.report()
+}
+
+// report prints the batch line, or emits a batch_progress event in JSON mode. Single
+// files have only their own bar.
+func (b *batchProgress) report() {
+	if b.filesTotal < 2 {
+		return
+	}
+	if events.Enabled() {
+		events.Emit("batch_progress", map[string]interface{}{
+			"files_done":  b.filesDone,
+			"files_total": b.filesTotal,
+			"bytes_done":  b.bytesDone,
+			"bytes_total": b.bytesTotal,
+		})
+		return
+	}
+	if progressEnabled() {
+		fmt.Fprintf(os.Stderr, "Uploading %d/%d files (%s of %s)\n",
+			b.filesDone, b.filesTotal, tui.FormatSize(b.bytesDone), tui.FormatSize(b.bytesTotal))
+	}
+}
+
+// progressInterval returns how often to log transfer progress, 0 when disabled
+func progressInterval() time.Duration {
+	return max(config.ConfigData.ProgressInterval, 0)
+}
+
+// progressCounter counts the bytes written through it
+type progressCounter struct {
+	done atomic.Int64
+}
+
+func (c *progressCounter) Write(p []byte) (int, error) {
+	c.done.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// startProgressLogger periodically logs the progress of a transfer of total bytes.
+// Bytes must be written to the returned writer; the returned function stops logging.
+func startProgressLogger(file string, total int64) (io.Writer, func()) {
+	interval := progressInterval()
+	if interval <= 0 {
+		return io.Discard, func() {}
+	}
+
+	counter := &progressCounter{}
+	stop := make(chan struct{})
+	start := time.Now()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				logProgress(file, counter.done.Load(), total, time.Since(start))
+			}
+		}
+	}()
+
+	var once atomic.Bool
+	return counter, func() {
+		if once.CompareAndSwap(false, true) {
+			close(stop)
+		}
+	}
+}
+
+// logProgress emits one progress event, or a line on stderr outside JSON mode. The
+// line is printed even with --quiet, progress was asked for explicitly.
+func logProgress(file string, done, total int64, elapsed time.Duration) {
+	var percent, speedMbps float64
+	if total > 0 {
+		percent = math.Round(float64(done)/float64(total)*1000) / 10
+	}
+	var eta int64
+	if seconds := elapsed.Seconds(); seconds > 0 && done > 0 {
+		bytesPerSecond := float64(done) / seconds
+		speedMbps = math.Round(bytesPerSecond*8/1e5) / 10
+		eta = int64(math.Round(float64(total-done) / bytesPerSecond))
+	}
+
+	if events.Enabled() {
+		events.Emit("progress", map[string]interface{}{
+			"file":        filepath.Base(file),
+			"bytes_done":  done,
+			"bytes_total": total,
+			"percent":     percent,
+			"speed_mbps":  speedMbps,
+			"eta_seconds": eta,
+		})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %.1f%% (%d/%d bytes, %.1f Mbps, %ds left)\n",
+		filepath.Base(file), percent, done, total, speedMbps, eta)
+}
+
+// ProgressHandler reports the progress of a receive session
+func ProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing_parameters", "Missing parameters")
+		return
+	}
+	session, ok := sessionManager.Lookup(sessionID)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "session_not_found", "Session not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.Progress())
+}
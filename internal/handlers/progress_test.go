@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/events"
+)
+
+func TestBatchProgressEvents(t *testing.T) {
+	var out bytes.Buffer
+	events.SetOutput(&out)
+	events.Enable(true)
+	defer events.Enable(false)
+	defer events.SetOutput(os.Stdout)
+
+	files := map[string]models.FileInfo{"a": {}, "b": {}}
+	// c was excluded from the session, it is not part of the batch
+	entries := []sendEntry{{ID: "a", Size: 10}, {ID: "b", Size: 30}, {ID: "c", Size: 50}}
+	batch := newBatchProgress(files, entries)
+	batch.report()
+	batch.fileDone(10)
+
+	var got []map[string]interface{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var event map[string]interface{}
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, event)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	last := got[1]
+	if last["event"] != "batch_progress" || last["files_done"] != 1.0 || last["files_total"] != 2.0 ||
+		last["bytes_done"] != 10.0 || last["bytes_total"] != 40.0 {
+		t.Errorf("got %v", last)
+	}
+}
+
+func TestBatchProgressSingleFile(t *testing.T) {
+	var out bytes.Buffer
+	events.SetOutput(&out)
+	events.Enable(true)
+	defer events.Enable(false)
+	defer events.SetOutput(os.Stdout)
+
+	batch := newBatchProgress(map[string]models.FileInfo{"a": {}}, []sendEntry{{ID: "a", Size: 10}})
+	batch.report()
+	batch.fileDone(10)
+	if out.Len() != 0 {
+		t.Errorf("single file emitted batch events: %s", out.String())
+	}
+}
@@ -1,61 +1,208 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/fusefs"
 	"github.com/meowrain/localsend-go/internal/models"
 
+	"github.com/meowrain/localsend-go/internal/utils/archive"
 	"github.com/meowrain/localsend-go/internal/utils/clipboard"
+	cliphandlers "github.com/meowrain/localsend-go/internal/utils/clipboard/handlers"
+	"github.com/meowrain/localsend-go/internal/utils/encryption"
+	"github.com/meowrain/localsend-go/internal/utils/events"
+	"github.com/meowrain/localsend-go/internal/utils/history"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
-	"github.com/schollz/progressbar/v3"
+	"github.com/meowrain/localsend-go/internal/utils/trust"
+	"github.com/meowrain/localsend-go/internal/utils/webhook"
 )
 
-var (
-	sessionIDCounter = 0
-	sessionMutex     sync.Mutex
-	fileNames        = make(map[string]string) // Used to save filenames
+// sessionRetryAfter is the number of seconds a sender should wait when the session limit is reached
+const sessionRetryAfter = 30
+
+// Upper bounds for upload query parameters
+const (
+	maxFileIDLength = 255
+	maxTokenLength  = 256
 )
 
+// validateUploadParams checks the upload query parameters before any session lookup
+func validateUploadParams(sessionID, fileID, token string) error {
+	if len(sessionID) != 36 {
+		return errors.New("invalid sessionId: expected a UUID")
+	}
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return errors.New("invalid sessionId: expected a UUID")
+	}
+	if fileID == "" || len(fileID) > maxFileIDLength {
+		return fmt.Errorf("invalid fileId: must be 1-%d characters", maxFileIDLength)
+	}
+	if token == "" || len(token) > maxTokenLength {
+		return fmt.Errorf("invalid token: must be 1-%d characters", maxTokenLength)
+	}
+	return nil
+}
+
 func PrepareReceive(w http.ResponseWriter, r *http.Request) {
 	var req models.PrepareReceiveRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Invalid request body")
 		return
 	}
 
 	logger.Infof("Received request from %s,device is %s", req.Info.Alias, req.Info.DeviceModel)
+	if req.Info.OS != "" {
+		logger.Infof("Sender %s runs %s/%s", req.Info.Alias, req.Info.OS, req.Info.GOArch)
+	}
+
+	version := negotiateVersion(req.SupportedVersions)
+	if isLegacyRequest(r) {
+		version = legacyVersion
+	} else if isLegacy(version) {
+		// v1 sessions are keyed by sender IP and answered with the file tokens only,
+		// the v2 endpoint can't serve them
+		version = ""
+	}
+	if version == "" {
+		logger.Warnf("Rejected request from %s: no common protocol version in %v", req.Info.Alias, req.SupportedVersions)
+		writeJSONError(w, http.StatusBadRequest, "unsupported_version", "Unsupported protocol version")
+		return
+	}
+
+	if !Receiving() {
+		logger.Warnf("Rejected request from %s: receiving is switched off", req.Info.Alias)
+		writeJSONError(w, http.StatusForbidden, "rejected", "Rejected")
+		return
+	}
+
+	if !checkPIN(w, r, req.Info.Alias) {
+		return
+	}
+
+	if trust.IsUntrusted(req.Info.Fingerprint) {
+		logger.Warnf("Rejected request from %s: fingerprint is untrusted", req.Info.Alias)
+		writeJSONError(w, http.StatusForbidden, "rejected", "Rejected")
+		return
+	}
+
+	// Without auto-accept, or for senders outside the allow list, the user decides
+	policy := config.ConfigData.ReceivePolicyFor(req.Info.Fingerprint)
+	if !trust.IsTrusted(req.Info.Fingerprint) &&
+		(!policy.AutoAccept || !config.ConfigData.AllowsSender(req.Info.Fingerprint, req.Info.Alias)) {
+		accepted := askAccept(r, req.Info, req.Files)
+		if len(accepted) == 0 {
+			logger.Warnf("Rejected request from %s", req.Info.Alias)
+			writeJSONError(w, http.StatusForbidden, "rejected", "Rejected")
+			return
+		}
+		req.Files = acceptedFiles(req.Files, accepted)
+	}
+
+	sessionID := uuid.NewString()
 
-	sessionMutex.Lock()
-	sessionIDCounter++
-	sessionID := fmt.Sprintf("session-%d", sessionIDCounter)
-	sessionMutex.Unlock()
+	organizeBy := config.ConfigData.OrganizeBy
+	session := newReceiveSession(sessionID, req.Info, organizedDir(policy.ReceiveDir, organizeBy, req.Info, time.Now()))
 
 	files := make(map[string]string)
+	dirs := 0
 	for fileID, fileInfo := range req.Files {
+		if req.Info.OS == "windows" {
+			// Windows senders may use backslashes between directories
+			fileInfo.FileName = strings.ReplaceAll(fileInfo.FileName, "\\", "/")
+		}
+		if fileInfo.FileType == models.DirectoryFileType {
+			// Empty directories need no upload, create them right away
+			if err := createReceiveDir(session, fileInfo); err != nil {
+				logger.Warnf("Skipping directory %s from %s: %v", fileInfo.FileName, req.Info.Alias, err)
+				continue
+			}
+			dirs++
+			continue
+		}
+		if !policy.Allows(fileInfo.FileName, fileInfo.FileType, fileInfo.Size) {
+			logger.Warnf("Skipping %s from %s: not allowed by device profile", fileInfo.FileName, req.Info.Alias)
+			continue
+		}
+		fileInfo.FileName = organizedFileName(organizeBy, fileInfo)
+		// File names may contain subdirectories but must stay inside the receive directory
+		if !filepath.IsLocal(filepath.FromSlash(fileInfo.FileName)) {
+			logger.Warnf("Skipping %s from %s: invalid file name", fileInfo.FileName, req.Info.Alias)
+			continue
+		}
 		token := fmt.Sprintf("token-%s", fileID)
 		files[fileID] = token
+		session.Files[fileID] = fileInfo
+		session.Tokens[fileID] = token
 
-		// Save filename
-		fileNames[fileID] = fileInfo.FileName
+		if _, err := cliphandlers.Dispatch(fileInfo); err != nil && config.ConfigData.StrictClipboard && errors.Is(err, clipboard.ErrWriteFailed) {
+			writeJSONError(w, http.StatusInternalServerError, "clipboard_failed", "Failed to copy the text to the clipboard")
+			return
+		}
+	}
 
-		if strings.HasSuffix(fileInfo.FileName, ".txt") {
-			logger.Success("TXT file content preview:", string(fileInfo.Preview))
-			clipboard.WriteToClipBoard(fileInfo.Preview)
+	if len(files) == 0 {
+		if dirs > 0 {
+			logger.Successf("Created %d empty directories from %s", dirs, req.Info.Alias)
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
+		writeJSONError(w, http.StatusForbidden, "rejected", "Rejected")
+		return
+	}
+	if caseInsensitiveFS() {
+		renameCaseCollisions(session.Files)
+	}
+	// v1 senders can't continue files, they always send them whole
+	if !isLegacy(version) {
+		session.Offsets = appendOffsets(session)
+		resumeOffsets(session)
+	}
+
+	if !addReceiveSession(w, r, session) {
+		return
+	}
+	sessionManager.ExpireIdle(session, config.ConfigData.SessionIdleTimeout)
+
+	events.Emit("session_started", map[string]interface{}{
+		"session_id": sessionID,
+		"sender":     req.Info.Alias,
+		"files":      len(files),
+	})
+
+	if isLegacy(version) {
+		setLegacySession(remoteIP(r.RemoteAddr), sessionID)
+	}
+	if isLegacyRequest(r) {
+		// v1 answers with the file tokens only
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
+		return
 	}
 
 	resp := models.PrepareReceiveResponse{
-		SessionID: sessionID,
-		Files:     files,
+		SessionID:         sessionID,
+		Files:             files,
+		NegotiatedVersion: version,
+		Compression:       negotiateCompression(req.Info.AcceptsCompression),
+		Offsets:           session.Offsets,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -68,74 +215,175 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Validate request parameters
 	if sessionID == "" || fileID == "" || token == "" {
-		http.Error(w, "Missing parameters", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "missing_parameters", "Missing parameters")
+		return
+	}
+	if err := validateUploadParams(sessionID, fileID, token); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_parameters", err.Error())
 		return
 	}
 
-	// Use fileID to get filename
-	fileName, ok := fileNames[fileID]
+	// Use session and fileID to get filename
+	session, ok := sessionManager.Get(sessionID)
 	if !ok {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		if sessionManager.Expired(sessionID) {
+			writeJSONError(w, http.StatusNotFound, "session_expired", "Session expired")
+			return
+		}
+		writeJSONError(w, http.StatusForbidden, "invalid_session", "Invalid session ID")
+		return
+	}
+	session.Touch()
+	fileInfo, ok := session.Files[fileID]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid_file_id", "Invalid file ID")
+		return
+	}
+	if session.Tokens[fileID] != token {
+		writeJSONError(w, http.StatusForbidden, "invalid_token", "Invalid token")
+		return
+	}
+	fileName := fileInfo.FileName
+	// Appended uploads must continue where the existing file ends, resumed ones may
+	// also start over without an offset
+	offset, appending := session.Offsets[fileID]
+	if appending && r.URL.Query().Get("offset") != strconv.FormatInt(offset.Offset, 10) {
+		if !offset.Partial || r.URL.Query().Has("offset") {
+			writeJSONError(w, http.StatusBadRequest, "invalid_offset", fmt.Sprintf("Invalid offset: expected %d", offset.Offset))
+			return
+		}
+		appending = false
+		offset = models.FileOffset{}
+	}
+	// The receiver offers offsets without hashing the existing data, the sender sends
+	// the SHA256 of the part it skipped for it to be checked on open
+	prefixSum := r.URL.Query().Get("offsetSha256")
+	if appending && prefixSum == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid_offset", "Missing offsetSha256")
 		return
 	}
 
-	// Generate file path, preserve file extension
-	filePath := filepath.Join("uploads", fileName)
-	// Create directory (if it doesn't exist)
-	dir := filepath.Dir(filePath)
-	err := os.MkdirAll(dir, os.ModePerm)
+	// Compressed uploads are decoded before hashing and writing
+	encoding := r.Header.Get("Content-Encoding")
+	decoded, err := decodeBody(encoding, r.Body)
 	if err != nil {
-		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
-		logger.Errorf("Error creating directory:", err)
+		writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_encoding", err.Error())
+		return
+	}
+	defer decoded.Close()
+
+	// Files encrypted with --encrypt start with a header, --decrypt decrypts them
+	buffered := bufio.NewReader(decoded)
+	var plain io.Reader = buffered
+	decrypting, keptEncrypted := false, false
+	if header, _ := buffered.Peek(len(encryption.Magic)); encryption.IsEncrypted(header) {
+		if config.ConfigData.Decrypt == "" {
+			logger.Warnf("%s is encrypted, saving it as received (use --decrypt to decrypt it)", fileName)
+			keptEncrypted = true
+		} else {
+			plain, err = encryption.NewReader(buffered, config.ConfigData.Decrypt)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "decryption_failed", err.Error())
+				return
+			}
+			decrypting = true
+		}
+	}
+
+	// Hash the data as it is written so verification needs no second read
+	hasher := sha256.New()
+	body := io.TeeReader(plain, hasher)
+
+	var file io.WriteCloser
+	var filePath string
+	var remove func()
+	switch {
+	case appending && offset.Partial:
+		file, filePath, remove, err = openResumeFile(session, fileID, fileInfo, offset, prefixSum, hasher)
+		if err != nil && !errors.Is(err, errFileSkipped) {
+			writeJSONError(w, http.StatusPreconditionFailed, "file_changed", "Partial file changed")
+			logger.Errorf("Cannot resume %s: %v", fileName, err)
+			return
+		}
+	case appending:
+		file, filePath, remove, err = openAppendFile(session, fileInfo, offset, prefixSum, hasher)
+		if err != nil {
+			writeJSONError(w, http.StatusPreconditionFailed, "file_changed", "Existing file differs")
+			logger.Errorf("Cannot append to %s: %v", fileName, err)
+			return
+		}
+	default:
+		discardPartial(session, fileInfo)
+		file, filePath, remove, err = createReceiveFile(session, fileInfo)
+	}
+	if errors.Is(err, errFileSkipped) {
+		// Keeping the existing file completes this upload
+		sessionManager.MarkReceived(sessionID, fileID, "")
+		session.SetProgress(fileID, 0, models.ProgressDone)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.UploadStats{})
 		return
 	}
-	// Create file
-	file, err := os.Create(filePath)
 	if err != nil {
-		http.Error(w, "Failed to create file", http.StatusInternalServerError)
-		logger.Errorf("Error creating file:", err)
+		writeJSONError(w, http.StatusInternalServerError, "create_failed", "Failed to create file")
+		logger.Errorf("Error creating file: %v", err)
 		return
 	}
 	defer file.Close()
 
-	// Create a context to handle request cancellation
-	ctx := r.Context()
+	// The read deadline is extended while the body arrives, the response only follows
+	// the whole body. Hashing the data appended to may have taken a while already.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	extendReadDeadline(rc)
+
+	// Stop on request cancellation or when the session is cancelled
+	ctx, stop := context.WithCancel(r.Context())
+	defer stop()
+	defer context.AfterFunc(session.Context(), stop)()
 
 	// After creating file, get file size
 	contentLength := r.ContentLength
+	if (encoding != "" && encoding != "identity") || decrypting {
+		// Content-Length is the compressed or encrypted size, check against the declared size instead
+		contentLength = fileInfo.Size - offset.Offset
+	}
 
 	// Create progress bar
-	bar := progressbar.NewOptions64(
-		contentLength,
-		progressbar.OptionSetDescription(fmt.Sprintf("Downloading %s", fileName)),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionThrottle(time.Second), // Reduce refresh rate to reduce flickering
-		progressbar.OptionShowCount(),
-		progressbar.OptionClearOnFinish(), // Clear progress bar on finish
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetPredictTime(true), // Predict remaining time
-		progressbar.OptionFullWidth(),          // Use full width display
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "█", // Use solid block
-			SaucerHead:    "█",
-			SaucerPadding: "░", // Use gray block as background
-			BarStart:      "|",
-			BarEnd:        "|",
-		}),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-	)
+	bar := newProgressBar(contentLength, fmt.Sprintf("Downloading %s", fileName))
+	defer bar.Close()
 
 	buffer := make([]byte, 2*1024*1024) // 2MB buffer
 
 	// Use channel to handle transfer completion or cancellation
 	done := make(chan error, 1)
+	var bytesReceived int64
+	start := time.Now()
+
+	recordReceive := func(err error) {
+		if err != nil {
+			session.FailProgress(fileID)
+		} else {
+			session.SetProgress(fileID, fileInfo.Size, models.ProgressDone)
+		}
+		recordHistory(history.DirectionReceive, session.Sender.Alias, remoteIP(r.RemoteAddr), fileName,
+			fileInfo.Size, fileInfo.SHA256, time.Since(start), err)
+	}
 
 	go func() {
 		for {
-			n, err := r.Body.Read(buffer)
+			// Stop reading while paused, the sender is held by TCP backpressure
+			if err := waitIfPaused(ctx); err != nil {
+				done <- err
+				return
+			}
+			extendReadDeadline(rc)
+			// After a cancellation the deadline must stay expired, see below
+			if err := ctx.Err(); err != nil {
+				done <- err
+				return
+			}
+			n, err := body.Read(buffer)
 			if err != nil && err != io.EOF {
 				done <- fmt.Errorf("Failed to read file: %w", err)
 				return
@@ -150,6 +398,9 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 				done <- fmt.Errorf("Failed to write file: %w", err)
 				return
 			}
+			bytesReceived += int64(n)
+			session.SetProgress(fileID, offset.Offset+bytesReceived, models.ProgressReceiving)
+			session.Touch()
 
 			bar.Add(n)
 		}
@@ -157,26 +408,237 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Wait for transfer completion or cancellation
 	select {
-	case err := <-done:
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			logger.Errorf("Transfer error:", err)
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		// Abort the read in progress and wait for the reader, so it neither writes to
+		// the file removed below nor outlives the request
+		if rc.SetReadDeadline(time.Now()) == nil {
+			<-done
+		}
+	}
+	// A sender that cancels notifies the session before it aborts the upload, so a
+	// read error that follows is part of the cancellation, not a network error
+	if err != nil && ctx.Err() != nil {
+		recordReceive(errors.New("transfer cancelled"))
+		if session.Context().Err() != nil {
 			// Delete incomplete file
-			os.Remove(filePath)
+			remove()
+			logger.Infof("Transfer of %s cancelled, partial file removed", fileName)
+			writeJSONError(w, http.StatusGone, "session_cancelled", "Session cancelled")
 			return
 		}
-	case <-ctx.Done():
-		// Request cancelled
+		// Request cancelled, e.g. the sender lost the connection: keep the data
+		// received so far for a later session, or delete it
+		if keptEncrypted || !keepPartial(session, fileInfo, file) {
+			remove()
+		}
 		logger.Info("Transfer cancelled")
-		// Delete incomplete file
-		os.Remove(filePath)
 		// Close connection
 		if conn, ok := w.(http.CloseNotifier); ok {
 			conn.CloseNotify()
 		}
 		return
 	}
+	if err != nil && isDiskFull(err) {
+		// No space for this file or the rest of the session
+		remove()
+		logDiskFull(session.Dir, fileName, fileInfo.Size)
+		recordReceive(err)
+		writeJSONError(w, http.StatusInsufficientStorage, "insufficient_storage", "Insufficient storage")
+		CancelReceiveSession(sessionID)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "transfer_failed", err.Error())
+		logger.Errorf("Transfer error: %v", err)
+		recordReceive(err)
+		// Keep the data received so far for a later session, or delete it
+		if keptEncrypted || !keepPartial(session, fileInfo, file) {
+			remove()
+		}
+		return
+	}
 
+	duration := time.Since(start)
+
+	// Catch truncated bodies; chunked uploads (-1) rely on the SHA256 check
+	if contentLength > 0 && bytesReceived != contentLength {
+		msg := fmt.Sprintf("Size mismatch: received %d of %d bytes", bytesReceived, contentLength)
+		writeJSONError(w, http.StatusInternalServerError, "size_mismatch", msg)
+		logger.Errorf("%s for %s", msg, fileName)
+		recordReceive(errors.New(msg))
+		remove()
+		return
+	}
+
+	// Verify the checksum declared by the sender, it is the hash of the plaintext
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	verified := false
+	if fileInfo.SHA256 != "" && !keptEncrypted {
+		if !strings.EqualFold(sum, fileInfo.SHA256) {
+			writeJSONError(w, http.StatusInternalServerError, "sha256_mismatch", "SHA256 mismatch")
+			logger.Errorf("SHA256 mismatch for %s: expected %s, got %s", fileName, fileInfo.SHA256, sum)
+			recordReceive(errors.New("SHA256 mismatch"))
+			remove()
+			return
+		}
+		verified = true
+	}
+
+	// Moves a new file into place; the deferred Close is then a no-op
+	if err := file.Close(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "save_failed", "Failed to save file")
+		logger.Errorf("Failed to save %s: %v", fileName, err)
+		recordReceive(err)
+		remove()
+		return
+	}
+	if config.ConfigData.PreservePermissions && fileInfo.Permissions != 0 && !fusefs.Enabled() {
+		// Only the rwx bits: setuid, setgid and sticky from a sender are never applied
+		if err := os.Chmod(filePath, fs.FileMode(fileInfo.Permissions)&fs.ModePerm); err != nil {
+			logger.Warnf("Failed to set permissions of %s: %v", filePath, err)
+		}
+	}
 	logger.Success("File saved to:", filePath)
+	if config.ConfigData.Unzip && !fusefs.Enabled() && strings.EqualFold(filepath.Ext(filePath), ".zip") {
+		extractDir := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+		if err := archive.Unzip(filePath, extractDir); err != nil {
+			logger.Errorf("Failed to extract %s: %v", filePath, err)
+		} else {
+			logger.Success("Archive extracted to:", extractDir)
+		}
+	}
+	events.Emit("file_received", map[string]interface{}{
+		"file":   fileName,
+		"path":   filePath,
+		"size":   fileInfo.Size,
+		"sender": session.Sender.Alias,
+	})
+	notifyWebhooks(webhook.WebhookPayload{
+		Event:  "received",
+		File:   fileName,
+		Sender: session.Sender.Alias,
+		Size:   bytesReceived,
+		Path:   filePath,
+		SHA256: sum,
+	})
+	fileReceived(filePath, session.Sender.Alias)
+	autoOpen(filePath, fileInfo)
+	complete := sessionManager.MarkReceived(sessionID, fileID, sum)
+	recordReceive(nil)
+	if complete && config.ConfigData.VerifyManifest != "" {
+		verifyManifest(session, config.ConfigData.VerifyManifest)
+	}
+
+	stats := models.UploadStats{
+		BytesReceived:  bytesReceived,
+		DurationMs:     duration.Milliseconds(),
+		SHA256Verified: verified,
+	}
+	if duration > 0 {
+		stats.SpeedMbps = math.Round(float64(bytesReceived)*8/1e5/duration.Seconds()) / 10
+	}
+	if !progressEnabled() {
+		logger.Infof("Received %d bytes in %s (%.1f Mbps)", bytesReceived, duration.Round(time.Millisecond), stats.SpeedMbps)
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// addReceiveSession registers a prepared session. When max_sessions are active it
+// waits in the session queue (queue_mode "wait") or answers 409 right away; a full
+// queue answers 503. It reports whether the session was added.
+func addReceiveSession(w http.ResponseWriter, r *http.Request, session *ReceiveSession) bool {
+	limit := config.ConfigData.MaxSessions
+	if config.ConfigData.QueueMode != "wait" {
+		if sessionManager.TryAdd(session, limit) {
+			return true
+		}
+		logger.Warnf("Rejected request from %s: session limit (%d) reached", session.Sender.Alias, limit)
+		writeSessionLimit(w, http.StatusConflict, "session_limit_reached")
+		return false
+	}
+
+	err := sessionManager.AddWaiting(r.Context(), session, limit, config.ConfigData.QueueSize, config.ConfigData.QueueTimeout)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errSessionQueueFull):
+		logger.Warnf("Rejected request from %s: session limit (%d) reached and the queue is full", session.Sender.Alias, limit)
+		writeSessionLimit(w, http.StatusServiceUnavailable, "session_queue_full")
+	case errors.Is(err, errSessionQueueTimeout):
+		// Still busy, the sender retries 409 answers
+		logger.Warnf("Rejected request from %s: no session slot within %s", session.Sender.Alias, config.ConfigData.QueueTimeout)
+		writeSessionLimit(w, http.StatusConflict, "session_limit_reached")
+	default:
+		logger.Debugf("Sender %s gave up waiting for a session slot", session.Sender.Alias)
+	}
+	return false
+}
+
+// writeSessionLimit answers a prepare request rejected by the session limit
+func writeSessionLimit(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(sessionRetryAfter))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":       reason,
+		"message":     "Too many active sessions, retry later",
+		"retry_after": sessionRetryAfter,
+	})
+}
+
+// logDiskFull logs a transfer aborted because the disk is full
+func logDiskFull(dir, fileName string, required int64) {
+	free, err := diskFree(dir)
+	if err != nil {
+		logger.Errorf("Disk full while receiving %s (%d bytes required)", fileName, required)
+		return
+	}
+	logger.Errorf("Disk full while receiving %s: %d bytes free in %s, %d bytes required", fileName, free, dir, required)
+}
+
+// createReceiveDir creates an empty directory entry sent with --preserve-empty-dirs
+func createReceiveDir(session *ReceiveSession, fileInfo models.FileInfo) error {
+	if !filepath.IsLocal(filepath.FromSlash(fileInfo.FileName)) {
+		return fmt.Errorf("invalid directory name %q", fileInfo.FileName)
+	}
+	if fusefs.Enabled() {
+		return errors.New("directories are not supported with --fuse-mount")
+	}
+	return os.MkdirAll(filepath.Join(session.Dir, filepath.FromSlash(fileInfo.FileName)), os.ModePerm)
+}
+
+// createReceiveFile creates the destination of an upload, inside the FUSE filesystem
+// when --fuse-mount is used. remove deletes a partially received file.
+func createReceiveFile(session *ReceiveSession, fileInfo models.FileInfo) (io.WriteCloser, string, func(), error) {
+	// File names may contain subdirectories but must stay inside the receive directory
+	if !filepath.IsLocal(filepath.FromSlash(fileInfo.FileName)) {
+		return nil, "", nil, fmt.Errorf("invalid file name %q", fileInfo.FileName)
+	}
+	if fusefs.Enabled() {
+		file, filePath, err := fusefs.Create(session.Sender.Alias, fileInfo.FileName, fileInfo.Size)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return file, filePath, file.Abort, nil
+	}
+
+	// Generate file path, preserve file extension
+	filePath := filepath.Join(session.Dir, filepath.FromSlash(fileInfo.FileName))
+	// Create directory (if it doesn't exist)
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return nil, "", nil, fmt.Errorf("error creating directory: %w", err)
+	}
+	filePath, err := resolveReceiveConflict(session, filePath, fileInfo)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	file, err := createPartialFile(filePath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return file, filePath, file.abort, nil
 }
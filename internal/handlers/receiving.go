@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// receivingOff is set while incoming transfers are switched off (tray receive mode)
+var receivingOff atomic.Bool
+
+var (
+	receivedMu    sync.Mutex
+	onReceivedFns []func(file, sender string)
+)
+
+// SetReceiving switches incoming transfers on or off. While off, every prepare-upload
+// request is rejected.
+func SetReceiving(on bool) {
+	receivingOff.Store(!on)
+}
+
+// Receiving reports whether incoming transfers are accepted
+func Receiving() bool {
+	return !receivingOff.Load()
+}
+
+// OnFileReceived registers fn to be called with the saved path and sender alias of
+// each received file
+func OnFileReceived(fn func(file, sender string)) {
+	receivedMu.Lock()
+	defer receivedMu.Unlock()
+	onReceivedFns = append(onReceivedFns, fn)
+}
+
+func fileReceived(file, sender string) {
+	receivedMu.Lock()
+	fns := onReceivedFns
+	receivedMu.Unlock()
+	for _, fn := range fns {
+		fn(file, sender)
+	}
+}
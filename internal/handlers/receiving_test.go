@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestSetReceiving(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = t.TempDir()
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.OrganizeBy = ""
+	defer SetReceiving(true)
+
+	prepare := func() int {
+		req := models.PrepareReceiveRequest{
+			Info:  models.Info{Alias: "peer"},
+			Files: map[string]models.FileInfo{"f": {ID: "f", FileName: "a.txt", Size: 1, FileType: "text/plain"}},
+		}
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		PrepareReceive(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))))
+		if rec.Code == http.StatusOK {
+			var resp models.PrepareReceiveResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			CancelReceiveSession(resp.SessionID)
+		}
+		return rec.Code
+	}
+
+	SetReceiving(false)
+	if Receiving() {
+		t.Fatal("still receiving")
+	}
+	if code := prepare(); code != http.StatusForbidden {
+		t.Errorf("switched off: got %d, want %d", code, http.StatusForbidden)
+	}
+	SetReceiving(true)
+	if code := prepare(); code != http.StatusOK {
+		t.Errorf("switched on: got %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/utils/events"
+)
+
+// TransferResult is the outcome of sending one file
+type TransferResult struct {
+	FilePath  string
+	BytesSent int64
+	Duration  time.Duration
+	Err       error
+}
+
+// emitResult writes a "result" event for one file in JSON mode
+func emitResult(result TransferResult) {
+	fields := map[string]interface{}{
+		"file":        result.FilePath,
+		"bytes_sent":  result.BytesSent,
+		"duration_ms": result.Duration.Milliseconds(),
+		"status":      "ok",
+	}
+	if result.Err != nil {
+		fields["status"] = "failed"
+		fields["error"] = result.Err.Error()
+	}
+	events.Emit("result", fields)
+}
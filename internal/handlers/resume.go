@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"hash"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/fusefs"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/partials"
+)
+
+// resumeMarker is part of the names of partial files kept to resume, e.g.
+// big.iso.localsend-part-1x2y3z. Unlike receiveTempMarker files they survive restarts.
+const resumeMarker = ".localsend-part-"
+
+// resumeExpiry is how long a partial file is kept for the sender to come back
+const resumeExpiry = 24 * time.Hour
+
+// errPartialChanged is returned when a partial file no longer holds what was offered
+var errPartialChanged = errors.New("partial file changed since the session was prepared")
+
+// resumable reports whether an interrupted upload of fileInfo can be resumed: the
+// sender must be known by fingerprint and the whole file verified by its SHA256
+func resumable(session *ReceiveSession, fileInfo models.FileInfo) bool {
+	return session.Sender.Fingerprint != "" && fileInfo.SHA256 != "" && !fusefs.Enabled()
+}
+
+// partialKey identifies the partial file of an upload in the index
+func partialKey(session *ReceiveSession, fileInfo models.FileInfo) partials.Entry {
+	return partials.Entry{
+		Fingerprint: session.Sender.Fingerprint,
+		Name:        fileInfo.FileName,
+		Size:        fileInfo.Size,
+		SHA256:      strings.ToLower(fileInfo.SHA256),
+	}
+}
+
+// resumeOffsets offers the sender to continue the files of the session it sent before
+// in an interrupted upload, from the partial files kept of them
+func resumeOffsets(session *ReceiveSession) {
+	expirePartials()
+	for id, fileInfo := range session.Files {
+		if _, ok := session.Offsets[id]; ok || !resumable(session, fileInfo) {
+			continue
+		}
+		entry, ok, err := partials.Find(config.PartialsFile(), partialKey(session, fileInfo))
+		if err != nil {
+			logger.Warnf("Failed to read the partial uploads: %v", err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		info, err := os.Lstat(entry.Path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || info.Size() >= fileInfo.Size {
+			discardPartial(session, fileInfo)
+			continue
+		}
+		if session.Offsets == nil {
+			session.Offsets = make(map[string]models.FileOffset)
+		}
+		if session.Partials == nil {
+			session.Partials = make(map[string]string)
+		}
+		session.Offsets[id] = models.FileOffset{Offset: info.Size(), Partial: true}
+		session.Partials[id] = entry.Path
+		logger.Infof("Offering %s to resume %s at %s of %s", session.Sender.Alias, fileInfo.FileName,
+			tui.FormatSize(info.Size()), tui.FormatSize(fileInfo.Size))
+	}
+}
+
+// openResumeFile opens the partial file a resumed upload continues, like openAppendFile
+// after checking it against prefixSum. The data received before is fed to hasher so the
+// SHA256 check covers the whole file; Close moves the file to its destination like a
+// new upload.
+func openResumeFile(session *ReceiveSession, fileID string, fileInfo models.FileInfo, offset models.FileOffset, prefixSum string, hasher hash.Hash) (io.WriteCloser, string, func(), error) {
+	partialPath := session.Partials[fileID]
+	// Out of the index while the upload runs, keepPartial puts it back
+	partials.Take(config.PartialsFile(), partialKey(session, fileInfo))
+	filePath, err := appendPath(session, fileInfo)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	sum, err := hashPrefix(partialPath, offset.Offset, hasher)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !strings.EqualFold(sum, prefixSum) {
+		// Not the start of the sender's file, it can't be resumed by anyone
+		os.Remove(partialPath)
+		return nil, "", nil, errPartialChanged
+	}
+	file, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.Size() != offset.Offset {
+		file.Close()
+		os.Remove(partialPath)
+		return nil, "", nil, errPartialChanged
+	}
+	filePath, err = resolveReceiveConflict(session, filePath, fileInfo)
+	if err != nil {
+		file.Close()
+		os.Remove(partialPath)
+		return nil, "", nil, err
+	}
+	partial := &partialFile{File: file, path: filePath}
+	return partial, filePath, partial.abort, nil
+}
+
+// keepPartial keeps the partial file of an interrupted upload for the sender to
+// resume in a later session, instead of deleting it. It reports whether it did.
+func keepPartial(session *ReceiveSession, fileInfo models.FileInfo, file io.WriteCloser) bool {
+	partial, ok := file.(*partialFile)
+	if !ok || partial.done || !resumable(session, fileInfo) {
+		return false
+	}
+	info, err := partial.Stat()
+	if err != nil || info.Size() == 0 || info.Size() >= fileInfo.Size {
+		return false
+	}
+	partial.done = true
+	path := partial.Name()
+	if err := partial.File.Close(); err != nil {
+		os.Remove(path)
+		return false
+	}
+	if !strings.Contains(filepath.Base(path), resumeMarker) {
+		kept := partial.path + resumeMarker + strconv.FormatUint(rand.Uint64(), 36)
+		if err := os.Rename(path, kept); err != nil {
+			os.Remove(path)
+			return false
+		}
+		path = kept
+	}
+	entry := partialKey(session, fileInfo)
+	entry.Path = path
+	if err := partials.Put(config.PartialsFile(), entry); err != nil {
+		logger.Warnf("Failed to keep the partial upload of %s: %v", fileInfo.FileName, err)
+		os.Remove(path)
+		return false
+	}
+	logger.Infof("Kept %s of %s, the sender can resume the upload within %d hours",
+		tui.FormatSize(info.Size()), fileInfo.FileName, int(resumeExpiry.Hours()))
+	return true
+}
+
+// discardPartial deletes the partial file kept of an earlier upload of fileInfo, the
+// sender starts over
+func discardPartial(session *ReceiveSession, fileInfo models.FileInfo) {
+	if !resumable(session, fileInfo) {
+		return
+	}
+	entry, ok, err := partials.Take(config.PartialsFile(), partialKey(session, fileInfo))
+	if err == nil && ok {
+		os.Remove(entry.Path)
+	}
+}
+
+// expirePartials deletes the partial files no sender resumed within resumeExpiry
+func expirePartials() {
+	expired, err := partials.Expire(config.PartialsFile(), resumeExpiry)
+	if err != nil {
+		logger.Warnf("Failed to expire partial uploads: %v", err)
+		return
+	}
+	for _, entry := range expired {
+		if err := os.Remove(entry.Path); err == nil {
+			logger.Infof("Removed %s, its upload was not resumed within %d hours", entry.Path, int(resumeExpiry.Hours()))
+		}
+	}
+}
+
+// offerResume logs the partial files the receiver kept of an interrupted upload. When
+// sending interactively it asks whether to resume them; declined files start over.
+// Other sends, and sends to a --to device, always resume.
+func offerResume(offsets map[string]models.FileOffset) {
+	var kept int64
+	files := 0
+	for _, offset := range offsets {
+		if offset.Partial {
+			kept += offset.Offset
+			files++
+		}
+	}
+	if files == 0 {
+		return
+	}
+	logger.Infof("Receiver kept %s of %d interrupted file(s)", tui.FormatSize(kept), files)
+	if config.ConfigData.SendTo != "" || !interactive() || tui.Confirm("Resume the interrupted transfer?") {
+		return
+	}
+	for id, offset := range offsets {
+		if offset.Partial {
+			delete(offsets, id)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// failingReader returns its data, then an error as if the connection was lost
+type failingReader struct{ r io.Reader }
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestResumeInterruptedUpload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	recv := t.TempDir()
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = recv
+	config.ConfigData.ReceiveMode = ""
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.OrganizeBy = ""
+	config.ConfigData.PIN = ""
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := sha256.Sum256(data)
+	prepare := func() models.PrepareReceiveResponse {
+		t.Helper()
+		req := models.PrepareReceiveRequest{
+			Info: models.Info{Alias: "peer", Fingerprint: "peer-fp"},
+			Files: map[string]models.FileInfo{"f": {
+				ID: "f", FileName: "big.bin", Size: int64(len(data)), FileType: "application/octet-stream",
+				SHA256: hex.EncodeToString(sum[:]),
+			}},
+		}
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		PrepareReceive(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		var resp models.PrepareReceiveResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("prepare: %d %s", rec.Code, rec.Body.String())
+		}
+		return resp
+	}
+	upload := func(resp models.PrepareReceiveResponse, query string, body io.Reader) *httptest.ResponseRecorder {
+		url := fmt.Sprintf("/?sessionId=%s&fileId=f&token=%s%s", resp.SessionID, resp.Files["f"], query)
+		rec := httptest.NewRecorder()
+		ReceiveHandler(rec, httptest.NewRequest(http.MethodPost, url, body))
+		return rec
+	}
+
+	// The connection is lost after 40000 bytes, the receiver keeps them
+	first := prepare()
+	if len(first.Offsets) != 0 {
+		t.Fatalf("offsets before any upload: %+v", first.Offsets)
+	}
+	upload(first, "", failingReader{bytes.NewReader(data[:40000])})
+	CancelReceiveSession(first.SessionID)
+	if _, err := os.Stat(filepath.Join(recv, "big.bin")); err == nil {
+		t.Fatal("incomplete file at its destination")
+	}
+
+	// The next session offers to continue there
+	second := prepare()
+	offset := second.Offsets["f"]
+	if !offset.Partial || offset.Offset != 40000 {
+		t.Fatalf("got offsets %+v", second.Offsets)
+	}
+	prefix := sha256.Sum256(data[:40000])
+	rec := upload(second, "&offset=40000&offsetSha256="+hex.EncodeToString(prefix[:]), bytes.NewReader(data[40000:]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resumed upload: %d %s", rec.Code, rec.Body.String())
+	}
+	CancelReceiveSession(second.SessionID)
+	if got, _ := os.ReadFile(filepath.Join(recv, "big.bin")); !bytes.Equal(got, data) {
+		t.Errorf("resumed file has %d bytes, want the %d sent", len(got), len(data))
+	}
+	matches, _ := filepath.Glob(filepath.Join(recv, "*"+resumeMarker+"*"))
+	if len(matches) != 0 {
+		t.Errorf("partial files left: %v", matches)
+	}
+	if third := prepare(); len(third.Offsets) != 0 {
+		t.Errorf("completed upload offered again: %+v", third.Offsets)
+	} else {
+		CancelReceiveSession(third.SessionID)
+	}
+}
+
+func TestResumeStartOver(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	recv := t.TempDir()
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.ReceiveDir = recv
+	config.ConfigData.ReceiveMode = ""
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.OrganizeBy = ""
+	config.ConfigData.PIN = ""
+
+	data := []byte(strings.Repeat("abc", 1000))
+	sum := sha256.Sum256(data)
+	files := map[string]models.FileInfo{"f": {ID: "f", FileName: "a.txt", Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}}
+	session := &ReceiveSession{Sender: models.Info{Alias: "peer", Fingerprint: "peer-fp"}, Files: files, Dir: recv}
+
+	partial, err := createPartialFile(filepath.Join(recv, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial.Write(data[:100])
+	if !keepPartial(session, files["f"], partial) {
+		t.Fatal("partial file not kept")
+	}
+	resumeOffsets(session)
+	if offset := session.Offsets["f"]; !offset.Partial || offset.Offset != 100 {
+		t.Fatalf("got offsets %+v", session.Offsets)
+	}
+
+	// A sender that starts over has the partial file deleted
+	discardPartial(session, files["f"])
+	matches, _ := filepath.Glob(filepath.Join(recv, "*"+resumeMarker+"*"))
+	if len(matches) != 0 {
+		t.Errorf("partial files left: %v", matches)
+	}
+	session.Offsets = nil
+	resumeOffsets(session)
+	if len(session.Offsets) != 0 {
+		t.Errorf("discarded partial offered: %+v", session.Offsets)
+	}
+}
+
+// Sends that can't be answered resume without asking
+func TestOfferResumeNotInteractive(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.SendTo = ""
+	config.ConfigData.JSON = true
+
+	offsets := map[string]models.FileOffset{
+		"f": {Offset: 100, Partial: true},
+		"g": {Offset: 20},
+	}
+	offerResume(offsets)
+	if offset := offsets["f"]; !offset.Partial || offset.Offset != 100 || len(offsets) != 2 {
+		t.Errorf("got offsets %+v", offsets)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/mimetype"
+	"github.com/meowrain/localsend-go/internal/utils/retryqueue"
+	"github.com/meowrain/localsend-go/internal/utils/sha256"
+)
+
+// queueFailedUploads records the files whose upload failed in the retry queue
+func queueFailedUploads(ip string, sendEntries []sendEntry, results []TransferResult) {
+	names := make(map[string]string, len(sendEntries))
+	for _, entry := range sendEntries {
+		names[entry.Path] = entry.ID
+	}
+	var failed []retryqueue.Entry
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		failed = append(failed, retryqueue.Entry{
+			PeerIP:    ip,
+			PeerAlias: peerAlias(ip),
+			Path:      result.FilePath,
+			Name:      names[result.FilePath],
+			Attempts:  1,
+			LastError: result.Err.Error(),
+		})
+	}
+	if len(failed) == 0 {
+		return
+	}
+	if err := retryqueue.Add(config.RetryQueueFile(), failed...); err != nil {
+		logger.Warnf("Failed to add failed uploads to the retry queue: %v", err)
+		return
+	}
+	logger.Infof("%d failed upload(s) added to the retry queue, see retry-queue --attempt-now", len(failed))
+}
+
+// RetryQueue returns the pending entries of the retry queue, dropping expired ones
+func RetryQueue() ([]retryqueue.Entry, error) {
+	return retryqueue.Load(config.RetryQueueFile(), config.ConfigData.RetryExpiry)
+}
+
+// RetryQueued sends the queued files again, one session per peer. Files that were sent
+// or no longer exist leave the queue; failed ones stay with their attempt count raised.
+// It returns how many files were sent.
+func RetryQueued() (int, error) {
+	queue, err := RetryQueue()
+	if err != nil {
+		return 0, err
+	}
+	var peers []string
+	byPeer := make(map[string][]retryqueue.Entry)
+	for _, entry := range queue {
+		if _, ok := byPeer[entry.PeerIP]; !ok {
+			peers = append(peers, entry.PeerIP)
+		}
+		byPeer[entry.PeerIP] = append(byPeer[entry.PeerIP], entry)
+	}
+
+	sent := 0
+	for _, ip := range peers {
+		n, err := retryPeer(ip, byPeer[ip])
+		sent += n
+		if err != nil {
+			logger.Errorf("Retry to %s failed: %v", ip, err)
+		}
+	}
+	return sent, nil
+}
+
+// retryPeer sends the queued files of one peer and updates their queue entries
+func retryPeer(ip string, queued []retryqueue.Entry) (int, error) {
+	files := make(map[string]models.FileInfo)
+	var sendEntries []sendEntry
+	byPath := make(map[string]retryqueue.Entry)
+	var done []string
+	for _, entry := range queued {
+		info, err := os.Stat(entry.Path)
+		if err != nil || info.IsDir() {
+			logger.Warnf("Dropping %s from the retry queue: the file is gone", entry.Path)
+			done = append(done, entry.ID)
+			continue
+		}
+		hash, err := sha256.CalculateSHA256(entry.Path)
+		if err != nil {
+			return 0, fmt.Errorf("error calculating SHA256 hash: %w", err)
+		}
+		fileType, err := mimetype.Detect(entry.Path)
+		if err != nil {
+			return 0, fmt.Errorf("error detecting file type: %w", err)
+		}
+		files[entry.Name] = models.FileInfo{
+			ID:       entry.Name,
+			FileName: entry.Name,
+			Size:     info.Size(),
+			FileType: fileType,
+			SHA256:   hash,
+			Metadata: &models.FileMetadata{Modified: info.ModTime().UTC().Format(time.RFC3339)},
+
+			Permissions: uint32(info.Mode().Perm()),
+		}
+		sendEntries = append(sendEntries, sendEntry{ID: entry.Name, Path: entry.Path, Size: info.Size()})
+		byPath[entry.Path] = entry
+	}
+
+	logger.Infof("Retrying %d file(s) to %s", len(sendEntries), ip)
+	var results []TransferResult
+	var err error
+	if len(sendEntries) > 0 {
+		results, err = sendCollected(ip, files, sendEntries)
+	}
+
+	sent := 0
+	var failed []retryqueue.Entry
+	for _, result := range results {
+		entry := byPath[result.FilePath]
+		done = append(done, entry.ID)
+		if result.Err == nil {
+			sent++
+			continue
+		}
+		entry.Attempts++
+		entry.LastError = result.Err.Error()
+		failed = append(failed, entry)
+	}
+	if err == nil && len(results) == 0 && len(sendEntries) > 0 {
+		// Nothing needed uploading, the receiver already has the files
+		for _, entry := range sendEntries {
+			done = append(done, byPath[entry.Path].ID)
+		}
+	}
+	if removeErr := retryqueue.Remove(config.RetryQueueFile(), done...); removeErr != nil {
+		return sent, removeErr
+	}
+	if len(failed) > 0 {
+		if addErr := retryqueue.Add(config.RetryQueueFile(), failed...); addErr != nil {
+			return sent, addErr
+		}
+	}
+	return sent, err
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import "net/http"
+
+// RegisterAPI registers the handlers of the LocalSend API on mux
+func RegisterAPI(mux *http.ServeMux) {
+	mux.Handle("/api/localsend/v2/prepare-upload", PrepareUploadHandler())
+	mux.HandleFunc("/api/localsend/v2/upload", ReceiveHandler)
+	mux.HandleFunc("/api/localsend/v2/info", GetInfoHandler)
+	mux.HandleFunc("/api/localsend/v2/cancel", HandleCancel)
+	mux.HandleFunc("/api/localsend/v2/ping", PingHandler)
+	mux.HandleFunc("/api/localsend/v2/progress", ProgressHandler)
+	mux.HandleFunc("/api/localsend/v2/speedtest", SpeedtestHandler)
+	mux.HandleFunc("/api/localsend/v2/sync/list", SyncListHandler)
+	mux.HandleFunc("/api/localsend/v2/sync/pull", SyncPullHandler)
+
+	// Protocol v1, still spoken by older LocalSend apps
+	mux.Handle("/api/localsend/v1/send-request", PrepareUploadHandler())
+	mux.HandleFunc("/api/localsend/v1/send", LegacyUploadHandler)
+	mux.HandleFunc("/api/localsend/v1/info", GetInfoHandler)
+	mux.HandleFunc("/api/localsend/v1/cancel", LegacyCancelHandler)
+}
@@ -5,50 +5,198 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/discovery"
 	"github.com/meowrain/localsend-go/internal/discovery/shared"
 	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/relay"
+	"github.com/meowrain/localsend-go/internal/transport"
 	"github.com/meowrain/localsend-go/internal/tui"
+	"github.com/meowrain/localsend-go/internal/utils/archive"
+	"github.com/meowrain/localsend-go/internal/utils/encryption"
+	"github.com/meowrain/localsend-go/internal/utils/events"
+	"github.com/meowrain/localsend-go/internal/utils/history"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/mimetype"
+	"github.com/meowrain/localsend-go/internal/utils/report"
 	"github.com/meowrain/localsend-go/internal/utils/sha256"
-	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
 )
 
-// SendFileToOtherDevicePrepare function
-func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiveResponse, error) {
-	// Prepare metadata for all files
+const (
+	maxPrepareRetries      = 3
+	defaultPrepareRetryGap = 5 * time.Second
+	// defaultPeerPort is used for peers that did not announce a port
+	defaultPeerPort = config.DefaultPort
+	// peerProbeInterval is the time between reachability checks of an IP --to
+	peerProbeInterval = 10 * time.Second
+)
+
+// retryAfterDelay parses a Retry-After header given in seconds
+func retryAfterDelay(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return defaultPrepareRetryGap
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// peerBaseURL builds the base URL of a peer from the port and protocol it announced,
+// connecting to the best of the addresses it advertised
+func peerBaseURL(ip string) string {
+	if config.ConfigData.Relay != "" {
+		// ip is the receiver's alias, the relay finds it by that name
+		return "https://" + net.JoinHostPort(relay.Host(ip), strconv.Itoa(defaultPeerPort))
+	}
+	port, protocol, host, quicPort, fingerprint := defaultPeerPort, "https", ip, 0, ""
+	shared.DevicesMutex.RLock()
+	if device, ok := shared.DiscoveredDevices[ip]; ok {
+		fingerprint = device.Fingerprint
+		if preferred := discovery.PreferredAddresses(append([]string{ip}, device.Addresses...)); len(preferred) > 0 {
+			host = preferred[0]
+		}
+		if device.Port > 0 {
+			port = device.Port
+		}
+		quicPort = device.QUICPort
+		if device.Protocol != "" {
+			protocol = device.Protocol
+		}
+	}
+	shared.DevicesMutex.RUnlock()
+	if config.ConfigData.Transport == transport.QUIC {
+		// HTTP/3 listens next to the TCP port unless the peer advertises another one
+		if quicPort == 0 {
+			quicPort = port + 1
+		}
+		port = quicPort
+		// HTTP/3 always runs over TLS, whatever the peer announces for TCP
+		protocol = "https"
+	} else if protocol != "https" && knownOverHTTPS(ip, fingerprint) {
+		logger.Debugf("%s announces %s but was verified over https before, using https", ip, protocol)
+		protocol = "https"
+	}
+	return fmt.Sprintf("%s://%s", protocol, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// sendEntry is a regular file to upload, in upload order
+type sendEntry struct {
+	ID   string // File ID in the prepare-upload request
+	Path string // Local path of the file
+	Size int64
+}
+
+// collectFileMetadata walks path and prepares metadata for all files, keyed by file ID
+func collectFileMetadata(path string) (map[string]models.FileInfo, error) {
+	files, _, err := collectSendFiles([]string{path})
+	return files, err
+}
+
+// collectSendFiles walks every path and merges the metadata of their files, keyed by
+// file ID. The ID and file name are the path relative to the walked path, so the
+// receiver rebuilds the directory tree; a file path is sent under its base name. A
+// file whose ID was taken by an earlier path is prefixed with the base name of its
+// own path, e.g. reports/q4.pdf next to q4.pdf.
+func collectSendFiles(paths []string) (map[string]models.FileInfo, []sendEntry, error) {
 	files := make(map[string]models.FileInfo)
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	var entries []sendEntry
+	owners := make(map[string]int) // File ID to the index of the path it came from
+
+	for i, path := range paths {
+		// uniqueID disambiguates an ID used by another path
+		uniqueID := func(id string) (string, error) {
+			if owner, ok := owners[id]; !ok || owner == i {
+				return id, nil
+			}
+			prefixed := filepath.Base(filepath.Clean(path)) + "/" + id
+			if _, ok := owners[prefixed]; ok {
+				return "", fmt.Errorf("%s is included more than once", prefixed)
+			}
+			return prefixed, nil
 		}
-		if !info.IsDir() {
-			sha256Hash, err := sha256.CalculateSHA256(filePath)
+
+		err := walkSendPath(path, true, func(filePath string, info os.FileInfo, err error) error {
 			if err != nil {
-				return fmt.Errorf("error calculating SHA256 hash: %w", err)
+				return err
 			}
-			fileMetadata := models.FileInfo{
-				ID:       info.Name(), // Use filename as ID
-				FileName: info.Name(),
-				Size:     info.Size(),
-				FileType: filepath.Ext(filePath),
-				SHA256:   sha256Hash,
+			// Path relative to the walked path, with slashes
+			rel, err := filepath.Rel(path, filePath)
+			if err != nil || rel == "." {
+				rel = info.Name()
 			}
-			files[fileMetadata.ID] = fileMetadata
+			rel = filepath.ToSlash(rel)
+			if len(config.ConfigData.SendFilters) > 0 && (!info.IsDir() || config.ConfigData.PreserveEmptyDirs) {
+				if filteredOut(rel, config.ConfigData.SendFilters) {
+					logger.Debugf("Skipping %s: excluded by --exclude/--include", filePath)
+					return nil
+				}
+			}
+			if info.IsDir() && config.ConfigData.PreserveEmptyDirs {
+				entries, err := os.ReadDir(filePath)
+				if err != nil {
+					return err
+				}
+				if len(entries) == 0 {
+					// Empty directories are sent as zero-byte entries
+					id, err := uniqueID(rel)
+					if err != nil {
+						return err
+					}
+					owners[id] = i
+					files[id] = models.FileInfo{ID: id, FileName: id, FileType: models.DirectoryFileType}
+				}
+			}
+			if !info.IsDir() {
+				id, err := uniqueID(rel)
+				if err != nil {
+					return err
+				}
+				sha256Hash, err := sha256.CalculateSHA256(filePath)
+				if err != nil {
+					return fmt.Errorf("error calculating SHA256 hash: %w", err)
+				}
+				fileType, err := mimetype.Detect(filePath)
+				if err != nil {
+					return fmt.Errorf("error detecting file type: %w", err)
+				}
+				fileMetadata := models.FileInfo{
+					ID:       id,
+					FileName: id,
+					Size:     info.Size(),
+					FileType: fileType,
+					SHA256:   sha256Hash,
+					Metadata: &models.FileMetadata{Modified: info.ModTime().UTC().Format(time.RFC3339)},
+
+					Permissions: uint32(info.Mode().Perm()),
+				}
+				owners[id] = i
+				files[id] = fileMetadata
+				entries = append(entries, sendEntry{ID: id, Path: filePath, Size: info.Size()})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error walking the path: %w", err)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error walking the path: %w", err)
 	}
+	return files, entries, nil
+}
 
+// SendFileToOtherDevicePrepare function
+func SendFileToOtherDevicePrepare(ip string, files map[string]models.FileInfo) (*models.PrepareReceiveResponse, error) {
 	// Create and populate PrepareReceiveRequest struct
 	request := models.PrepareReceiveRequest{
 		Info: models.Info{
@@ -60,8 +208,13 @@ func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiv
 			Port:        shared.Message.Port,
 			Protocol:    shared.Message.Protocol,
 			Download:    shared.Message.Download,
+
+			AcceptsCompression: supportedCompression,
+			OS:                 shared.Message.OS,
+			GOArch:             shared.Message.GOArch,
 		},
-		Files: files,
+		Files:             files,
+		SupportedVersions: supportedVersions,
 	}
 
 	// Encode request struct to JSON
@@ -71,47 +224,229 @@ func SendFileToOtherDevicePrepare(ip string, path string) (*models.PrepareReceiv
 	}
 
 	// Send POST request
-	url := fmt.Sprintf("https://%s:53317/api/localsend/v2/prepare-upload", ip)
+	version := peerVersion(ip)
+	tlsConfig := peerTLSConfig(ip)
+	// Fail fast when the device went offline after discovery
+	dialer := &net.Dialer{Timeout: connectTimeout}
 	client := &http.Client{
 		Timeout: 60 * time.Second, // Transfer timeout
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Ignore TLS
-			},
-		},
+		Transport: transport.RoundTripper(&http.Transport{
+			TLSClientConfig: tlsConfig,
+			DialContext:     dialer.DialContext,
+			DialTLSContext:  (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext,
+		}),
+	}
+	pin := peerPIN(ip)
+	prepare := func() (*http.Response, error) {
+		url := peerBaseURL(ip) + apiPath(version, "prepare-upload")
+		for {
+			resp, err := postPrepare(client, pinURL(url, pin), requestJson)
+			if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+				resp.Body.Close()
+				return nil, lockedOut(resp)
+			}
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+			// The receiver requires a PIN, or the one given was wrong
+			resp.Body.Close()
+			if pin, err = askPeerPIN(ip, pin != ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	resp, err := prepare()
+	if err == nil && resp.StatusCode == http.StatusNotFound && !isLegacy(version) {
+		// Older LocalSend apps only serve the v1 API
+		resp.Body.Close()
+		logger.Infof("%s does not serve the v2 API, falling back to v1", ip)
+		version = legacyVersion
+		resp, err = prepare()
 	}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(requestJson))
 	if err != nil {
-		return nil, fmt.Errorf("error sending POST request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
+	rememberPeerPIN(ip, pin)
 
 	// Check response
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
 		case 204:
-			return nil, fmt.Errorf("finished (No file transfer needed)")
+			return nil, errNoTransferNeeded
 		case 400:
 			return nil, fmt.Errorf("invalid body")
 		case 403:
 			return nil, fmt.Errorf("rejected")
+		case 409:
+			return nil, fmt.Errorf("receiver is busy with other sessions")
 		case 500:
 			return nil, fmt.Errorf("unknown error by receiver")
+		case 503:
+			return nil, fmt.Errorf("receiver is busy and its session queue is full")
 		}
 		return nil, fmt.Errorf("failed to send metadata: received status code %d", resp.StatusCode)
 	}
 
 	// Decode response JSON to PrepareReceiveResponse struct
 	var prepareReceiveResponse models.PrepareReceiveResponse
-	if err := json.NewDecoder(resp.Body).Decode(&prepareReceiveResponse); err != nil {
+	if isLegacy(version) {
+		// v1 answers with the file tokens only, the session ID is local
+		if err := json.NewDecoder(resp.Body).Decode(&prepareReceiveResponse.Files); err != nil {
+			return nil, fmt.Errorf("error decoding response JSON: %w", err)
+		}
+		prepareReceiveResponse.SessionID = uuid.NewString()
+		prepareReceiveResponse.NegotiatedVersion = legacyVersion
+	} else if err := json.NewDecoder(resp.Body).Decode(&prepareReceiveResponse); err != nil {
 		return nil, fmt.Errorf("error decoding response JSON: %w", err)
 	}
+	// Receivers without negotiation keep using the version of this request
+	if prepareReceiveResponse.NegotiatedVersion == "" {
+		prepareReceiveResponse.NegotiatedVersion = defaultVersion
+	}
+	offerResume(prepareReceiveResponse.Offsets)
+	setOutgoingSession(prepareReceiveResponse.SessionID, outgoingSession{
+		Version:     prepareReceiveResponse.NegotiatedVersion,
+		Compression: negotiateCompression([]string{prepareReceiveResponse.Compression}),
+		Offsets:     prepareReceiveResponse.Offsets,
+	})
+	logger.Debugf("Negotiated protocol version %s", prepareReceiveResponse.NegotiatedVersion)
 
 	return &prepareReceiveResponse, nil
 }
 
-// uploadFile function
+// postPrepare posts a prepare request, retrying while the receiver answers 409
+// because it is busy with other sessions
+func postPrepare(client *http.Client, url string, body []byte) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if isConnectError(err) {
+			return nil, fmt.Errorf("%w: %w", errConnectFailed, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error sending POST request: %w", err)
+		}
+		if resp.StatusCode != http.StatusConflict || attempt > maxPrepareRetries {
+			return resp, nil
+		}
+		// Receiver is busy with other sessions, wait and try again
+		resp.Body.Close()
+		delay := retryAfterDelay(resp.Header.Get("Retry-After"))
+		logger.Warnf("Receiver is busy, retrying in %s (attempt %d/%d)", delay, attempt, maxPrepareRetries)
+		time.Sleep(delay)
+	}
+}
+
+// connectTimeout bounds connecting to the receiver, including the TLS handshake
+const connectTimeout = 5 * time.Second
+
+// errConnectFailed is returned when the receiver can't be reached within connectTimeout
+var errConnectFailed = errors.New("could not connect to the receiver")
+
+// isConnectError reports whether a request failed before reaching the receiver
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return isTimeout(err)
+}
+
+// isTimeout reports whether err is a network timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// reconnectPollInterval is how often waitForReappear checks the discovered devices
+var reconnectPollInterval = 500 * time.Millisecond
+
+// prepareWithReconnect sends the prepare request. When it times out, e.g. because the
+// receiver rebooted after it was discovered, it waits up to --reconnect-timeout for the
+// device to announce itself again, possibly at a new IP, and retries. It returns the IP
+// the request went to.
+func prepareWithReconnect(ip string, files map[string]models.FileInfo) (string, *models.PrepareReceiveResponse, error) {
+	response, err := SendFileToOtherDevicePrepare(ip, files)
+	timeout := config.ConfigData.ReconnectTimeout
+	alias := peerAlias(ip)
+	if !isTimeout(err) || timeout <= 0 || alias == "" {
+		return ip, response, err
+	}
+
+	logger.Warnf("Connection lost, waiting for %s to reappear (%s)...", alias, timeout)
+	deadline := time.Now().Add(timeout)
+	for isTimeout(err) {
+		newIP, waitErr := waitForReappear(alias, time.Now(), deadline)
+		if waitErr != nil {
+			return ip, nil, fmt.Errorf("%w: %w", waitErr, err)
+		}
+		if newIP != ip {
+			logger.Infof("%s is back at %s", alias, newIP)
+		}
+		ip = newIP
+		response, err = SendFileToOtherDevicePrepare(ip, files)
+	}
+	return ip, response, err
+}
+
+// waitForReappear waits until a device with alias is discovered after since, and
+// returns its IP
+func waitForReappear(alias string, since, deadline time.Time) (string, error) {
+	ticker := time.NewTicker(reconnectPollInterval)
+	defer ticker.Stop()
+	for {
+		shared.DevicesMutex.RLock()
+		for ip, device := range shared.DiscoveredDevices {
+			if strings.EqualFold(device.Alias, alias) && device.LastSeen.After(since) {
+				shared.DevicesMutex.RUnlock()
+				return ip, nil
+			}
+		}
+		shared.DevicesMutex.RUnlock()
+		if !time.Now().Before(deadline) {
+			return "", fmt.Errorf("%s did not reappear", alias)
+		}
+		<-ticker.C
+	}
+}
+
+// errNoTransferNeeded is returned when the receiver answers 204, e.g. when only empty directories were sent
+var errNoTransferNeeded = errors.New("finished (No file transfer needed)")
+
+// ErrTransferCancelled is returned by SendFile when the user cancelled the transfer
+var ErrTransferCancelled = errors.New("transfer cancelled")
+
+// errSessionBlocked is returned when the receiver answers 409 because it is busy with another session
+var errSessionBlocked = errors.New("blocked by another session")
+
+// uploadFile uploads one file, retrying while the receiver is busy with another session
+// and after retryable failures such as timeouts and 5xx answers
 func uploadFile(ctx context.Context, ip, sessionId, fileId, token, filePath string) error {
+	retries := config.ConfigData.SessionRetryCount
+	delay := config.ConfigData.SessionRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := uploadFileOnce(ctx, ip, sessionId, fileId, token, filePath)
+		blocked := errors.Is(err, errSessionBlocked)
+		if (!blocked && !IsRetryable(err)) || attempt > retries {
+			return err
+		}
+		if blocked {
+			logger.Warnf("Receiver is busy with another session, retrying in %s (attempt %d/%d, %s left)",
+				delay, attempt, retries, time.Duration(retries-attempt+1)*delay)
+		} else {
+			logger.Warnf("Upload of %s failed: %v, retrying in %s (attempt %d/%d)",
+				filepath.Base(filePath), err, delay, attempt, retries)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Transfer cancelled")
+		case <-time.After(delay):
+		}
+	}
+}
+
+// uploadFileOnce performs a single upload attempt
+func uploadFileOnce(ctx context.Context, ip, sessionId, fileId, token, filePath string) error {
 	// Open file to send
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -124,63 +459,48 @@ func uploadFile(ctx context.Context, ip, sessionId, fileId, token, filePath stri
 	if err != nil {
 		return fmt.Errorf("error getting file info: %w", err)
 	}
-	fileSize := fileInfo.Size()
+	prefix, err := skipAppended(sessionId, fileId, file, fileInfo.Size())
+	if err != nil {
+		return err
+	}
+	return uploadStream(ctx, ip, sessionId, fileId, token, filePath, file, fileInfo.Size()-prefix.Offset, prefix)
+}
 
+// uploadStream uploads fileSize bytes from file, following prefix when the receiver has
+// the start of it; filePath names it in the progress output and decides whether it is
+// worth compressing
+func uploadStream(ctx context.Context, ip, sessionId, fileId, token, filePath string, file io.Reader, fileSize int64, prefix appendedPrefix) error {
 	// Create progress bar
-	bar := progressbar.NewOptions64(
-		fileSize,
-		progressbar.OptionSetDescription(fmt.Sprintf("Uploading %s", filepath.Base(filePath))),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionThrottle(time.Second), // Reduce refresh rate to reduce flickering
-		progressbar.OptionShowCount(),
-		progressbar.OptionClearOnFinish(), // Clear progress bar on finish
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetPredictTime(true), // Predict remaining time
-		progressbar.OptionFullWidth(),          // Use full width display
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "█", // Use solid block
-			SaucerHead:    "█",
-			SaucerPadding: "░", // Use gray block as background
-			BarStart:      "|",
-			BarEnd:        "|",
-		}),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-	)
+	description := fmt.Sprintf("Uploading %s", filepath.Base(filePath))
+	if eta := currentTuning.estimate(fileSize); eta >= time.Second {
+		description += fmt.Sprintf(" (est. %s)", eta.Round(time.Second))
+	}
+	bar := newProgressBar(fileSize, description)
+	defer bar.Close()
 
 	// Build file upload URL
-	uploadURL := fmt.Sprintf("https://%s:53317/api/localsend/v2/upload?sessionId=%s&fileId=%s&token=%s",
-		ip, sessionId, fileId, token)
+	uploadURL := fmt.Sprintf("%s%s?sessionId=%s&fileId=%s&token=%s",
+		peerBaseURL(ip), sessionAPIPath(sessionId, "upload"), sessionId, fileId, token)
+	if isLegacy(getOutgoingSession(sessionId).Version) {
+		// The receiver knows v1 sessions by the sender
+		uploadURL = fmt.Sprintf("%s%s?fileId=%s&token=%s", peerBaseURL(ip), sessionAPIPath(sessionId, "upload"), fileId, token)
+	}
+	if prefix.Offset > 0 {
+		uploadURL += fmt.Sprintf("&offset=%d&offsetSha256=%s", prefix.Offset, prefix.SHA256)
+	}
 
 	// Use pipe to avoid loading entire file into memory
 	pr, pw := io.Pipe()
 
-	// Create an error channel to pass errors during upload
-	uploadErr := make(chan error, 1)
-
-	go func() {
-		defer pw.Close()
-		// Write file data in a new goroutine
-		_, err := io.Copy(io.MultiWriter(pw, bar), file)
-		if err != nil {
-			uploadErr <- err
-			return
-		}
-	}()
-
 	// Create HTTP client with TLS config
 	client := &http.Client{
 		Timeout: 30 * time.Minute,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // Skip certificate verification
-			},
+		Transport: transport.RoundTripper(&http.Transport{
+			TLSClientConfig:    peerTLSConfig(ip),
 			MaxIdleConns:       100,
 			IdleConnTimeout:    90 * time.Second,
 			DisableCompression: true,
-		},
+		}),
 	}
 
 	// Create request
@@ -192,163 +512,450 @@ func uploadFile(ctx context.Context, ip, sessionId, fileId, token, filePath stri
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.ContentLength = fileSize
 
+	// Encrypt on the fly with --encrypt, the receiver detects the header
+	var dst io.Writer = pw
+	var compressor, encrypter io.WriteCloser
+	if passphrase := config.ConfigData.Encrypt; passphrase != "" {
+		encrypter, err = encryption.NewWriter(pw, passphrase)
+		if err != nil {
+			return fmt.Errorf("error encrypting %s: %w", filePath, err)
+		}
+		dst = encrypter
+		if fileSize >= 0 {
+			req.ContentLength = encryption.EncryptedSize(fileSize)
+		}
+	}
+
+	// Compress on the fly when enabled and the receiver accepts it. Encrypted data
+	// doesn't compress.
+	if encoding := getOutgoingSession(sessionId).Compression; config.ConfigData.Compress && encrypter == nil && encoding != "" && shouldCompress(filePath) {
+		compressor, err = newCompressor(encoding, pw)
+		if err != nil {
+			return err
+		}
+		dst = compressor
+		req.Header.Set("Content-Encoding", encoding)
+		req.ContentLength = -1 // Compressed size is not known up front
+	}
+
+	progress, stopProgress := startProgressLogger(filePath, fileSize)
+	defer stopProgress()
+
+	// The copy goroutine always reports its result exactly once
+	uploadErr := make(chan error, 1)
+
+	go func() {
+		// Write file data in a new goroutine, adapting the buffer to the throughput
+		_, err := adaptiveCopy(pauseWriter{ctx, io.MultiWriter(dst, bar, progress)}, file, currentTuning.BufferSize, linkSpeed(ip))
+		if err == nil && compressor != nil {
+			err = compressor.Close() // Flush the last frame
+		}
+		if err == nil && encrypter != nil {
+			err = encrypter.Close() // Write the last chunk
+		}
+		pw.CloseWithError(err)
+		uploadErr <- err
+	}()
+
 	// Use custom client to send request, instead of http.DefaultClient
+	start := time.Now()
 	resp, err := client.Do(req)
 
-	// Check if cancelled
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("Transfer cancelled")
-	case err := <-uploadErr:
-		if err != nil {
-			return fmt.Errorf("Upload error: %w", err)
+	// Unblock the writer if the request finished before the body was consumed,
+	// then wait for it so neither result is lost
+	pr.Close()
+	copyErr := <-uploadErr
+
+	if ctx.Err() != nil {
+		if resp != nil {
+			resp.Body.Close()
 		}
-	default:
-		if err != nil {
-			return fmt.Errorf("error sending file upload request: %w", err)
+		return fmt.Errorf("Transfer cancelled")
+	}
+	if copyErr != nil && !errors.Is(copyErr, io.ErrClosedPipe) {
+		if resp != nil {
+			resp.Body.Close()
 		}
+		return classifyError(fmt.Errorf("Upload error: %w", copyErr), 0)
+	}
+	if err != nil {
+		return classifyError(fmt.Errorf("error sending file upload request: %w", err), 0)
 	}
+	defer resp.Body.Close()
 
 	// 检查响应
 	if resp.StatusCode != http.StatusOK {
-		switch resp.StatusCode {
-		case 400:
-			return fmt.Errorf("missing parameters")
-		case 403:
-			return fmt.Errorf("invalid token or IP address")
-		case 409:
-			return fmt.Errorf("blocked by another session")
-		case 500:
-			return fmt.Errorf("unknown error by receiver")
-		}
-		return fmt.Errorf("file upload failed: received status code %d", resp.StatusCode)
+		return classifyError(uploadStatusError(resp.StatusCode), resp.StatusCode)
 	}
 
-	fmt.Println() // Add newline to make the progress bar clearer
+	if _, plain := bar.(plainBar); plain && progressEnabled() {
+		fmt.Println() // Add newline to make the progress bar clearer
+	}
+	elapsed := time.Since(start)
 	logger.Success("File uploaded successfully")
+	logger.Infof("Sent %d bytes in %s (%.1f Mbps)", fileSize, elapsed.Round(time.Millisecond), float64(fileSize)*8/1e6/elapsed.Seconds())
+
+	// Receivers other than localsend-go reply with an empty body
+	var stats models.UploadStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err == nil {
+		logger.Infof("Receiver stats: %d bytes in %dms (%.1f Mbps), sha256 verified: %t",
+			stats.BytesReceived, stats.DurationMs, stats.SpeedMbps, stats.SHA256Verified)
+	} else if err != io.EOF {
+		logger.Debugf("Could not decode receiver stats: %v", err)
+	}
+	events.Emit("upload_complete", map[string]interface{}{
+		"file": filePath,
+		"size": fileSize,
+	})
 	return nil
 }
 
-// SendFile function
-func SendFile(path string) error {
+// interactive reports whether a send may ask the user: there is a terminal to answer on,
+// and the send is neither scripted (--json, --quiet) nor scheduled (--at, --in)
+func interactive() bool {
+	return !config.ConfigData.JSON && !config.ConfigData.Quiet &&
+		config.ConfigData.SendAt == "" && config.ConfigData.SendIn == "" &&
+		term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// selectTarget picks the receiving device, interactively or from --to
+func selectTarget(updates <-chan []models.SendModel) (string, error) {
+	if config.ConfigData.Relay != "" {
+		// Peers behind a relay are not discovered
+		if config.ConfigData.SendTo == "" {
+			return "", fmt.Errorf("--relay needs the receiver's alias with --to")
+		}
+		return config.ConfigData.SendTo, nil
+	}
+	if config.ConfigData.LocalOnly && config.ConfigData.SendTo == "" {
+		// Nothing is discovered, the receiver must be given
+		return "", fmt.Errorf("--local-only needs the receiver's address with --to, e.g. --to 127.0.0.1")
+	}
+	if config.ConfigData.SendTo == "" {
+		fmt.Println("Please select a device you want to send file to:")
+		return tui.SelectDevice(updates)
+	}
+	return waitForDevice(updates, config.ConfigData.SendTo, config.ConfigData.RetryDuration)
+}
+
+// waitForDevice waits until a device whose alias matches target is discovered. An IP
+// target is probed on its info endpoint until it answers.
+func waitForDevice(updates <-chan []models.SendModel, target string, timeout time.Duration) (string, error) {
+	ip := net.ParseIP(target)
+	if ip != nil && probePeer(ip.String(), defaultPeerPort) == nil {
+		return ip.String(), nil
+	}
+
+	logger.Infof("Looking for device %s...", target)
+	deadline := time.After(timeout)
+	reminder := time.NewTicker(time.Minute)
+	defer reminder.Stop()
+	// Only IP targets are probed, aliases can only be found by discovery
+	var probe <-chan time.Time
+	if ip != nil {
+		probeTicker := time.NewTicker(peerProbeInterval)
+		defer probeTicker.Stop()
+		probe = probeTicker.C
+	}
+
+	for {
+		select {
+		case <-probe:
+			if probePeer(ip.String(), defaultPeerPort) == nil {
+				logger.Infof("%s is reachable", target)
+				return ip.String(), nil
+			}
+		case devices := <-updates:
+			for _, device := range devices {
+				if strings.EqualFold(device.DeviceName, target) || (ip != nil && device.IP == ip.String()) {
+					logger.Infof("Found %s at %s", device.DeviceName, device.IP)
+					return device.IP, nil
+				}
+			}
+		case <-reminder.C:
+			logger.Infof("%s is not reachable yet, still retrying (up to %s)", target, timeout)
+		case <-deadline:
+			return "", fmt.Errorf("device %s not found within %s", target, timeout)
+		}
+	}
+}
+
+// SendFile sends a file or directory and returns the result of every file it tried to send
+func SendFile(path string) ([]TransferResult, error) {
+	return SendFiles([]string{path})
+}
+
+// SendFiles sends files and directories in one session and returns the result of every
+// file it tried to send
+func SendFiles(paths []string) ([]TransferResult, error) {
 	updates := make(chan []models.SendModel)
 	discovery.ListenAndStartBroadcasts(updates)
-	fmt.Println("Please select a device you want to send file to:")
-	ip, err := tui.SelectDevice(updates)
+	ip, err := selectTarget(updates)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return SendFilesTo(ip, paths)
+}
+
+// SendFilesTo sends files and directories in one session to the device at ip, without
+// discovery
+func SendFilesTo(ip string, paths []string) ([]TransferResult, error) {
+	paths = append([]string(nil), paths...)
+	if config.ConfigData.Zip {
+		for i, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				zipPath, cleanup, err := zipForSend(path)
+				if err != nil {
+					return nil, err
+				}
+				defer cleanup()
+				paths[i] = zipPath
+			}
+		}
 	}
-	response, err := SendFileToOtherDevicePrepare(ip, path)
+
+	files, sendEntries, err := collectSendFiles(paths)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	results, err := sendCollected(ip, files, sendEntries)
+	if !errors.Is(err, ErrTransferCancelled) {
+		queueFailedUploads(ip, sendEntries, results)
 	}
+	return results, err
+}
 
-	// Create a context for cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// sendCollected sends the collected files to ip in one session
+func sendCollected(ip string, files map[string]models.FileInfo, sendEntries []sendEntry) ([]TransferResult, error) {
+	if err := excludeKnownHashes(files); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		logger.Info("Nothing to send, all files were excluded")
+		return nil, nil
+	}
+	ip, response, err := prepareWithReconnect(ip, files)
+	// The device may have gone offline since it was picked, offer to retry
+	for errors.Is(err, errConnectFailed) && config.ConfigData.SendTo == "" &&
+		tui.Confirm(fmt.Sprintf("Could not connect to %s. Retry?", ip)) {
+		response, err = SendFileToOtherDevicePrepare(ip, files)
+	}
+	if errors.Is(err, errNoTransferNeeded) {
+		logger.Success("Nothing left to upload, the receiver has everything")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer forgetOutgoingSession(response.SessionID)
+
+	currentTuning = uploadTuning{BufferSize: defaultUploadBufferSize}
+	if config.ConfigData.AutoTune {
+		var totalSize int64
+		for _, file := range files {
+			totalSize += file.Size
+		}
+		currentTuning = autoTune(ip, totalSize)
+	}
+
+	// Keep the session alive until the first upload starts
+	stopPinger := startSessionPinger(ip, response.SessionID)
+	defer stopPinger()
+
+	// Create a context for cancellation; cancelling tells the receiver first
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+	cancel := withCancelNotify(ip, response.SessionID, cancelCtx)
 
 	// Use shared HTTP server to handle cancel requests
 	logger.Info("Registering cancel handler for session: ", response.SessionID)
 	RegisterCancelHandler(response.SessionID, cancel)
 	defer UnregisterCancelHandler(response.SessionID)
 
-	// Iterate through directory and files
-	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// Cancel keys work without progress bars, but not without a terminal to read from
+	if !config.ConfigData.Quiet && !config.ConfigData.JSON {
+		logger.Info("Press q or Ctrl+C to cancel the transfer")
+		stopKeys := tui.WatchCancelKeys(cancel)
+		defer stopKeys()
+	}
+
+	var results []TransferResult
+	var entries []report.Entry
+	batch := newBatchProgress(files, sendEntries)
+	batch.report()
+	defer func() {
+		if err := writeReport(entries); err != nil {
+			logger.Errorf("Failed to write integrity report: %v", err)
 		}
-		if !info.IsDir() {
-			fileId := info.Name()
-			token, ok := response.Files[fileId]
-			if !ok {
-				return fmt.Errorf("token not found for file: %s", fileId)
-			}
-			err = uploadFile(ctx, ip, response.SessionID, fileId, token, filePath)
-			if err != nil {
-				return fmt.Errorf("error uploading file: %w", err)
-			}
+	}()
+
+	for _, entry := range sendEntries {
+		if _, ok := files[entry.ID]; !ok {
+			continue // Excluded by --exclude-hashes
 		}
-		return nil
-	})
+		token, ok := response.Files[entry.ID]
+		if !ok {
+			// The receiver may pick the files to receive, or its device profile not allow some
+			logger.Warnf("Skipping %s, the receiver declined it", entry.Path)
+			continue
+		}
+		stopPinger()
+		start := time.Now()
+		err = uploadFile(ctx, ip, response.SessionID, entry.ID, token, entry.Path)
+		result := TransferResult{FilePath: entry.Path, Duration: time.Since(start), Err: err}
+		if err == nil {
+			result.BytesSent = entry.Size
+		}
+		results = append(results, result)
+		emitResult(result)
+		entries = append(entries, report.NewEntry(entry.Path, entry.Size, files[entry.ID].SHA256, result.Duration, err))
+		recordHistory(history.DirectionSend, peerAlias(ip), ip, entry.Path, entry.Size, files[entry.ID].SHA256, result.Duration, err)
+		if err != nil {
+			err = fmt.Errorf("error uploading file: %w", err)
+			break
+		}
+		batch.fileDone(entry.Size)
+	}
+	if ctx.Err() != nil {
+		return results, ErrTransferCancelled
+	}
 	if err != nil {
-		return fmt.Errorf("error walking the path: %w", err)
+		return results, err
 	}
 
-	return nil
+	return results, nil
 }
 
-func NormalSendHandler(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Handling upload request...") // Debug log - request start
+// zipForSend bundles a directory into a temporary <dirname>.zip so it can be sent as a single file
+func zipForSend(dir string) (string, func(), error) {
+	tmpDir, err := os.MkdirTemp("", "localsend-zip-")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temp directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
 
-	// Limit form data size (set to 10 MB here, adjust as needed)
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse form: %v", err), http.StatusBadRequest)
-		return
+	zipPath := filepath.Join(tmpDir, filepath.Base(filepath.Clean(dir))+".zip")
+	logger.Infof("Creating archive %s", filepath.Base(zipPath))
+	if err := archive.ZipDir(dir, zipPath); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error creating zip archive: %w", err)
 	}
+	return zipPath, cleanup, nil
+}
 
-	// Get uploaded directory name (from frontend hidden input)
-	uploadedDirName := r.FormValue("directoryName")
-	logger.Debugf("directoryName from form: '%s'\n", uploadedDirName) // Debug log - directoryName value
+// writeReport writes the integrity report of a send to the configured destination
+func writeReport(entries []report.Entry) error {
+	format := config.ConfigData.ReportFormat
+	if format == "" && config.ConfigData.ReportFile == "" {
+		return nil
+	}
+	if config.ConfigData.ReportFile == "" {
+		return report.Write(os.Stdout, format, entries)
+	}
 
-	// Get all uploaded files
-	files := r.MultipartForm.File["file"]
-	if len(files) == 0 {
-		http.Error(w, "No files uploaded", http.StatusBadRequest)
-		return
+	file, err := os.Create(config.ConfigData.ReportFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := report.Write(file, format, entries); err != nil {
+		return err
 	}
+	logger.Infof("Integrity report written to %s", config.ConfigData.ReportFile)
+	return nil
+}
 
-	uploadDir := "./uploads"    // Base upload directory
-	finalUploadDir := uploadDir // Default final upload directory
+// maxFormFieldSize limits non-file form fields such as directoryName
+const maxFormFieldSize = 4 << 10
 
-	// If frontend provides directory name and it is not empty, create subdirectory named after it
-	if uploadedDirName != "" {
-		finalUploadDir = filepath.Join(uploadDir, uploadedDirName)
-	} else {
-		logger.Debug("No directoryName provided, uploading to root uploads dir.") // Debug log - no directoryName
-	}
-	logger.Debugf("Final upload directory: '%s'\n", finalUploadDir)
+func NormalSendHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Handling upload request...") // Debug log - request start
 
-	// Create final upload directory (if it doesn't exist)
-	if err := os.MkdirAll(finalUploadDir, os.ModePerm); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create upload directory: %v", err), http.StatusInternalServerError)
+	// Stream the multipart body so large files are never buffered in memory
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_form", fmt.Sprintf("Failed to parse form: %v", err))
 		return
 	}
 
-	// Iterate through all files to save
-	for _, fileHeader := range files {
-		// Open uploaded file
-		file, err := fileHeader.Open()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to open file: %v", err), http.StatusInternalServerError)
-			return
-		}
-		defer file.Close()
-
-		// Join target path (use finalUploadDir as root)
-		destPath := filepath.Join(finalUploadDir, fileHeader.Filename)
-		logger.Infof("Saving file '%s' to destPath: '%s'\n", fileHeader.Filename, destPath) // Debug log - file dest path
+	baseDir := uploadDir()    // Base upload directory
+	finalUploadDir := baseDir // Default final upload directory
+	fileCount := 0
 
-		// Create target directory (if it doesn't exist)
-		if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create directory: %v", err), http.StatusInternalServerError)
-			return
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
 		}
-
-		// Create target file
-		dst, err := os.Create(destPath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create file: %v", err), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusBadRequest, "invalid_form", fmt.Sprintf("Failed to parse form: %v", err))
 			return
 		}
-		defer dst.Close()
 
-		// Write uploaded file content to target file
-		if _, err := io.Copy(dst, file); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to save file: %v", err), http.StatusInternalServerError)
-			return
+		switch part.FormName() {
+		case "directoryName":
+			// Get uploaded directory name (from frontend hidden input), sent before the files
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			part.Close()
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid_form", fmt.Sprintf("Failed to read form: %v", err))
+				return
+			}
+			uploadedDirName := string(value)
+			logger.Debugf("directoryName from form: '%s'\n", uploadedDirName) // Debug log - directoryName value
+
+			// If frontend provides directory name and it is not empty, create subdirectory named after it
+			if uploadedDirName != "" {
+				finalUploadDir = filepath.Join(baseDir, uploadedDirName)
+			}
+		case "file":
+			if part.FileName() == "" {
+				part.Close()
+				continue
+			}
+			err := saveFormFile(part, finalUploadDir)
+			part.Close()
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "save_failed", err.Error())
+				return
+			}
+			fileCount++
+		default:
+			part.Close()
 		}
 	}
 
+	if fileCount == 0 {
+		writeJSONError(w, http.StatusBadRequest, "no_files", "No files uploaded")
+		return
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, "Files uploaded successfully, total %d files, uploaded to directory: %s\n", len(files), finalUploadDir)
+	fmt.Fprintf(w, "Files uploaded successfully, total %d files, uploaded to directory: %s\n", fileCount, finalUploadDir)
+}
+
+// saveFormFile streams one uploaded file part to dir
+func saveFormFile(part *multipart.Part, dir string) error {
+	// Join target path (use dir as root)
+	destPath := filepath.Join(dir, part.FileName())
+	logger.Infof("Saving file '%s' to destPath: '%s'\n", part.FileName(), destPath) // Debug log - file dest path
+
+	// Create target directory (if it doesn't exist)
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return fmt.Errorf("Failed to create directory: %v", err)
+	}
+
+	// Create target file
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("Failed to create file: %v", err)
+	}
+	defer dst.Close()
+
+	// Write uploaded file content to target file
+	if _, err := io.Copy(dst, part); err != nil {
+		os.Remove(destPath)
+		return fmt.Errorf("Failed to save file: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/history"
+)
+
+// SendBytes sends data held in memory to the device at ip as a file called name
+func SendBytes(ctx context.Context, ip, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	fileInfo := models.FileInfo{
+		ID:       name,
+		FileName: name,
+		Size:     int64(len(data)),
+		FileType: path.Ext(name),
+		SHA256:   hex.EncodeToString(sum[:]),
+	}
+	return sendStream(ctx, ip, fileInfo, bytes.NewReader(data))
+}
+
+// SendReader sends size bytes read from r to the device at ip as a file called name.
+// The content is not hashed up front, so the receiver can't verify it.
+func SendReader(ctx context.Context, ip, name string, r io.Reader, size int64) error {
+	fileInfo := models.FileInfo{
+		ID:       name,
+		FileName: name,
+		Size:     size,
+		FileType: path.Ext(name),
+	}
+	return sendStream(ctx, ip, fileInfo, io.LimitReader(r, size))
+}
+
+// sendStream sends one file without a file on disk, skipping the directory walk of SendFile
+func sendStream(ctx context.Context, ip string, fileInfo models.FileInfo, r io.Reader) error {
+	if fileInfo.FileName == "" {
+		return errors.New("missing file name")
+	}
+	response, err := SendFileToOtherDevicePrepare(ip, map[string]models.FileInfo{fileInfo.ID: fileInfo})
+	if errors.Is(err, errNoTransferNeeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer forgetOutgoingSession(response.SessionID)
+
+	token, ok := response.Files[fileInfo.ID]
+	if !ok {
+		return fmt.Errorf("receiver did not accept %s", fileInfo.FileName)
+	}
+	start := time.Now()
+	size := fileInfo.Size
+	prefix, err := skipAppended(response.SessionID, fileInfo.ID, r, size)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		size -= prefix.Offset
+	}
+	err = uploadStream(ctx, ip, response.SessionID, fileInfo.ID, token, fileInfo.FileName, r, size, prefix)
+	recordHistory(history.DirectionSend, peerAlias(ip), ip, fileInfo.FileName, fileInfo.Size, fileInfo.SHA256, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestCollectSendFilesKeepsTree(t *testing.T) {
+	dir := t.TempDir()
+	photos := filepath.Join(dir, "photos")
+	for _, name := range []string{"a.jpg", "2023/a.jpg", "2024/a.jpg"} {
+		path := filepath.Join(photos, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte(name), 0o644)
+	}
+	os.MkdirAll(filepath.Join(photos, "2025"), 0o755)
+	other := filepath.Join(dir, "a.jpg")
+	os.WriteFile(other, []byte("top"), 0o644)
+
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.PreserveEmptyDirs = true
+	config.ConfigData.SendFilters = nil
+
+	files, entries, err := collectSendFiles([]string{photos, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for id, file := range files {
+		if file.FileName != id {
+			t.Errorf("%s has file name %s", id, file.FileName)
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	// Same-named files in subdirectories keep their paths, the empty directory is kept too
+	want := []string{"2023/a.jpg", "2024/a.jpg", "2025", "a.jpg", "a.jpg/a.jpg"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("got IDs %v, want %v", ids, want)
+	}
+	if files["2025"].FileType != models.DirectoryFileType {
+		t.Errorf("2025 sent as %q", files["2025"].FileType)
+	}
+	if len(entries) != 4 {
+		t.Errorf("got %d uploads, want 4: %+v", len(entries), entries)
+	}
+	for _, entry := range entries {
+		content, _ := os.ReadFile(entry.Path)
+		if entry.ID != "a.jpg/a.jpg" && string(content) != entry.ID {
+			t.Errorf("%s uploads %s", entry.ID, entry.Path)
+		}
+	}
+}
+
+func TestWaitForReappear(t *testing.T) {
+	savedInterval := reconnectPollInterval
+	defer func() { reconnectPollInterval = savedInterval }()
+	reconnectPollInterval = 10 * time.Millisecond
+
+	since := time.Now()
+	shared.DevicesMutex.Lock()
+	// Seen before the connection was lost, it doesn't count
+	shared.DiscoveredDevices["192.0.2.1"] = models.BroadcastMessage{Alias: "Bob", LastSeen: since.Add(-time.Second)}
+	shared.DevicesMutex.Unlock()
+	defer func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, "192.0.2.1")
+		delete(shared.DiscoveredDevices, "192.0.2.2")
+		shared.DevicesMutex.Unlock()
+	}()
+
+	if _, err := waitForReappear("Bob", since, time.Now().Add(50*time.Millisecond)); err == nil {
+		t.Fatal("found a device that was not seen again")
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		shared.DevicesMutex.Lock()
+		shared.DiscoveredDevices["192.0.2.2"] = models.BroadcastMessage{Alias: "bob", LastSeen: time.Now()}
+		shared.DevicesMutex.Unlock()
+	}()
+	ip, err := waitForReappear("Bob", since, time.Now().Add(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.0.2.2" {
+		t.Errorf("got %s, want 192.0.2.2", ip)
+	}
+}
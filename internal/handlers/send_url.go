@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/discovery"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// Timeouts of the download, variables so tests can shorten them
+var (
+	// downloadHeaderTimeout bounds the wait for the response headers
+	downloadHeaderTimeout = 30 * time.Second
+	// downloadIdleTimeout aborts a download that receives no data for this long
+	downloadIdleTimeout = time.Minute
+)
+
+// errDownloadStalled is returned when the download server stops sending data
+var errDownloadStalled = errors.New("download stalled")
+
+// SendURL downloads rawURL and forwards it to the selected device as a file called name,
+// or the last element of the URL path when name is empty. Downloads with a known length
+// are streamed straight through, others are buffered in a temporary file first.
+func SendURL(rawURL, name string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+
+	updates := make(chan []models.SendModel)
+	discovery.ListenAndStartBroadcasts(updates)
+	ip, err := selectTarget(updates)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	RegisterCancelHandler(rawURL, cancel)
+	defer UnregisterCancelHandler(rawURL)
+
+	err = forwardURL(ctx, ip, rawURL, name)
+	if ctx.Err() != nil {
+		return ErrTransferCancelled
+	}
+	return err
+}
+
+// forwardURL downloads rawURL and sends it to ip
+func forwardURL(ctx context.Context, ip, rawURL, name string) error {
+	downloadCtx, stalled := context.WithCancelCause(ctx)
+	defer stalled(nil)
+	request, err := http.NewRequestWithContext(downloadCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	// Redirects are followed (up to 10), the file name comes from the final URL
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 transport.Proxy(),
+		ResponseHeaderTimeout: downloadHeaderTimeout,
+	}}
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+
+	if name == "" {
+		name = nameFromURL(resp.Request.URL)
+	}
+	fileInfo := models.FileInfo{
+		ID:       name,
+		FileName: name,
+		Size:     resp.ContentLength,
+		FileType: path.Ext(name),
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		fileInfo.FileType = mediaType
+	}
+
+	body := newIdleReader(downloadCtx, resp.Body, downloadIdleTimeout, stalled)
+	defer body.Stop()
+	if resp.ContentLength >= 0 {
+		logger.Infof("Forwarding %s (%d bytes) to %s", name, resp.ContentLength, ip)
+		return sendStream(ctx, ip, fileInfo, io.LimitReader(body, resp.ContentLength))
+	}
+	return sendBuffered(ctx, ip, fileInfo, body)
+}
+
+// idleReader cancels the download when no data arrives for timeout. The timer is
+// reset on every read, so slow but steady downloads are not cut off.
+type idleReader struct {
+	ctx     context.Context
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleReader(ctx context.Context, r io.Reader, timeout time.Duration, cancel context.CancelCauseFunc) *idleReader {
+	return &idleReader{
+		ctx:     ctx,
+		r:       r,
+		timeout: timeout,
+		timer:   time.AfterFunc(timeout, func() { cancel(errDownloadStalled) }),
+	}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && errors.Is(context.Cause(r.ctx), errDownloadStalled) {
+		return n, fmt.Errorf("%w: no data for %s", errDownloadStalled, r.timeout)
+	}
+	r.timer.Reset(r.timeout)
+	return n, err
+}
+
+// Stop ends the idle timer once the download is done
+func (r *idleReader) Stop() {
+	r.timer.Stop()
+}
+
+// sendBuffered downloads r of unknown length into a temporary file, then sends it
+func sendBuffered(ctx context.Context, ip string, fileInfo models.FileInfo, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "localsend-url-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	logger.Infof("Downloading %s, the server did not send its size", fileInfo.FileName)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", fileInfo.FileName, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	fileInfo.Size = size
+	fileInfo.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	logger.Infof("Forwarding %s (%d bytes) to %s", fileInfo.FileName, size, ip)
+	return sendStream(ctx, ip, fileInfo, tmp)
+}
+
+// nameFromURL derives a file name from the last element of the URL path
+func nameFromURL(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || name == "" {
+		return "download"
+	}
+	return name
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// fakeReceiver accepts every prepare-upload and keeps the uploaded bodies by file ID
+// and the IDs of cancelled sessions
+type fakeReceiver struct {
+	mu        sync.Mutex
+	prepared  map[string]models.FileInfo
+	uploads   map[string]string
+	cancelled []string
+}
+
+func newFakeReceiver(t *testing.T) (*fakeReceiver, string) {
+	t.Helper()
+	recv := &fakeReceiver{prepared: make(map[string]models.FileInfo), uploads: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/localsend/v2/prepare-upload", func(w http.ResponseWriter, r *http.Request) {
+		var req models.PrepareReceiveRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := models.PrepareReceiveResponse{SessionID: "session", Files: make(map[string]string)}
+		recv.mu.Lock()
+		for id, file := range req.Files {
+			recv.prepared[id] = file
+			resp.Files[id] = "token-" + id
+		}
+		recv.mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/api/localsend/v2/upload", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recv.mu.Lock()
+		recv.uploads[r.URL.Query().Get("fileId")] = string(body)
+		recv.mu.Unlock()
+	})
+	mux.HandleFunc("/api/localsend/v2/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		recv.mu.Lock()
+		recv.cancelled = append(recv.cancelled, r.URL.Query().Get("sessionId"))
+		recv.mu.Unlock()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	host, portText, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	shared.DevicesMutex.Lock()
+	shared.DiscoveredDevices[host] = models.BroadcastMessage{Alias: "recv", Port: port, Protocol: "http"}
+	shared.DevicesMutex.Unlock()
+	t.Cleanup(func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, host)
+		shared.DevicesMutex.Unlock()
+	})
+	return recv, host
+}
+
+func TestForwardURL(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.Quiet = true
+	config.ConfigData.ProgressInterval = 0
+	t.Setenv("HOME", t.TempDir()) // History is written to the home directory
+
+	const content = "hello from the web"
+	download := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if r.URL.Path == "/chunked.txt" {
+			// Flushing before writing forces chunked encoding, the length is unknown
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, content)
+	}))
+	defer download.Close()
+
+	recv, ip := newFakeReceiver(t)
+	for _, name := range []string{"streamed.txt", "chunked.txt"} {
+		if err := forwardURL(context.Background(), ip, download.URL+"/"+name, ""); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		recv.mu.Lock()
+		got, file := recv.uploads[name], recv.prepared[name]
+		recv.mu.Unlock()
+		if got != content {
+			t.Errorf("%s: received %q, want %q", name, got, content)
+		}
+		if file.Size != int64(len(content)) || file.FileType != "text/plain" {
+			t.Errorf("%s: prepared %+v", name, file)
+		}
+	}
+	// Only the buffered download can be hashed before sending
+	if recv.prepared["chunked.txt"].SHA256 == "" {
+		t.Error("buffered download sent without a hash")
+	}
+}
+
+func TestForwardURLStalled(t *testing.T) {
+	saved := config.ConfigData
+	defer func() { config.ConfigData = saved }()
+	config.ConfigData.Quiet = true
+	savedIdle := downloadIdleTimeout
+	defer func() { downloadIdleTimeout = savedIdle }()
+	downloadIdleTimeout = 100 * time.Millisecond
+
+	release := make(chan struct{})
+	download := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer download.Close()
+	defer close(release) // Before Close, which waits for the handler
+
+	_, ip := newFakeReceiver(t)
+	err := forwardURL(context.Background(), ip, download.URL+"/slow", "")
+	if !errors.Is(err, errDownloadStalled) {
+		t.Fatalf("got %v, want %v", err, errDownloadStalled)
+	}
+}
+
+func TestNameFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/files/report.pdf", "report.pdf"},
+		{"https://example.com/files/report.pdf?download=1", "report.pdf"},
+		{"https://example.com/files/", "files"},
+		{"https://example.com/", "download"},
+		{"https://example.com", "download"},
+		{"https://example.com/a%20b.txt", "a b.txt"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := nameFromURL(u); got != tt.want {
+			t.Errorf("nameFromURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
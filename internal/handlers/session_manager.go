@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// ReceiveSession holds the state of one incoming transfer session
+type ReceiveSession struct {
+	ID        string
+	Sender    models.Info
+	Dir       string                     // Directory received files are saved to
+	Files     map[string]models.FileInfo // File ID to metadata
+	Tokens    map[string]string          // File ID to token
+	Received  map[string]bool            // File IDs that were saved successfully
+	Sums      map[string]string          // File ID to SHA256 of the received content
+	CreatedAt time.Time
+
+	Offsets  map[string]models.FileOffset // File ID to the existing content appended to (--receive-mode append)
+	Partials map[string]string            // File ID to the partial file of an interrupted upload it resumes
+
+	ctx     context.Context    // Done when the session is cancelled
+	cancel  context.CancelFunc // Cancels in-flight uploads of the session
+	idle    *time.Timer        // Expires the session, reset by uploads and pings
+	idleFor time.Duration
+
+	mu             sync.Mutex                     // Guards progress, conflictChoice, idle and idleFor
+	progress       map[string]models.FileProgress // File ID to upload progress
+	conflictChoice rune                           // Answer to conflict prompts chosen for the whole session
+}
+
+// newReceiveSession creates an empty session with its own cancellation context
+func newReceiveSession(id string, sender models.Info, dir string) *ReceiveSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ReceiveSession{
+		ID:        id,
+		Sender:    sender,
+		Dir:       dir,
+		Files:     make(map[string]models.FileInfo),
+		Tokens:    make(map[string]string),
+		Received:  make(map[string]bool),
+		Sums:      make(map[string]string),
+		CreatedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+		progress:  make(map[string]models.FileProgress),
+	}
+}
+
+// SetProgress records how much of a file was received and its status
+func (s *ReceiveSession) SetProgress(fileID string, bytesDone int64, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.progress == nil {
+		s.progress = make(map[string]models.FileProgress)
+	}
+	file := s.Files[fileID]
+	s.progress[fileID] = models.FileProgress{
+		ID:         fileID,
+		Name:       file.FileName,
+		BytesDone:  bytesDone,
+		BytesTotal: file.Size,
+		Status:     status,
+	}
+}
+
+// FailProgress marks a file as failed, keeping the bytes received so far
+func (s *ReceiveSession) FailProgress(fileID string) {
+	s.mu.Lock()
+	done := s.progress[fileID].BytesDone
+	s.mu.Unlock()
+	s.SetProgress(fileID, done, models.ProgressError)
+}
+
+// Progress returns the progress of every file of the session, sorted by file ID
+func (s *ReceiveSession) Progress() models.SessionProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := models.SessionProgress{SessionID: s.ID, Files: make([]models.FileProgress, 0, len(s.Files))}
+	for id, file := range s.Files {
+		progress, ok := s.progress[id]
+		if !ok {
+			progress = models.FileProgress{ID: id, Name: file.FileName, BytesTotal: file.Size, Status: models.ProgressPending}
+		}
+		result.Files = append(result.Files, progress)
+		result.TotalBytesDone += progress.BytesDone
+		result.TotalBytesTotal += progress.BytesTotal
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].ID < result.Files[j].ID })
+	return result
+}
+
+// conflictAnswer returns the "Apply to all" answer to conflict prompts, 0 if none
+func (s *ReceiveSession) conflictAnswer() rune {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conflictChoice
+}
+
+// setConflictAnswer answers the remaining conflict prompts of the session
+func (s *ReceiveSession) setConflictAnswer(answer rune) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conflictChoice = answer
+}
+
+// Touch postpones the expiry of an idle session
+func (s *ReceiveSession) Touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.idle != nil {
+		s.idle.Reset(s.idleFor)
+	}
+}
+
+// stopIdle stops the expiry of the session
+func (s *ReceiveSession) stopIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+}
+
+// Context returns a context that is done once the session is cancelled
+func (s *ReceiveSession) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Complete reports whether every file of the session has been received
+func (s *ReceiveSession) Complete() bool {
+	return len(s.Received) >= len(s.Files)
+}
+
+// completedSessionTTL is how long finished sessions are remembered for cancel and progress requests
+const completedSessionTTL = 10 * time.Minute
+
+// CancelResult is the outcome of SessionManager.Cancel
+type CancelResult int
+
+const (
+	SessionNotFound CancelResult = iota
+	SessionCancelled
+	SessionAlreadyCompleted
+)
+
+// SessionManager tracks active receive sessions by session ID
+type SessionManager struct {
+	mu        sync.RWMutex
+	sessions  map[string]*ReceiveSession
+	completed map[string]completedSession // Recently completed sessions
+	waiting   int                         // Requests in AddWaiting
+	freed     chan struct{}               // Closed when a session ends
+	expired   map[string]time.Time        // Recently expired sessions
+}
+
+// Errors of SessionManager.AddWaiting
+var (
+	errSessionQueueFull    = errors.New("session queue is full")
+	errSessionQueueTimeout = errors.New("timed out waiting for a session slot")
+)
+
+// completedSession is a finished session kept for cancel and progress requests
+type completedSession struct {
+	at      time.Time
+	session *ReceiveSession
+}
+
+// NewSessionManager creates an empty session manager
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions:  make(map[string]*ReceiveSession),
+		completed: make(map[string]completedSession),
+		expired:   make(map[string]time.Time),
+	}
+}
+
+// Add registers a session
+func (m *SessionManager) Add(session *ReceiveSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.ID] = session
+}
+
+// TryAdd registers a session unless limit sessions are already active.
+// A limit of zero or less means unlimited.
+func (m *SessionManager) TryAdd(session *ReceiveSession, limit int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if limit > 0 && len(m.sessions) >= limit {
+		return false
+	}
+	m.sessions[session.ID] = session
+	return true
+}
+
+// AddWaiting registers a session, waiting up to timeout for a free slot while limit
+// sessions are active. At most maxWaiting requests wait at once, further ones fail
+// with errSessionQueueFull right away. A limit of zero or less means unlimited.
+func (m *SessionManager) AddWaiting(ctx context.Context, session *ReceiveSession, limit, maxWaiting int, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for limit > 0 && len(m.sessions) >= limit {
+		if m.waiting >= maxWaiting {
+			return errSessionQueueFull
+		}
+		if m.freed == nil {
+			m.freed = make(chan struct{})
+		}
+		freed := m.freed
+		m.waiting++
+		m.mu.Unlock()
+		var err error
+		select {
+		case <-freed:
+		case <-deadline.C:
+			err = errSessionQueueTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		m.mu.Lock()
+		m.waiting--
+		if err != nil {
+			return err
+		}
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+// ExpireIdle expires the session if it sees no upload or ping for timeout, releasing
+// its slot. A timeout of zero or less disables expiry.
+func (m *SessionManager) ExpireIdle(session *ReceiveSession, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.idleFor = timeout
+	session.idle = time.AfterFunc(timeout, func() { m.expire(session) })
+}
+
+// expire cancels and removes an idle session; later uploads get 404
+func (m *SessionManager) expire(session *ReceiveSession) {
+	if TransfersPaused() {
+		// Paused uploads are not idle
+		session.Touch()
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[session.ID] != session {
+		return
+	}
+	if session.cancel != nil {
+		session.cancel()
+	}
+	m.removeLocked(session.ID)
+	now := time.Now()
+	for id, at := range m.expired {
+		if now.Sub(at) > completedSessionTTL {
+			delete(m.expired, id)
+		}
+	}
+	m.expired[session.ID] = now
+	session.mu.Lock()
+	idleFor := session.idleFor
+	session.mu.Unlock()
+	logger.Warnf("Session %s from %s expired after %s without uploads", session.ID, session.Sender.Alias, idleFor)
+}
+
+// Expired reports whether the session was removed recently for being idle
+func (m *SessionManager) Expired(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.expired[sessionID]
+	return ok
+}
+
+// removeLocked deletes a session and wakes the requests in AddWaiting. Must hold m.mu.
+func (m *SessionManager) removeLocked(sessionID string) {
+	if session, ok := m.sessions[sessionID]; ok {
+		session.stopIdle()
+	}
+	delete(m.sessions, sessionID)
+	if m.freed != nil {
+		close(m.freed)
+		m.freed = nil
+	}
+}
+
+// Get returns the session with the given ID
+func (m *SessionManager) Get(sessionID string) (*ReceiveSession, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[sessionID]
+	return session, ok
+}
+
+// Remove deletes the session with the given ID
+func (m *SessionManager) Remove(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(sessionID)
+}
+
+// MarkReceived records that a file was saved with the given SHA256 and removes the
+// session once all files are in. It reports whether this completed the session.
+func (m *SessionManager) MarkReceived(sessionID, fileID, sum string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return false
+	}
+	session.Received[fileID] = true
+	if session.Sums == nil {
+		session.Sums = make(map[string]string)
+	}
+	session.Sums[fileID] = sum
+	if !session.Complete() {
+		return false
+	}
+	m.removeLocked(sessionID)
+	m.markCompleted(session)
+	return true
+}
+
+// markCompleted remembers a completed session and forgets old ones. Must hold m.mu.
+func (m *SessionManager) markCompleted(session *ReceiveSession) {
+	now := time.Now()
+	for id, completed := range m.completed {
+		if now.Sub(completed.at) > completedSessionTTL {
+			delete(m.completed, id)
+		}
+	}
+	m.completed[session.ID] = completedSession{at: now, session: session}
+}
+
+// Lookup returns an active or recently completed session
+func (m *SessionManager) Lookup(sessionID string) (*ReceiveSession, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if session, ok := m.sessions[sessionID]; ok {
+		return session, true
+	}
+	completed, ok := m.completed[sessionID]
+	return completed.session, ok
+}
+
+// Cancel aborts the in-flight uploads of a session and removes it
+func (m *SessionManager) Cancel(sessionID string) CancelResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		if _, done := m.completed[sessionID]; done {
+			return SessionAlreadyCompleted
+		}
+		return SessionNotFound
+	}
+	if session.cancel != nil {
+		session.cancel()
+	}
+	m.removeLocked(sessionID)
+	return SessionCancelled
+}
+
+// Count returns the number of active sessions
+func (m *SessionManager) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+var sessionManager = NewSessionManager()
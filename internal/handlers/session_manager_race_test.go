@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// TestSessionLifecycleConcurrent runs the lifecycle of many sessions at once: each is
+// added, expires or is touched by uploads and pings, reports progress, and ends by
+// completing, being cancelled or removed, or expiring, while other goroutines look
+// sessions up and cancel them. Run with -race, the unsynchronized access it targets
+// rarely fails without it.
+func TestSessionLifecycleConcurrent(t *testing.T) {
+	const workers = 100
+	m := NewSessionManager()
+	dir := t.TempDir()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+
+	completed := make([]bool, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("session-%d", i)
+			session := newReceiveSession(id, models.Info{Alias: "sender"}, dir)
+			session.Files["a"] = models.FileInfo{ID: "a", FileName: "a.txt", Size: 10}
+			session.Files["b"] = models.FileInfo{ID: "b", FileName: "b.txt", Size: 20}
+			<-start
+
+			switch i % 3 {
+			case 0:
+				m.Add(session)
+			case 1:
+				if !m.TryAdd(session, 0) {
+					t.Errorf("%s: TryAdd without limit failed", id)
+					return
+				}
+			case 2:
+				// Waits for a slot while half of the workers hold one
+				if err := m.AddWaiting(context.Background(), session, workers/2, workers, 10*time.Second); err != nil {
+					t.Errorf("%s: %v", id, err)
+					return
+				}
+			}
+			// Short idle timeouts expire some sessions while they are still in use
+			m.ExpireIdle(session, time.Duration(1+i%5)*time.Millisecond)
+
+			for n := int64(0); n < 10; n++ {
+				session.Touch() // Uploads and pings
+				session.SetProgress("a", n, models.ProgressReceiving)
+				session.Progress()
+				m.Get(id)
+				m.Lookup(id)
+				m.Expired(id)
+				m.Count()
+			}
+
+			switch i % 4 {
+			case 0, 1:
+				m.MarkReceived(id, "a", "sum-a")
+				if m.MarkReceived(id, "b", "sum-b") {
+					completed[i] = true
+				}
+			case 2:
+				m.Cancel(id)
+			case 3:
+				m.Remove(id)
+			}
+		}(i)
+	}
+
+	// Other requests ping, look up and cancel sessions they don't own, also right
+	// after the sessions are added
+	stop := make(chan struct{})
+	var others sync.WaitGroup
+	for i := 0; i < workers/10; i++ {
+		others.Add(1)
+		go func(i int) {
+			defer others.Done()
+			<-start
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				id := fmt.Sprintf("session-%d", (i*7+n)%workers)
+				if session, ok := m.Get(id); ok {
+					session.Touch()
+				}
+				if session, ok := m.Lookup(id); ok {
+					session.Progress()
+				}
+				if n%9 == 0 {
+					m.Cancel(id)
+				}
+				m.Count()
+			}
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+	close(stop)
+	others.Wait()
+
+	// Sessions left to expire are gone after their idle timeout
+	for deadline := time.Now().Add(5 * time.Second); m.Count() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d sessions never ended", m.Count())
+		}
+	}
+	for i, done := range completed {
+		if !done {
+			continue
+		}
+		id := fmt.Sprintf("session-%d", i)
+		if _, ok := m.Lookup(id); !ok {
+			t.Errorf("%s: completed session forgotten", id)
+		}
+		if result := m.Cancel(id); result != SessionAlreadyCompleted {
+			t.Errorf("%s: Cancel after completion = %v, want %v", id, result, SessionAlreadyCompleted)
+		}
+	}
+}
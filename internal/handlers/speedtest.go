@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+const (
+	speedtestPayloadSize = 1 << 20  // Payload sent by the sender
+	speedtestMaxSize     = 8 << 20  // Largest payload the receiver accepts
+	speedtestMinFileSize = 10 << 20 // Smaller sends are not worth measuring
+
+	minUploadBufferSize     = 32 << 10
+	maxUploadBufferSize     = 4 << 20
+	defaultUploadBufferSize = minUploadBufferSize
+)
+
+// uploadTuning holds the result of the pre-transfer speed test
+type uploadTuning struct {
+	BytesPerSecond float64 // Measured throughput, 0 if unknown
+	BufferSize     int     // Copy buffer size for uploads
+}
+
+// currentTuning is set by SendFile before the uploads start
+var currentTuning = uploadTuning{BufferSize: defaultUploadBufferSize}
+
+// estimate returns the expected transfer time of size bytes, or 0 if unknown
+func (t uploadTuning) estimate(size int64) time.Duration {
+	if t.BytesPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(size) / t.BytesPerSecond * float64(time.Second))
+}
+
+// SpeedtestHandler reads and discards the request body so the sender can measure throughput
+func SpeedtestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(r.Body, speedtestMaxSize+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "read_failed", "Failed to read body")
+		return
+	}
+	if n > speedtestMaxSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "payload_too_large", "Payload too large")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// runSpeedtest sends a random payload to the receiver and derives upload settings from the round trip
+func runSpeedtest(ip string) (uploadTuning, error) {
+	payload := make([]byte, speedtestPayloadSize)
+	if _, err := rand.Read(payload); err != nil {
+		return uploadTuning{}, fmt.Errorf("error generating payload: %w", err)
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: transport.RoundTripper(&http.Transport{
+			TLSClientConfig:    peerTLSConfig(ip),
+			DisableCompression: true,
+		}),
+	}
+
+	start := time.Now()
+	resp, err := client.Post(peerBaseURL(ip)+"/api/localsend/v2/speedtest", "application/octet-stream", bytes.NewReader(payload))
+	if err != nil {
+		return uploadTuning{}, fmt.Errorf("error sending speed test: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return uploadTuning{}, fmt.Errorf("speed test failed: received status code %d", resp.StatusCode)
+	}
+
+	elapsed := time.Since(start)
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	bytesPerSecond := float64(len(payload)) / elapsed.Seconds()
+	return uploadTuning{
+		BytesPerSecond: bytesPerSecond,
+		BufferSize:     bufferSizeFor(bytesPerSecond),
+	}, nil
+}
+
+// bufferSizeFor sizes the copy buffer to about 10ms of data at the measured speed
+func bufferSizeFor(bytesPerSecond float64) int {
+	size := int(bytesPerSecond / 100)
+	// Round down to a power of two
+	buf := minUploadBufferSize
+	for buf*2 <= size && buf < maxUploadBufferSize {
+		buf *= 2
+	}
+	return buf
+}
+
+// autoTune runs the speed test when --auto-tune is set and the send is large enough
+func autoTune(ip string, totalSize int64) uploadTuning {
+	tuning := uploadTuning{BufferSize: defaultUploadBufferSize}
+	if totalSize < speedtestMinFileSize {
+		logger.Debug("Skipping speed test for small transfer")
+		return tuning
+	}
+
+	measured, err := runSpeedtest(ip)
+	if err != nil {
+		logger.Warnf("Speed test failed, using default settings: %v", err)
+		return tuning
+	}
+	logger.Infof("Measured bandwidth: %.1f Mbps, buffer size %d KiB, estimated time %s",
+		measured.BytesPerSecond*8/1e6, measured.BufferSize>>10, measured.estimate(totalSize).Round(time.Second))
+	return measured
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/certificate"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/sha256"
+)
+
+// Conflict policies for files that differ on both sides (--conflict-policy)
+const (
+	ConflictNewerWins  = "newer-wins"
+	ConflictLocalWins  = "local-wins"
+	ConflictRemoteWins = "remote-wins"
+	ConflictSkip       = "skip"
+)
+
+// syncPlan lists what needs to move in each direction
+type syncPlan struct {
+	Send      []models.SyncEntry // Local files the peer is missing or loses the conflict on
+	Fetch     []string           // Remote files we are missing or lose the conflict on
+	Conflicts int
+}
+
+// listSyncFiles walks dir and describes every regular file in it
+func listSyncFiles(dir string) ([]models.SyncEntry, error) {
+	var entries []models.SyncEntry
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Files still being received are not listed
+		if !info.Mode().IsRegular() || strings.Contains(info.Name(), receiveTempMarker) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := sha256.CalculateSHA256(path)
+		if err != nil {
+			return fmt.Errorf("error calculating SHA256 hash: %w", err)
+		}
+		entries = append(entries, models.SyncEntry{
+			Name:    filepath.ToSlash(rel),
+			SHA256:  sum,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking the path: %w", err)
+	}
+	return entries, nil
+}
+
+// planSync compares both file lists and resolves conflicts with policy
+func planSync(local, remote []models.SyncEntry, policy string) syncPlan {
+	remoteByName := make(map[string]models.SyncEntry, len(remote))
+	for _, entry := range remote {
+		remoteByName[entry.Name] = entry
+	}
+
+	var plan syncPlan
+	seen := make(map[string]bool, len(local))
+	for _, entry := range local {
+		seen[entry.Name] = true
+		theirs, ok := remoteByName[entry.Name]
+		if !ok {
+			plan.Send = append(plan.Send, entry)
+			continue
+		}
+		if strings.EqualFold(theirs.SHA256, entry.SHA256) {
+			continue
+		}
+
+		plan.Conflicts++
+		switch policy {
+		case ConflictLocalWins:
+			plan.Send = append(plan.Send, entry)
+		case ConflictRemoteWins:
+			plan.Fetch = append(plan.Fetch, entry.Name)
+		case ConflictSkip:
+			logger.Warnf("Skipping %s: differs on both sides", entry.Name)
+		default:
+			if entry.ModTime.After(theirs.ModTime) {
+				plan.Send = append(plan.Send, entry)
+			} else if theirs.ModTime.After(entry.ModTime) {
+				plan.Fetch = append(plan.Fetch, entry.Name)
+			} else {
+				logger.Warnf("Skipping %s: differs on both sides with the same modification time", entry.Name)
+			}
+		}
+	}
+	for _, entry := range remote {
+		if !seen[entry.Name] {
+			plan.Fetch = append(plan.Fetch, entry.Name)
+		}
+	}
+	return plan
+}
+
+// syncDir is the directory a peer syncs against: the receive directory, served with --allow-sync
+func syncDir() string {
+	return config.ConfigData.ReceiveDir
+}
+
+// SyncListHandler returns the files of the sync directory (GET /api/localsend/v2/sync/list)
+func SyncListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !config.ConfigData.AllowSync {
+		writeJSONError(w, http.StatusForbidden, "sync_disabled", "Sync is disabled")
+		return
+	}
+
+	entries, err := listSyncFiles(syncDir())
+	if err != nil && !os.IsNotExist(err) {
+		logger.Errorf("Failed to list sync files: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "list_failed", "Failed to list files")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SyncFileList{Files: entries})
+}
+
+// SyncPullHandler sends the requested files back to the requester (POST /api/localsend/v2/sync/pull).
+// It answers once all files were sent.
+func SyncPullHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !config.ConfigData.AllowSync {
+		writeJSONError(w, http.StatusForbidden, "sync_disabled", "Sync is disabled")
+		return
+	}
+
+	var req models.SyncPullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", "Invalid request body")
+		return
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_address", "Invalid remote address")
+		return
+	}
+
+	entries, err := listSyncFiles(syncDir())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "list_failed", "Failed to list files")
+		return
+	}
+	byName := make(map[string]models.SyncEntry, len(entries))
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+	var wanted []models.SyncEntry
+	for _, name := range req.Files {
+		entry, ok := byName[name]
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "unknown_file", fmt.Sprintf("Unknown file: %s", name))
+			return
+		}
+		wanted = append(wanted, entry)
+	}
+
+	// Reach the requester on the port its server listens on
+	rememberPeer(ip, models.BroadcastMessage{Port: req.Port, Protocol: req.Protocol})
+	logger.Infof("Sync: sending %d file(s) to %s", len(wanted), ip)
+	if err := sendSyncFiles(r.Context(), ip, syncDir(), wanted); err != nil {
+		logger.Errorf("Sync to %s failed: %v", ip, err)
+		writeJSONError(w, http.StatusInternalServerError, "sync_failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// rememberPeer records the port and protocol, and if known the alias and fingerprint,
+// of a peer that was not discovered
+func rememberPeer(ip string, device models.BroadcastMessage) {
+	if device.Port <= 0 {
+		return
+	}
+	shared.DevicesMutex.Lock()
+	defer shared.DevicesMutex.Unlock()
+	if _, ok := shared.DiscoveredDevices[ip]; ok {
+		return
+	}
+	device.LastSeen = time.Now()
+	shared.DiscoveredDevices[ip] = device
+}
+
+// sendSyncFiles sends entries of dir in one session, keeping their relative paths
+func sendSyncFiles(ctx context.Context, ip, dir string, entries []models.SyncEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	files := make(map[string]models.FileInfo, len(entries))
+	for _, entry := range entries {
+		files[entry.Name] = models.FileInfo{
+			ID:       entry.Name,
+			FileName: entry.Name,
+			Size:     entry.Size,
+			FileType: filepath.Ext(entry.Name),
+			SHA256:   entry.SHA256,
+		}
+	}
+
+	response, err := SendFileToOtherDevicePrepare(ip, files)
+	if err != nil {
+		return err
+	}
+	defer forgetOutgoingSession(response.SessionID)
+
+	for _, entry := range entries {
+		token, ok := response.Files[entry.Name]
+		if !ok {
+			logger.Warnf("Sync: %s was not accepted by the peer", entry.Name)
+			continue
+		}
+		if err := uploadFile(ctx, ip, response.SessionID, entry.Name, token, filepath.Join(dir, filepath.FromSlash(entry.Name))); err != nil {
+			return fmt.Errorf("error uploading %s: %w", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// syncClient is used for the sync list and pull requests to ip
+func syncClient(ip string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: transport.RoundTripper(&http.Transport{
+			TLSClientConfig: peerTLSConfig(ip),
+		}),
+	}
+}
+
+// fetchRemoteFiles gets the file list of the peer
+func fetchRemoteFiles(ip string) ([]models.SyncEntry, error) {
+	resp, err := syncClient(ip, 5*time.Minute).Get(peerBaseURL(ip) + apiPath(defaultVersion, "sync/list"))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching file list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("peer does not allow sync (start it with --allow-sync)")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch file list: received status code %d", resp.StatusCode)
+	}
+	var list models.SyncFileList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("error decoding file list: %w", err)
+	}
+	return list.Files, nil
+}
+
+// requestFiles asks the peer to send names to us and waits until it is done
+func requestFiles(ip string, names []string) error {
+	body, err := json.Marshal(models.SyncPullRequest{
+		Files:    names,
+		Port:     shared.Message.Port,
+		Protocol: shared.Message.Protocol,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := syncClient(ip, 0).Post(peerBaseURL(ip)+apiPath(defaultVersion, "sync/pull"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error requesting files: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer failed to send files: received status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// probePeer finds out whether an undiscovered peer serves http or https on port
+func probePeer(ip string, port int) error {
+	shared.DevicesMutex.RLock()
+	_, known := shared.DiscoveredDevices[ip]
+	shared.DevicesMutex.RUnlock()
+	if known {
+		return nil
+	}
+
+	client := syncClient(ip, 5*time.Second)
+	for _, protocol := range []string{"http", "https"} {
+		url := fmt.Sprintf("%s://%s%s", protocol, net.JoinHostPort(ip, strconv.Itoa(port)), apiPath(defaultVersion, "info"))
+		resp, err := client.Get(url)
+		if err != nil {
+			continue
+		}
+		var info models.BroadcastMessage
+		json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		// The certificate of the connection must be the one of the fingerprint the peer
+		// answered with, later connections are checked against it
+		if resp.TLS != nil && (len(resp.TLS.PeerCertificates) == 0 ||
+			!strings.EqualFold(certificate.Fingerprint(resp.TLS.PeerCertificates[0].Raw), info.Fingerprint)) {
+			return fmt.Errorf("%w: %s answered with fingerprint %s", errCertificateMismatch, ip, info.Fingerprint)
+		}
+		rememberPeer(ip, models.BroadcastMessage{Alias: info.Alias, Fingerprint: info.Fingerprint, Port: port, Protocol: protocol})
+		return nil
+	}
+	return fmt.Errorf("no LocalSend server found at %s", net.JoinHostPort(ip, strconv.Itoa(port)))
+}
+
+// Sync exchanges files between dir and the peer's receive directory: each side gets
+// the files it is missing, files that differ on both sides are resolved with policy.
+// Received files are written to dir.
+func Sync(ip string, port int, dir, policy string) error {
+	switch policy {
+	case ConflictNewerWins, ConflictLocalWins, ConflictRemoteWins, ConflictSkip:
+	default:
+		return fmt.Errorf("unknown conflict policy %q", policy)
+	}
+	if err := probePeer(ip, port); err != nil {
+		return err
+	}
+
+	local, err := listSyncFiles(dir)
+	if err != nil {
+		return err
+	}
+	remote, err := fetchRemoteFiles(ip)
+	if err != nil {
+		return err
+	}
+
+	plan := planSync(local, remote, policy)
+	logger.Infof("Sync with %s: %d to send, %d to fetch, %d conflict(s)", ip, len(plan.Send), len(plan.Fetch), plan.Conflicts)
+
+	if err := sendSyncFiles(context.Background(), ip, dir, plan.Send); err != nil {
+		return err
+	}
+	if len(plan.Fetch) > 0 {
+		// Files sent back by the peer land in dir
+		config.ConfigData.ReceiveDir = dir
+		if err := requestFiles(ip, plan.Fetch); err != nil {
+			return err
+		}
+	}
+	logger.Success("Sync complete")
+	return nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// receiveTempMarker is part of the names of files being received, e.g.
+// photo.jpg.localsend-tmp-1x2y3z. They are renamed once complete and verified.
+const receiveTempMarker = ".localsend-tmp-"
+
+// partialFile writes a received file next to its destination. Close moves it into
+// place, abort deletes it, so the destination never holds a partial upload.
+type partialFile struct {
+	*os.File
+	path string // Destination
+	done bool
+}
+
+// createPartialFile creates the temp file for path in the same directory, so the
+// final rename does not cross file systems
+func createPartialFile(path string) (*partialFile, error) {
+	for range 10 {
+		name := path + receiveTempMarker + strconv.FormatUint(rand.Uint64(), 36)
+		// Same mode as os.Create, the umask applies
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &partialFile{File: file, path: path}, nil
+	}
+	return nil, errors.New("could not create a temp file for " + path)
+}
+
+// Close completes the file: it is renamed to its destination, replacing any file there
+func (f *partialFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	err := f.File.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// abort deletes the partial file, the destination is left as it was
+func (f *partialFile) abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// RemoveStaleTempFiles deletes partial files left in dirs by a receive that was killed
+// or crashed, and returns how many it deleted. Missing directories are skipped.
+func RemoveStaleTempFiles(dirs ...string) (int, error) {
+	removed := 0
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && path == dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() || !strings.Contains(d.Name(), receiveTempMarker) {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				logger.Warnf("Failed to remove temp file %s: %v", path, err)
+				return nil
+			}
+			logger.Infof("Removed temp file %s from an interrupted transfer", path)
+			removed++
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
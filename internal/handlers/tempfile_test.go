@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "a.txt")
+	os.WriteFile(dest, []byte("old"), 0o644)
+
+	aborted, err := createPartialFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aborted.WriteString("partial")
+	aborted.abort()
+	if data, _ := os.ReadFile(dest); string(data) != "old" {
+		t.Errorf("aborted upload changed the destination: %q", data)
+	}
+
+	file, err := createPartialFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("new")
+	if data, _ := os.ReadFile(dest); string(data) != "old" {
+		t.Errorf("destination changed before Close: %q", data)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.abort() // After Close, as the receive handler's deferred cleanup does
+	if data, _ := os.ReadFile(dest); string(data) != "new" {
+		t.Errorf("got %q after Close, want new", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temp files left: %v", entries)
+	}
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+	for _, name := range []string{"keep.txt", "a.txt" + receiveTempMarker + "1", "sub/b.jpg" + receiveTempMarker + "2"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+
+	removed, err := RemoveStaleTempFiles(dir, filepath.Join(dir, "missing"))
+	if err != nil || removed != 2 {
+		t.Fatalf("RemoveStaleTempFiles() = %d, %v, want 2", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keep.txt")); err != nil {
+		t.Error(err)
+	}
+}
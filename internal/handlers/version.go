@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// supportedVersions are the protocol versions this client speaks, highest first
+var supportedVersions = []string{"2.0", legacyVersion}
+
+// defaultVersion is assumed for peers that don't advertise their versions
+const defaultVersion = "2.0"
+
+// legacyVersion is the protocol of older LocalSend apps: it has no session IDs, a
+// device sends one session at a time
+const legacyVersion = "1.0"
+
+// legacyEndpoints are the v1 names of endpoints that were renamed in v2
+var legacyEndpoints = map[string]string{
+	"prepare-upload": "send-request",
+	"upload":         "send",
+}
+
+// outgoingSession holds what was negotiated with the receiver of a send
+type outgoingSession struct {
+	Version     string
+	Compression string                       // Content encoding for uploads, empty for none
+	Offsets     map[string]models.FileOffset // File ID to the data the receiver already has
+}
+
+var (
+	outgoingSessions = make(map[string]outgoingSession) // Session ID to negotiated settings (send side)
+	sessionsLock     sync.RWMutex
+)
+
+// majorVersion returns the part of a version before the first dot
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
+
+// negotiateVersion picks the highest supported version whose major version the peer
+// also supports. Returns "" if there is none.
+func negotiateVersion(peer []string) string {
+	if len(peer) == 0 {
+		peer = []string{defaultVersion}
+	}
+	for _, ours := range supportedVersions {
+		for _, theirs := range peer {
+			if majorVersion(ours) == majorVersion(theirs) {
+				return ours
+			}
+		}
+	}
+	return ""
+}
+
+// apiPath returns the path of an endpoint for a protocol version, e.g. /api/localsend/v2/upload
+func apiPath(version, endpoint string) string {
+	if version == "" {
+		version = defaultVersion
+	}
+	if legacy, ok := legacyEndpoints[endpoint]; ok && isLegacy(version) {
+		endpoint = legacy
+	}
+	return "/api/localsend/v" + majorVersion(version) + "/" + endpoint
+}
+
+// isLegacy reports whether version is protocol v1
+func isLegacy(version string) bool {
+	return majorVersion(version) == majorVersion(legacyVersion)
+}
+
+// peerVersion returns the protocol version to talk to ip in: v1 for devices that
+// announced a 1.x version, else v2
+func peerVersion(ip string) string {
+	shared.DevicesMutex.RLock()
+	defer shared.DevicesMutex.RUnlock()
+	if isLegacy(shared.DiscoveredDevices[ip].Version) {
+		return legacyVersion
+	}
+	return defaultVersion
+}
+
+// setOutgoingSession records the settings negotiated for an outgoing session
+func setOutgoingSession(sessionID string, session outgoingSession) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	outgoingSessions[sessionID] = session
+}
+
+// forgetOutgoingSession drops the settings of a finished outgoing session
+func forgetOutgoingSession(sessionID string) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	delete(outgoingSessions, sessionID)
+}
+
+// getOutgoingSession returns the negotiated settings of an outgoing session
+func getOutgoingSession(sessionID string) outgoingSession {
+	sessionsLock.RLock()
+	defer sessionsLock.RUnlock()
+	return outgoingSessions[sessionID]
+}
+
+// sessionAPIPath returns the endpoint path for an outgoing session's negotiated version
+func sessionAPIPath(sessionID, endpoint string) string {
+	return apiPath(getOutgoingSession(sessionID).Version, endpoint)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// sendWalker walks a send path like filepath.Walk, following symlinks with
+// --follow-symlinks and skipping directories it has already visited
+type sendWalker struct {
+	fn     filepath.WalkFunc
+	warn   bool
+	inodes map[uint64]struct{} // Visited directories, on systems with inodes
+	paths  map[string]struct{} // Visited directories elsewhere, by resolved path
+}
+
+// walkSendPath calls fn for every file and directory under root. Symlinks below root
+// are skipped unless --follow-symlinks is set; warn logs the skipped ones.
+func walkSendPath(root string, warn bool, fn filepath.WalkFunc) error {
+	w := &sendWalker{
+		fn:     fn,
+		warn:   warn,
+		inodes: make(map[uint64]struct{}),
+		paths:  make(map[string]struct{}),
+	}
+	// A symlink given on the command line is always followed
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		return w.walk(root, resolved)
+	}
+	return w.walk(root, root)
+}
+
+// walk walks the real directory dir, reporting its entries under the path logical
+func (w *sendWalker) walk(logical, dir string) error {
+	return filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if rel, relErr := filepath.Rel(dir, filePath); relErr == nil {
+			filePath = filepath.Join(logical, rel)
+		}
+		if err != nil {
+			return w.fn(filePath, info, err)
+		}
+		if info.IsDir() {
+			w.visit(filePath, info)
+			return w.fn(filePath, info, nil)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return w.fn(filePath, info, nil)
+		}
+
+		if !config.ConfigData.FollowSymlinks {
+			w.warnf("Skipping symlink %s (use --follow-symlinks to follow it)", filePath)
+			return nil
+		}
+		target, err := os.Stat(filePath)
+		if err != nil {
+			w.warnf("Skipping broken symlink %s: %v", filePath, err)
+			return nil
+		}
+		if !target.IsDir() {
+			return w.fn(filePath, target, nil)
+		}
+		if w.visited(filePath, target) {
+			w.warnf("Skipping symlink %s: directory already visited (symlink cycle?)", filePath)
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(filePath)
+		if err != nil {
+			w.warnf("Skipping symlink %s: %v", filePath, err)
+			return nil
+		}
+		return w.walk(filePath, resolved)
+	})
+}
+
+// visit marks a directory as visited
+func (w *sendWalker) visit(path string, info os.FileInfo) {
+	if ino, ok := inode(info); ok {
+		w.inodes[ino] = struct{}{}
+		return
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		w.paths[resolved] = struct{}{}
+	}
+}
+
+// visited reports whether the directory at path was already walked
+func (w *sendWalker) visited(path string, info os.FileInfo) bool {
+	if ino, ok := inode(info); ok {
+		_, seen := w.inodes[ino]
+		return seen
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	_, seen := w.paths[resolved]
+	return seen
+}
+
+func (w *sendWalker) warnf(format string, args ...interface{}) {
+	if w.warn {
+		logger.Warnf(format, args...)
+	}
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/webhook"
+)
+
+// notifyWebhooks posts a received file to every --webhook-url in the background
+func notifyWebhooks(payload webhook.WebhookPayload) {
+	for _, url := range config.ConfigData.WebhookURLs {
+		go func(url string) {
+			if err := webhook.Notify(context.Background(), url, payload); err != nil {
+				logger.Warnf("Webhook %s failed: %v", url, err)
+			}
+		}(url)
+	}
+}
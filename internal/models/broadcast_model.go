@@ -13,4 +13,13 @@ type BroadcastMessage struct {
 	Download    bool      `json:"download"`    // 是否支持下载API
 	Announce    bool      `json:"announce"`    // 是否广播自己的存在
 	LastSeen    time.Time `json:"-"`           // 最后一次发现时间 (本地使用)
+
+	// External address mapped with --upnp, e.g. "1.2.3.4:53317"
+	ExternalAddress string `json:"externalAddress,omitempty"`
+	OS              string `json:"os,omitempty"`       // runtime.GOOS of the device
+	GOArch          string `json:"goarch,omitempty"`   // runtime.GOARCH of the device
+	QUICPort        int    `json:"quicPort,omitempty"` // UDP port of the HTTP/3 server with --transport quic
+
+	// Interface addresses of the device, the sender picks the one it reaches best
+	Addresses []string `json:"addresses,omitempty"`
 }
@@ -1,5 +1,8 @@
 package models
 
+// DirectoryFileType marks an empty directory entry, sent with --preserve-empty-dirs
+const DirectoryFileType = "application/x-directory"
+
 type FileInfo struct {
 	ID       string `json:"id"`
 	FileName string `json:"fileName"`
@@ -7,4 +10,14 @@ type FileInfo struct {
 	FileType string `json:"fileType"`
 	SHA256   string `json:"sha256,omitempty"`
 	Preview  string `json:"preview,omitempty"`
+	// Unix permission bits of the sent file, applied with --preserve-permissions
+	Permissions uint32 `json:"permissions,omitempty"`
+
+	Metadata *FileMetadata `json:"metadata,omitempty"`
+}
+
+// FileMetadata holds optional file timestamps, as RFC 3339 strings
+type FileMetadata struct {
+	Modified string `json:"modified,omitempty"`
+	Accessed string `json:"accessed,omitempty"`
 }
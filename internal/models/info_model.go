@@ -9,4 +9,9 @@ type Info struct {
 	Port        int    `json:"port"`
 	Protocol    string `json:"protocol"`
 	Download    bool   `json:"download"`
+	// Content encodings the device can send and receive, e.g. ["zstd", "gzip"]
+	AcceptsCompression []string `json:"acceptsCompression,omitempty"`
+	// Optional platform of the device, e.g. "linux" and "amd64"
+	OS     string `json:"os,omitempty"`
+	GOArch string `json:"goarch,omitempty"`
 }
@@ -1,11 +1,21 @@
 package models
 
 type PrepareReceiveRequest struct {
-	Info  Info                `json:"info"`
-	Files map[string]FileInfo `json:"files"`
+	Info              Info                `json:"info"`
+	Files             map[string]FileInfo `json:"files"`
+	SupportedVersions []string            `json:"supportedVersions,omitempty"` // Protocol versions of the sender, highest first
 }
 
 type PrepareReceiveResponse struct {
-	SessionID string            `json:"sessionId"`
-	Files     map[string]string `json:"files"` // File ID to Token map
+	SessionID         string                `json:"sessionId"`
+	Files             map[string]string     `json:"files"`                       // File ID to Token map
+	NegotiatedVersion string                `json:"negotiatedVersion,omitempty"` // Protocol version used for the session
+	Compression       string                `json:"compression,omitempty"`       // Encoding the receiver accepts for uploads
+	Offsets           map[string]FileOffset `json:"offsets,omitempty"`           // File ID to the data the receiver already has (--receive-mode append, resumed uploads)
+}
+
+// FileOffset is the existing content of a file the receiver appends to
+type FileOffset struct {
+	Offset  int64 `json:"offset"`            // Size of the existing file, the upload starts here
+	Partial bool  `json:"partial,omitempty"` // Kept from an interrupted upload, the sender may start over
 }
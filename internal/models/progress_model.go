@@ -0,0 +1,26 @@
+package models
+
+// File progress states
+const (
+	ProgressPending   = "pending"
+	ProgressReceiving = "receiving"
+	ProgressDone      = "done"
+	ProgressError     = "error"
+)
+
+// FileProgress is the progress of one file in a receive session
+type FileProgress struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	BytesDone  int64  `json:"bytes_done"`
+	BytesTotal int64  `json:"bytes_total"`
+	Status     string `json:"status"`
+}
+
+// SessionProgress is the response of GET /api/localsend/v2/progress
+type SessionProgress struct {
+	SessionID       string         `json:"session_id"`
+	Files           []FileProgress `json:"files"`
+	TotalBytesDone  int64          `json:"total_bytes_done"`
+	TotalBytesTotal int64          `json:"total_bytes_total"`
+}
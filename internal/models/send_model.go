@@ -4,4 +4,5 @@ package models
 type SendModel struct {
 	DeviceName string
 	IP         string
+	Addresses  []string // Addresses the device advertised, see discovery.PreferredAddresses
 }
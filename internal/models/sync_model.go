@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// SyncEntry describes one file of a synced directory
+type SyncEntry struct {
+	Name    string    `json:"name"` // Path relative to the synced directory, slash separated
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// SyncFileList is returned by the sync list endpoint
+type SyncFileList struct {
+	Files []SyncEntry `json:"files"`
+}
+
+// SyncPullRequest asks a peer to send the named files back to the requester
+type SyncPullRequest struct {
+	Files    []string `json:"files"`
+	Port     int      `json:"port"`
+	Protocol string   `json:"protocol"`
+}
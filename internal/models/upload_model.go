@@ -0,0 +1,9 @@
+package models
+
+// UploadStats is returned by the receiver after a file upload completes
+type UploadStats struct {
+	BytesReceived  int64   `json:"bytes_received"`
+	DurationMs     int64   `json:"duration_ms"`
+	SpeedMbps      float64 `json:"speed_mbps"`
+	SHA256Verified bool    `json:"sha256_verified"`
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// listenDualStack listens on port for IPv4 and IPv6. ":port" is a single dual-stack
+// socket where the system supports IPv4-mapped addresses; otherwise it only covers
+// IPv4 and a separate IPv6 socket is added when IPv6 is available.
+func listenDualStack(port int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	if addr, ok := ln.Addr().(*net.TCPAddr); !ok || addr.IP.To4() == nil {
+		return ln, nil // Dual-stack
+	}
+	ln6, err := net.Listen("tcp6", net.JoinHostPort("::", fmt.Sprint(port)))
+	if err != nil {
+		return ln, nil // No IPv6, serve IPv4 only
+	}
+	return newMultiListener(ln, ln6), nil
+}
+
+// multiListener accepts connections from several listeners. Addr reports the first one.
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(listeners ...net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		conns:     make(chan acceptResult),
+		done:      make(chan struct{}),
+	}
+	for _, ln := range listeners {
+		go m.serve(ln)
+	}
+	return m
+}
+
+// serve forwards the connections of one listener until it fails
+func (m *multiListener) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		select {
+		case m.conns <- acceptResult{conn, err}:
+		case <-m.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-m.conns:
+		return result.conn, result.err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, ln := range m.listeners {
+			if closeErr := ln.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
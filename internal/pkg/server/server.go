@@ -1,7 +1,93 @@
 package server
 
-import "net/http"
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// maxAutoPort is the last port tried when automatic port selection is enabled
+const maxAutoPort = 53377
 
 func New() *http.ServeMux {
 	return http.NewServeMux()
 }
+
+// Timeouts bound how long the HTTP server waits for a client, zero disables one
+type Timeouts struct {
+	Read  time.Duration // Reading a request, headers and body
+	Write time.Duration // From the end of the request headers to the end of the response
+	Idle  time.Duration // Between requests on a keep-alive connection
+}
+
+// NewHTTPServer returns a server for handler with timeouts. The read timeout is not
+// set on the server: http.Server would also use it as the idle timeout when that is
+// zero, closing keep-alive connections that should stay open. It bounds the request
+// headers, and the body through a deadline set before handler runs, which uploads
+// extend while data arrives.
+func NewHTTPServer(handler http.Handler, timeouts Timeouts) *http.Server {
+	if timeouts.Read > 0 {
+		handler = readDeadline(handler, timeouts.Read)
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: timeouts.Read,
+		WriteTimeout:      timeouts.Write,
+		IdleTimeout:       timeouts.Idle,
+	}
+}
+
+// readDeadline gives next timeout to read the request body
+func readDeadline(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fails with http.ErrNotSupported over HTTP/3, which has its own idle timeout
+		http.NewResponseController(w).SetReadDeadline(time.Now().Add(timeout))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LoopbackOnly rejects requests that don't come from this machine before they reach
+// next
+func LoopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Listen opens a TCP listener on port for both IPv4 and IPv6. With autoPort, the following ports up to
+// maxAutoPort are tried while the address is already in use.
+func Listen(port int, autoPort bool) (net.Listener, error) {
+	last := port
+	if autoPort && maxAutoPort > port {
+		last = maxAutoPort
+	}
+
+	var err error
+	for p := port; p <= last; p++ {
+		var ln net.Listener
+		ln, err = listenDualStack(p)
+		if err == nil {
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Port returns the TCP port a listener is bound to
+func Port(ln net.Listener) int {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
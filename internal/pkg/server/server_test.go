@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoopbackOnly(t *testing.T) {
+	handler := LoopbackOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := map[string]int{
+		"127.0.0.1:40000":   http.StatusNoContent,
+		"[::1]:40000":       http.StatusNoContent,
+		"192.168.1.5:40000": http.StatusForbidden,
+		"[fe80::1]:40000":   http.StatusForbidden,
+		"garbage":           http.StatusForbidden,
+	}
+	for remote, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/localsend/v2/info", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: got %d, want %d", remote, rec.Code, want)
+		}
+	}
+}
+
+// TestIdleTimeoutIndependentOfRead checks that a keep-alive connection outlives the
+// read timeout when no idle timeout is set, while a stalled body still times out
+func TestIdleTimeoutIndependentOfRead(t *testing.T) {
+	const readTimeout = 100 * time.Millisecond
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), Timeouts{Read: readTimeout})
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	request := func(body string, length int) int {
+		t.Helper()
+		fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: %d\r\n\r\n%s", length, body)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := request("ok", 2); code != http.StatusNoContent {
+		t.Fatalf("first request: %d", code)
+	}
+	time.Sleep(3 * readTimeout)
+	if code := request("ok", 2); code != http.StatusNoContent {
+		t.Fatalf("request after idling: %d", code)
+	}
+	if code := request("short", 10); code != http.StatusRequestTimeout {
+		t.Errorf("stalled body: %d, want %d", code, http.StatusRequestTimeout)
+	}
+}
@@ -0,0 +1,359 @@
+// Package relay forwards LocalSend connections between peers that can't reach each
+// other directly. Both peers open WebSocket connections to the relay, which pairs a
+// sender's connection with one a receiver left waiting in its room and copies bytes
+// between them. The peers speak TLS over the bridged connection, so the relay only
+// sees encrypted data. As between LocalSend peers, the self-signed certificate is not
+// verified: this keeps a passive relay from reading transfers, not an active one.
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// DefaultAddr is where the relay command listens without --relay-listen
+	DefaultAddr = ":53319"
+
+	pathPrefix = "/relay/"
+	roleListen = "listen" // Receivers waiting for a sender
+	roleDial   = "dial"   // Senders
+	// paired is written to both ends once a sender is matched with a receiver
+	paired = 1
+	// pairTimeout is how long a sender waits for a free receiver connection
+	pairTimeout = 10 * time.Second
+	// maxWaiting limits the waiting connections per room
+	maxWaiting = 16
+)
+
+var (
+	// ErrNoReceiver is returned when no receiver waits in the room
+	ErrNoReceiver = errors.New("no receiver connected to the relay")
+	errNotPaired  = errors.New("relay closed the connection before pairing")
+)
+
+// waiter is a receiver connection waiting for a sender
+type waiter struct {
+	conn    *websocket.Conn
+	partner chan *websocket.Conn
+	done    chan struct{}
+}
+
+// Server pairs connections by room
+type Server struct {
+	mu      sync.Mutex
+	rooms   map[string][]*waiter
+	changed chan struct{} // Closed and replaced when a receiver starts waiting
+}
+
+// NewServer returns a relay server, an http.Handler for the relay path
+func NewServer() *Server {
+	return &Server{rooms: make(map[string][]*waiter), changed: make(chan struct{})}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	room, ok := strings.CutPrefix(r.URL.Path, pathPrefix)
+	role := r.URL.Query().Get("role")
+	if !ok || room == "" || (role != roleListen && role != roleDial) {
+		http.NotFound(w, r)
+		return
+	}
+	room = strings.ToLower(room)
+	// Peers are not browsers, any origin is accepted
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			conn.PayloadType = websocket.BinaryFrame
+			if role == roleListen {
+				s.listen(room, conn)
+			} else {
+				s.dial(room, conn)
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// listen parks a receiver connection until a sender takes it, then forwards the
+// receiver's bytes to the sender
+func (s *Server) listen(room string, conn *websocket.Conn) {
+	w := &waiter{conn: conn, partner: make(chan *websocket.Conn, 1), done: make(chan struct{})}
+	defer close(w.done)
+	if !s.add(room, w) {
+		return
+	}
+
+	// The receiver sends nothing before it is paired, so a read only returns early
+	// when it disconnects
+	buf := make([]byte, 32<<10)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if s.remove(room, w) {
+			return
+		}
+	}
+	partner := <-w.partner
+	defer partner.Close()
+	if n > 0 {
+		if _, err := partner.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+	if err == nil {
+		io.CopyBuffer(partner, conn, buf)
+	}
+}
+
+// dial pairs a sender connection with a waiting receiver and forwards the sender's bytes
+func (s *Server) dial(room string, conn *websocket.Conn) {
+	w := s.take(room)
+	if w == nil {
+		return
+	}
+	w.partner <- conn
+	for _, c := range []*websocket.Conn{w.conn, conn} {
+		if _, err := c.Write([]byte{paired}); err != nil {
+			w.conn.Close()
+			<-w.done
+			return
+		}
+	}
+	io.Copy(w.conn, conn)
+	w.conn.Close()
+	<-w.done
+}
+
+func (s *Server) add(room string, w *waiter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.rooms[room]) >= maxWaiting {
+		return false
+	}
+	s.rooms[room] = append(s.rooms[room], w)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return true
+}
+
+// remove drops a waiter that disconnected, it reports false when a sender took it already
+func (s *Server) remove(room string, w *waiter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiters := s.rooms[room]
+	for i, candidate := range waiters {
+		if candidate == w {
+			s.rooms[room] = append(waiters[:i:i], waiters[i+1:]...)
+			if len(s.rooms[room]) == 0 {
+				delete(s.rooms, room)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// take removes and returns a waiter of room, waiting up to pairTimeout for one
+func (s *Server) take(room string) *waiter {
+	deadline := time.NewTimer(pairTimeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		if waiters := s.rooms[room]; len(waiters) > 0 {
+			w := waiters[0]
+			s.rooms[room] = waiters[1:]
+			if len(s.rooms[room]) == 0 {
+				delete(s.rooms, room)
+			}
+			s.mu.Unlock()
+			return w
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return nil
+		}
+	}
+}
+
+// ListenAndServe runs a relay server on addr
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(pathPrefix, NewServer())
+	logger.Infof("Relay listening on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// ValidateURL checks a --relay URL: ws, wss, http or https with a host
+func ValidateURL(rawURL string) error {
+	_, err := roomURL(rawURL, "", "")
+	return err
+}
+
+// roomURL builds the WebSocket URL of a room for role from the relay URL
+func roomURL(rawURL, room, role string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid relay URL %q", rawURL)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("invalid relay URL %q (ws, wss, http or https)", rawURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + pathPrefix + url.PathEscape(strings.ToLower(room))
+	u.RawPath = ""
+	u.RawQuery = url.Values{"role": {role}}.Encode()
+	return u, nil
+}
+
+// connect opens a WebSocket connection to a room and waits until it is paired
+func connect(ctx context.Context, rawURL, room, role string) (net.Conn, error) {
+	u, err := roomURL(rawURL, room, role)
+	if err != nil {
+		return nil, err
+	}
+	origin := *u
+	origin.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	origin.Path, origin.RawQuery = "", ""
+	config, err := websocket.NewConfig(u.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	conn, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("relay: %w", err)
+	}
+	conn.PayloadType = websocket.BinaryFrame
+
+	// Unblock the read below when ctx ends, e.g. a sender gives up
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	marker := make([]byte, 1)
+	if _, err := io.ReadFull(conn, marker); err != nil || marker[0] != paired {
+		conn.Close()
+		if role == roleDial {
+			return nil, fmt.Errorf("%w in room %q", ErrNoReceiver, room)
+		}
+		return nil, errNotPaired
+	}
+	return &relayConn{Conn: conn, room: room}, nil
+}
+
+// Dial connects a sender to the receiver waiting in room
+func Dial(ctx context.Context, rawURL, room string) (net.Conn, error) {
+	return connect(ctx, rawURL, room, roleDial)
+}
+
+// Host encodes room as a host name for peer URLs, Room decodes it again. Aliases may
+// contain characters that are not allowed in host names.
+func Host(room string) string {
+	return hex.EncodeToString([]byte(room))
+}
+
+// Room returns the room encoded in host by Host
+func Room(host string) (string, error) {
+	room, err := hex.DecodeString(host)
+	if err != nil {
+		return "", fmt.Errorf("relay: invalid peer host %q", host)
+	}
+	return string(room), nil
+}
+
+// relayConn reports the room as the address of both ends
+type relayConn struct {
+	*websocket.Conn
+	room string
+}
+
+func (c *relayConn) LocalAddr() net.Addr  { return Addr(c.room) }
+func (c *relayConn) RemoteAddr() net.Addr { return Addr(c.room) }
+
+// Addr is the address of a relayed connection, the room name
+type Addr string
+
+func (Addr) Network() string  { return "relay" }
+func (a Addr) String() string { return "relay:" + string(a) }
+
+// Listener accepts the sender connections the relay pairs with a receiver's room
+type Listener struct {
+	url, room string
+	conns     chan net.Conn
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// idleConns is how many connections a receiver keeps waiting at the relay; HTTP
+// clients open several connections per transfer
+const idleConns = 4
+
+// retryDelay is the wait before reconnecting after the relay could not be reached
+const retryDelay = 5 * time.Second
+
+// Listen registers room at the relay and returns a listener for the relayed connections
+func Listen(rawURL, room string) (*Listener, error) {
+	if err := ValidateURL(rawURL); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Listener{url: rawURL, room: room, conns: make(chan net.Conn), ctx: ctx, cancel: cancel}
+	for range idleConns {
+		go l.wait()
+	}
+	return l, nil
+}
+
+// wait keeps one connection waiting at the relay, opening a new one after each pairing
+func (l *Listener) wait() {
+	for l.ctx.Err() == nil {
+		conn, err := connect(l.ctx, l.url, l.room, roleListen)
+		if err != nil {
+			if l.ctx.Err() == nil && !errors.Is(err, errNotPaired) {
+				logger.Warnf("Relay connection failed, retrying in %s: %v", retryDelay, err)
+			}
+			select {
+			case <-time.After(retryDelay):
+			case <-l.ctx.Done():
+			}
+			continue
+		}
+		select {
+		case l.conns <- conn:
+		case <-l.ctx.Done():
+			conn.Close()
+		}
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) Close() error {
+	l.cancel()
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr { return Addr(l.room) }
@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRelayPairsSenderWithRoom(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle(pathPrefix, NewServer())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ln, err := Listen(server.URL, "My Laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn) // Echo
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Rooms are case-insensitive, like aliases given with --to
+	conn, err := Dial(ctx, server.URL, "my laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("got %q, %v", buf, err)
+	}
+
+	short, cancelShort := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancelShort()
+	if _, err := Dial(short, server.URL, "nobody"); !errors.Is(err, ErrNoReceiver) {
+		t.Fatalf("got %v, want %v", err, ErrNoReceiver)
+	}
+}
+
+func TestHostRoundTrip(t *testing.T) {
+	room, err := Room(Host("Bob's Laptop"))
+	if err != nil || room != "Bob's Laptop" {
+		t.Fatalf("Room(Host()) = %q, %v", room, err)
+	}
+	if err := ValidateURL("ftp://relay.example.com"); err == nil {
+		t.Error("ftp relay URL accepted")
+	}
+}
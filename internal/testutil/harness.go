@@ -0,0 +1,92 @@
+// Package testutil runs a LocalSend receiver inside a test, for integration tests
+// of the whole send and receive path over loopback.
+package testutil
+
+import (
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/handlers"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// Harness is a receiver serving the LocalSend API on 127.0.0.1 with a random port.
+// Sender and receiver share the handlers' package state, so tests using a Harness
+// must not run in parallel.
+type Harness struct {
+	Dir string // Receive directory
+	IP  string // Address the receiver is known by to senders
+
+	server *httptest.Server
+}
+
+// New starts a receiver that accepts every transfer into a temporary directory. The
+// config and HOME are restored and the server is stopped when the test ends.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	saved := config.ConfigData
+	t.Cleanup(func() { config.ConfigData = saved })
+	// The history and retry queue are written to the config directory
+	t.Setenv("HOME", t.TempDir())
+
+	h := &Harness{Dir: t.TempDir(), IP: "127.0.0.1"}
+	config.ConfigData.ReceiveDir = h.Dir
+	config.ConfigData.AutoAccept = true
+	config.ConfigData.AllowFrom = nil
+	config.ConfigData.Devices = nil
+	config.ConfigData.SendTo = h.IP // Never ask to retry a failed connection
+
+	mux := http.NewServeMux()
+	handlers.RegisterAPI(mux)
+	h.server = httptest.NewServer(mux)
+	t.Cleanup(h.server.Close)
+
+	_, portText, _ := net.SplitHostPort(h.server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	shared.DevicesMutex.Lock()
+	shared.DiscoveredDevices[h.IP] = models.BroadcastMessage{Alias: "harness", Port: port, Protocol: "http"}
+	shared.DevicesMutex.Unlock()
+	t.Cleanup(func() {
+		shared.DevicesMutex.Lock()
+		delete(shared.DiscoveredDevices, h.IP)
+		shared.DevicesMutex.Unlock()
+	})
+	return h
+}
+
+// URL is the base URL of the receiver, e.g. "http://127.0.0.1:40123"
+func (h *Harness) URL() string {
+	return h.server.URL
+}
+
+// Send sends files and directories to the receiver like the send command
+func (h *Harness) Send(paths ...string) ([]handlers.TransferResult, error) {
+	return handlers.SendFilesTo(h.IP, paths)
+}
+
+// ReceivedFiles returns the files in the receive directory, relative to it and
+// sorted, with forward slashes
+func (h *Harness) ReceivedFiles() []string {
+	var files []string
+	filepath.WalkDir(h.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(h.Dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
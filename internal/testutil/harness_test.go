@@ -0,0 +1,188 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/handlers"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func randomData(t *testing.T, size int) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkReceived compares a received file with what was sent
+func checkReceived(t *testing.T, h *Harness, name string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(h.Dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: received %d bytes that differ from the %d sent", name, len(got), len(want))
+	}
+}
+
+func TestSendReceiveRoundtrip_SmallFile(t *testing.T) {
+	h := New(t)
+	path := filepath.Join(t.TempDir(), "note.txt")
+	writeFile(t, path, []byte("hello"))
+
+	if _, err := h.Send(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.ReceivedFiles(); !reflect.DeepEqual(got, []string{"note.txt"}) {
+		t.Fatalf("received %v", got)
+	}
+	checkReceived(t, h, "note.txt", []byte("hello"))
+}
+
+func TestSendReceiveRoundtrip_LargeFile(t *testing.T) {
+	h := New(t)
+	// Larger than the upload buffers, so the body arrives in many reads
+	data := randomData(t, 24<<20+123)
+	path := filepath.Join(t.TempDir(), "large.bin")
+	writeFile(t, path, data)
+
+	if _, err := h.Send(path); err != nil {
+		t.Fatal(err)
+	}
+	checkReceived(t, h, "large.bin", data)
+}
+
+func TestSendReceiveRoundtrip_Directory(t *testing.T) {
+	h := New(t)
+	dir := filepath.Join(t.TempDir(), "album")
+	// The files are received relative to the directory sent
+	files := map[string][]byte{
+		"a.txt":         []byte("a"),
+		"sub/b.bin":     randomData(t, 70<<10),
+		"sub/deep/c.md": []byte("# c"),
+	}
+	for name, data := range files {
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(name)), data)
+	}
+
+	if _, err := h.Send(dir); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "sub/b.bin", "sub/deep/c.md"}
+	if got := h.ReceivedFiles(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("received %v, want %v", got, want)
+	}
+	for name, data := range files {
+		checkReceived(t, h, name, data)
+	}
+}
+
+func TestSendReceiveRoundtrip_Cancel(t *testing.T) {
+	h := New(t)
+	path := filepath.Join(t.TempDir(), "big.bin")
+	writeFile(t, path, randomData(t, 8<<20))
+
+	// Paused transfers hold the upload in flight until it is cancelled
+	handlers.PauseTransfers()
+	defer handlers.ResumeTransfers()
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.Send(path)
+		done <- err
+	}()
+	deadline := time.After(10 * time.Second)
+	for handlers.CancelSends() == 0 {
+		select {
+		case err := <-done:
+			t.Fatalf("send finished before it was cancelled: %v", err)
+		case <-deadline:
+			t.Fatal("send never started")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, handlers.ErrTransferCancelled) {
+			t.Fatalf("got %v, want %v", err, handlers.ErrTransferCancelled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("send not cancelled")
+	}
+	// The receiver is told of the cancellation and removes the partial file
+	for start := time.Now(); len(h.ReceivedFiles()) > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("partial files left: %v", h.ReceivedFiles())
+		}
+	}
+}
+
+func TestSendReceiveRoundtrip_PIN(t *testing.T) {
+	h := New(t)
+	config.ConfigData.PIN = "4821"
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	writeFile(t, path, []byte("secret"))
+
+	config.ConfigData.SendPIN = "4821"
+	if _, err := h.Send(path); err != nil {
+		t.Fatal(err)
+	}
+	checkReceived(t, h, "secret.txt", []byte("secret"))
+}
+
+func TestSendReceiveRoundtrip_Legacy(t *testing.T) {
+	h := New(t)
+	// The receiver announced protocol v1, as older LocalSend apps do
+	shared.DevicesMutex.Lock()
+	device := shared.DiscoveredDevices[h.IP]
+	device.Version = "1.0"
+	shared.DiscoveredDevices[h.IP] = device
+	shared.DevicesMutex.Unlock()
+
+	dir := filepath.Join(t.TempDir(), "photos")
+	writeFile(t, filepath.Join(dir, "a.jpg"), []byte("a"))
+	writeFile(t, filepath.Join(dir, "b.jpg"), randomData(t, 3<<20))
+	if _, err := h.Send(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.ReceivedFiles(); !reflect.DeepEqual(got, []string{"a.jpg", "b.jpg"}) {
+		t.Fatalf("received %v", got)
+	}
+	checkReceived(t, h, "a.jpg", []byte("a"))
+}
+
+func TestSendReceiveRoundtrip_Append(t *testing.T) {
+	h := New(t)
+	config.ConfigData.ReceiveMode = handlers.ReceiveModeAppend
+	data := randomData(t, 1<<20)
+	writeFile(t, filepath.Join(h.Dir, "log.bin"), data[:300<<10])
+	path := filepath.Join(t.TempDir(), "log.bin")
+	writeFile(t, path, data)
+
+	// Only the part the receiver doesn't have is sent, and the result is the whole file
+	if _, err := h.Send(path); err != nil {
+		t.Fatal(err)
+	}
+	checkReceived(t, h, "log.bin", data)
+}
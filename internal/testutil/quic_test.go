@@ -0,0 +1,72 @@
+//go:build quic
+
+package testutil
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/handlers"
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/utils/certificate"
+)
+
+// serveQUIC serves the receiver's API over HTTP/3 too and announces it like a
+// localsend-go peer in QUIC mode: protocol http, fingerprint of the HTTP/3 certificate
+func serveQUIC(t *testing.T, h *Harness, fingerprint func(cert string) string) {
+	t.Helper()
+	cert, err := certificate.LoadOrCreate(filepath.Join(t.TempDir(), "certificate.pem"), "harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	mux := http.NewServeMux()
+	handlers.RegisterAPI(mux)
+	go transport.ServeQUIC(conn.LocalAddr().String(), mux, cert)
+
+	config.ConfigData.Transport = transport.QUIC
+	shared.DevicesMutex.Lock()
+	device := shared.DiscoveredDevices[h.IP]
+	device.QUICPort = port
+	device.Fingerprint = fingerprint(certificate.Fingerprint(cert.Certificate[0]))
+	shared.DiscoveredDevices[h.IP] = device
+	shared.DevicesMutex.Unlock()
+}
+
+func TestSendReceiveRoundtrip_QUIC(t *testing.T) {
+	h := New(t)
+	serveQUIC(t, h, func(cert string) string { return cert })
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	data := randomData(t, 2<<20)
+	writeFile(t, path, data)
+
+	if _, err := h.Send(path); err != nil {
+		t.Fatal(err)
+	}
+	checkReceived(t, h, "clip.mp4", data)
+}
+
+func TestSendReceiveRoundtrip_QUICCertificateMismatch(t *testing.T) {
+	h := New(t)
+	serveQUIC(t, h, func(string) string { return strings.Repeat("ab", 32) })
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	writeFile(t, path, []byte("clip"))
+
+	if _, err := h.Send(path); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("sent to a peer not presenting the announced certificate, err %v", err)
+	}
+	if got := h.ReceivedFiles(); len(got) != 0 {
+		t.Fatalf("received %v", got)
+	}
+}
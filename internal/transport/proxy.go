@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/meowrain/localsend-go/internal/config"
+)
+
+// ValidateProxy checks the --proxy URL
+func ValidateProxy() error {
+	if config.ConfigData.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(config.ConfigData.Proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid proxy URL %q", config.ConfigData.Proxy)
+	}
+	return nil
+}
+
+// Proxy returns the proxy function for file transfers: --proxy if set, otherwise
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY from the environment. Discovery is never proxied.
+func Proxy() func(*http.Request) (*url.URL, error) {
+	if config.ConfigData.Proxy != "" {
+		if u, err := url.Parse(config.ConfigData.Proxy); err == nil {
+			return http.ProxyURL(u)
+		}
+	}
+	return http.ProxyFromEnvironment
+}
@@ -0,0 +1,45 @@
+// Package transport selects the HTTP transport used between peers.
+// The default is HTTP over TCP; HTTP/3 over QUIC is available in builds
+// with the "quic" tag.
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/meowrain/localsend-go/internal/relay"
+)
+
+const (
+	TCP  = "tcp"
+	QUIC = "quic"
+)
+
+// QUICPort is the UDP port of the HTTP/3 server. It can't be the server port itself:
+// with the default port that is also the UDP discovery port.
+func QUICPort() int {
+	if config.ConfigData.QUICPort > 0 {
+		return config.ConfigData.QUICPort
+	}
+	return config.ConfigData.Port + 1
+}
+
+// useRelay sends the connections of base through the --relay server. The host of each
+// peer address is the receiver's room, encoded with relay.Host; TLS runs on top.
+func useRelay(base *http.Transport) {
+	base.Proxy = nil
+	base.DialTLSContext = nil
+	base.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		room, err := relay.Room(host)
+		if err != nil {
+			return nil, err
+		}
+		return relay.Dial(ctx, config.ConfigData.Relay, room)
+	}
+}
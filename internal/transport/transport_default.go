@@ -0,0 +1,38 @@
+//go:build !quic
+
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/meowrain/localsend-go/internal/config"
+)
+
+var errNoQUIC = errors.New("this build has no QUIC support, rebuild with -tags quic")
+
+// Supported reports whether the configured transport is available in this build
+func Supported() error {
+	if config.ConfigData.Transport == QUIC {
+		return errNoQUIC
+	}
+	return nil
+}
+
+// RoundTripper returns the transport used by clients talking to peers
+func RoundTripper(base *http.Transport) http.RoundTripper {
+	if config.ConfigData.Relay != "" {
+		useRelay(base)
+		return base
+	}
+	if base.Proxy == nil {
+		base.Proxy = Proxy()
+	}
+	return base
+}
+
+// ServeQUIC serves handler over HTTP/3, which is unavailable in this build
+func ServeQUIC(addr string, handler http.Handler, cert tls.Certificate) error {
+	return errNoQUIC
+}
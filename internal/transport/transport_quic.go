@@ -0,0 +1,43 @@
+//go:build quic
+
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/meowrain/localsend-go/internal/config"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Supported reports whether the configured transport is available in this build
+func Supported() error {
+	return nil
+}
+
+// RoundTripper returns the transport used by clients talking to peers.
+// In QUIC mode the TLS settings of base are reused for HTTP/3.
+func RoundTripper(base *http.Transport) http.RoundTripper {
+	if config.ConfigData.Transport != QUIC {
+		if config.ConfigData.Relay != "" {
+			useRelay(base)
+			return base
+		}
+		if base.Proxy == nil {
+			base.Proxy = Proxy()
+		}
+		return base
+	}
+	return &http3.RoundTripper{TLSClientConfig: base.TLSClientConfig}
+}
+
+// ServeQUIC serves handler over HTTP/3 on the UDP address addr. cert must be the
+// certificate whose fingerprint is announced, peers verify it against that.
+func ServeQUIC(addr string, handler http.Handler, cert tls.Certificate) error {
+	server := &http3.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,62 @@
+package tray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const iconSize = 32
+
+var (
+	iconBackground = color.NRGBA{0x00, 0x96, 0x88, 0xff}
+	iconForeground = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// iconPNG draws the tray icon, a white arrow on a teal disc. It is drawn rather than
+// embedded because the logo is far larger than a tray icon needs.
+func iconPNG() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, iconSize, iconSize))
+	const c = iconSize / 2
+	for y := 0; y < iconSize; y++ {
+		for x := 0; x < iconSize; x++ {
+			dx, dy := x-c, y-c
+			if dx*dx+dy*dy > c*c {
+				continue
+			}
+			img.SetNRGBA(x, y, iconBackground)
+			// Arrow pointing up: a triangle head over a shaft
+			head := y >= 7 && y < 16 && abs(dx) <= y-7
+			shaft := y >= 16 && y < 25 && abs(dx) <= 2
+			if head || shaft {
+				img.SetNRGBA(x, y, iconForeground)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// iconICO wraps the PNG icon in an ICO file, which Windows needs
+func iconICO() []byte {
+	data := iconPNG()
+	var buf bytes.Buffer
+	// ICONDIR: reserved, type 1 (icon), one image
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, 1})
+	// ICONDIRENTRY: size, no palette, 1 plane, 32 bpp, data size and offset
+	buf.Write([]byte{iconSize, iconSize, 0, 0})
+	binary.Write(&buf, binary.LittleEndian, [2]uint16{1, 32})
+	binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(len(data)), 6 + 16})
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
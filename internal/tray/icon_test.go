@@ -0,0 +1,36 @@
+package tray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"testing"
+)
+
+func TestIconPNG(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(iconPNG()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != iconSize || b.Dy() != iconSize {
+		t.Errorf("icon is %v", b)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Error("corner is not transparent")
+	}
+	if r, _, _, _ := img.At(iconSize/2, 20).RGBA(); r>>8 != 0xff {
+		t.Error("arrow not drawn")
+	}
+}
+
+func TestIconICO(t *testing.T) {
+	ico := iconICO()
+	if header := [3]uint16{}; binary.Read(bytes.NewReader(ico), binary.LittleEndian, &header) != nil || header != [3]uint16{0, 1, 1} {
+		t.Fatalf("bad ICO header %v", ico[:6])
+	}
+	size := binary.LittleEndian.Uint32(ico[14:])
+	offset := binary.LittleEndian.Uint32(ico[18:])
+	if int(offset+size) != len(ico) || !bytes.Equal(ico[offset:], iconPNG()) {
+		t.Error("ICO does not hold the PNG icon")
+	}
+}
@@ -0,0 +1,30 @@
+// Package tray runs localsend-go as a system tray application (--tray), with a menu
+// to send files, switch receiving on and off, view the history and edit the settings.
+// It is only available in builds with -tags tray; these need cgo, and on Linux the
+// GTK 3 and libayatana-appindicator3 development packages.
+package tray
+
+import "errors"
+
+// ErrCancelled is returned when a dialog is closed without a choice
+var ErrCancelled = errors.New("cancelled")
+
+// Actions are the menu actions, called on a separate goroutine for each click
+type Actions struct {
+	// SendFile asks for files and a device and sends them
+	SendFile func()
+	// SetReceiving switches receiving on or off; Receiving is the initial state
+	SetReceiving func(on bool)
+	Receiving    bool
+	ViewHistory  func()
+	Settings     func()
+	// Quit is called after the tray icon is removed
+	Quit func()
+}
+
+func receiveTitle(on bool) string {
+	if on {
+		return "Receive Mode: On"
+	}
+	return "Receive Mode: Off"
+}
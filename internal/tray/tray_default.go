@@ -0,0 +1,28 @@
+//go:build !tray
+
+package tray
+
+import "errors"
+
+var errUnsupported = errors.New("system tray support requires a build with -tags tray")
+
+// Run is unavailable in this build
+func Run(actions Actions) error {
+	return errUnsupported
+}
+
+// Notify is a no-op in this build
+func Notify(title, message string) {}
+
+// SelectFiles is unavailable in this build
+func SelectFiles() ([]string, error) {
+	return nil, errUnsupported
+}
+
+// SelectDevice is unavailable in this build
+func SelectDevice(devices []string) (string, error) {
+	return "", errUnsupported
+}
+
+// ShowError is a no-op in this build
+func ShowError(message string) {}
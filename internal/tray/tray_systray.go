@@ -0,0 +1,91 @@
+//go:build tray
+
+package tray
+
+import (
+	"errors"
+	"runtime"
+
+	"github.com/gen2brain/beeep"
+	"github.com/getlantern/systray"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/ncruces/zenity"
+)
+
+// Run shows the tray icon and blocks until Quit is chosen. It must be called on the
+// main goroutine.
+func Run(actions Actions) error {
+	systray.Run(func() { onReady(actions) }, actions.Quit)
+	return nil
+}
+
+func onReady(actions Actions) {
+	if runtime.GOOS == "windows" {
+		systray.SetIcon(iconICO())
+	} else {
+		systray.SetIcon(iconPNG())
+	}
+	systray.SetTooltip("LocalSend")
+
+	send := systray.AddMenuItem("Send File...", "Send files to a nearby device")
+	receive := systray.AddMenuItemCheckbox(receiveTitle(actions.Receiving), "Accept incoming transfers", actions.Receiving)
+	history := systray.AddMenuItem("View History", "Open the transfer history")
+	settings := systray.AddMenuItem("Settings", "Edit the config file")
+	systray.AddSeparator()
+	quit := systray.AddMenuItem("Quit", "Quit localsend-go")
+
+	go func() {
+		for {
+			select {
+			case <-send.ClickedCh:
+				go actions.SendFile()
+			case <-receive.ClickedCh:
+				on := !receive.Checked()
+				if on {
+					receive.Check()
+				} else {
+					receive.Uncheck()
+				}
+				receive.SetTitle(receiveTitle(on))
+				actions.SetReceiving(on)
+			case <-history.ClickedCh:
+				go actions.ViewHistory()
+			case <-settings.ClickedCh:
+				go actions.Settings()
+			case <-quit.ClickedCh:
+				systray.Quit()
+				return
+			}
+		}
+	}()
+}
+
+// Notify shows a desktop notification
+func Notify(title, message string) {
+	if err := beeep.Notify(title, message, ""); err != nil {
+		logger.Debugf("Could not show notification: %v", err)
+	}
+}
+
+// SelectFiles asks for the files to send
+func SelectFiles() ([]string, error) {
+	paths, err := zenity.SelectFileMultiple(zenity.Title("Send File"))
+	if errors.Is(err, zenity.ErrCanceled) {
+		return nil, ErrCancelled
+	}
+	return paths, err
+}
+
+// SelectDevice asks which of devices to send to
+func SelectDevice(devices []string) (string, error) {
+	device, err := zenity.List("Send to:", devices, zenity.Title("Select Device"))
+	if errors.Is(err, zenity.ErrCanceled) {
+		return "", ErrCancelled
+	}
+	return device, err
+}
+
+// ShowError shows message in an error dialog
+func ShowError(message string) {
+	zenity.Error(message, zenity.Title("LocalSend"))
+}
@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// AskAccept shows an incoming transfer and asks to accept all files, pick some or
+// reject it. It returns the IDs of the accepted files, none when rejected, cancelled,
+// when ctx is done or on errors (e.g. no TTY).
+func AskAccept(ctx context.Context, sender models.Info, files map[string]models.FileInfo) []string {
+	m, err := bubbletea.NewProgram(newAcceptModel(sender, files), bubbletea.WithContext(ctx)).Run()
+	if err != nil {
+		return nil
+	}
+	return m.(acceptModel).accepted
+}
+
+// acceptModel is the Bubble Tea model of AskAccept
+type acceptModel struct {
+	preview  string
+	ids      []string // By file name
+	names    []string
+	picking  bool
+	cursor   int
+	picked   map[int]bool
+	accepted []string
+	done     bool
+}
+
+func newAcceptModel(sender models.Info, files map[string]models.FileInfo) acceptModel {
+	m := acceptModel{preview: RenderTransferPreview(sender, files), picked: make(map[int]bool)}
+	for id := range files {
+		m.ids = append(m.ids, id)
+	}
+	sort.Slice(m.ids, func(i, j int) bool { return files[m.ids[i]].FileName < files[m.ids[j]].FileName })
+	for _, id := range m.ids {
+		m.names = append(m.names, fmt.Sprintf("%s (%s)", files[id].FileName, FormatSize(files[id].Size)))
+	}
+	return m
+}
+
+func (m acceptModel) Init() bubbletea.Cmd {
+	return nil
+}
+
+func (m acceptModel) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
+	key, ok := msg.(bubbletea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	switch key.String() {
+	case "esc", "ctrl+c":
+		m.accepted, m.done = nil, true
+		return m, bubbletea.Quit
+	}
+	if !m.picking {
+		switch strings.ToLower(key.String()) {
+		case "a", "y", "enter":
+			m.accepted, m.done = m.ids, true
+			return m, bubbletea.Quit
+		case "p":
+			m.picking = true
+		case "r", "n":
+			m.done = true
+			return m, bubbletea.Quit
+		}
+		return m, nil
+	}
+
+	switch key.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.ids)-1 {
+			m.cursor++
+		}
+	case " ", "x":
+		m.picked[m.cursor] = !m.picked[m.cursor]
+	case "a":
+		// Select all, or none when all are selected
+		all := true
+		for i := range m.ids {
+			all = all && m.picked[i]
+		}
+		for i := range m.ids {
+			m.picked[i] = !all
+		}
+	case "enter":
+		for i, id := range m.ids {
+			if m.picked[i] {
+				m.accepted = append(m.accepted, id)
+			}
+		}
+		m.done = true
+		return m, bubbletea.Quit
+	}
+	return m, nil
+}
+
+func (m acceptModel) View() string {
+	if m.done {
+		return ""
+	}
+	if !m.picking {
+		return m.preview + "\n\n[A]ccept all / [P]ick files / [R]eject "
+	}
+	var b strings.Builder
+	b.WriteString("Select the files to receive (space: toggle, a: all, enter: accept, esc: reject)\n\n")
+	for i, name := range m.names {
+		cursor, check := " ", "[ ]"
+		if i == m.cursor {
+			cursor = ">"
+		}
+		if m.picked[i] {
+			check = "[x]"
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", cursor, check, name)
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestAcceptModel(t *testing.T) {
+	files := map[string]models.FileInfo{
+		"1": {FileName: "b.txt", Size: 2},
+		"2": {FileName: "a.txt", Size: 1},
+		"3": {FileName: "c.txt", Size: 3},
+	}
+	press := func(m acceptModel, keys ...string) acceptModel {
+		for _, key := range keys {
+			var msg bubbletea.KeyMsg
+			switch key {
+			case "enter":
+				msg = bubbletea.KeyMsg{Type: bubbletea.KeyEnter}
+			case "esc":
+				msg = bubbletea.KeyMsg{Type: bubbletea.KeyEsc}
+			case "down":
+				msg = bubbletea.KeyMsg{Type: bubbletea.KeyDown}
+			case " ":
+				msg = bubbletea.KeyMsg{Type: bubbletea.KeySpace, Runes: []rune{' '}}
+			default:
+				msg = bubbletea.KeyMsg{Type: bubbletea.KeyRunes, Runes: []rune(key)}
+			}
+			next, _ := m.Update(msg)
+			m = next.(acceptModel)
+		}
+		return m
+	}
+
+	tests := []struct {
+		keys []string
+		want []string
+	}{
+		{[]string{"a"}, []string{"2", "1", "3"}},
+		{[]string{"enter"}, []string{"2", "1", "3"}},
+		{[]string{"r"}, nil},
+		{[]string{"esc"}, nil},
+		// Pick a.txt and c.txt
+		{[]string{"p", " ", "down", "down", " ", "enter"}, []string{"2", "3"}},
+		{[]string{"p", "a", "enter"}, []string{"2", "1", "3"}},
+		{[]string{"p", "a", "a", "enter"}, nil},
+		{[]string{"p", " ", "esc"}, nil},
+	}
+	for _, tt := range tests {
+		m := press(newAcceptModel(models.Info{Alias: "peer"}, files), tt.keys...)
+		if !m.done || !reflect.DeepEqual(m.accepted, tt.want) {
+			t.Errorf("%q: accepted %v (done %v), want %v", tt.keys, m.accepted, m.done, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"os"
+	"sync"
+)
+
+// WatchCancelKeys calls cancel when q is pressed while a transfer is running.
+// Ctrl+C still arrives as an interrupt signal. The returned function restores the terminal.
+func WatchCancelKeys(cancel func()) func() {
+	restore, err := enableCbreak(os.Stdin)
+	if err != nil {
+		// Not a terminal, nothing to watch
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if n == 1 && (buf[0] == 'q' || buf[0] == 'Q') {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			restore()
+		})
+	}
+}
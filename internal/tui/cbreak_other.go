@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// enableCbreak is not supported on this platform
+func enableCbreak(f *os.File) (func(), error) {
+	return nil, errors.New("cbreak mode not supported")
+}
@@ -0,0 +1,21 @@
+package tui
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableCbreak turns off line input and echo on the console, keeping Ctrl+C processing
+func enableCbreak(f *os.File) (func(), error) {
+	handle := windows.Handle(f.Fd())
+	var old uint32
+	if err := windows.GetConsoleMode(handle, &old); err != nil {
+		return nil, err
+	}
+	mode := old &^ (windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT)
+	if err := windows.SetConsoleMode(handle, mode); err != nil {
+		return nil, err
+	}
+	return func() { windows.SetConsoleMode(handle, old) }, nil
+}
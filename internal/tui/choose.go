@@ -0,0 +1,50 @@
+package tui
+
+import (
+	"strings"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
+)
+
+// Choose shows question and waits for one of the keys in keys, case-insensitive.
+// It returns the lowercase key, or 0 when cancelled or on errors (e.g. no TTY).
+func Choose(question, keys string) rune {
+	m, err := bubbletea.NewProgram(chooseModel{question: question, keys: strings.ToLower(keys)}).Run()
+	if err != nil {
+		return 0
+	}
+	return m.(chooseModel).answer
+}
+
+// chooseModel is the Bubble Tea model of Choose
+type chooseModel struct {
+	question string
+	keys     string
+	answer   rune
+	done     bool
+}
+
+func (m chooseModel) Init() bubbletea.Cmd {
+	return nil
+}
+
+func (m chooseModel) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
+	if msg, ok := msg.(bubbletea.KeyMsg); ok {
+		switch key := strings.ToLower(msg.String()); {
+		case key == "esc" || key == "ctrl+c":
+			m.done = true
+			return m, bubbletea.Quit
+		case len(key) == 1 && strings.Contains(m.keys, key):
+			m.answer, m.done = rune(key[0]), true
+			return m, bubbletea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m chooseModel) View() string {
+	if m.done {
+		return ""
+	}
+	return m.question + " "
+}
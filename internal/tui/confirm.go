@@ -0,0 +1,46 @@
+package tui
+
+import (
+	bubbletea "github.com/charmbracelet/bubbletea"
+)
+
+// Confirm asks a yes/no question, Enter answers yes. Errors (e.g. no TTY) answer no.
+func Confirm(question string) bool {
+	m, err := bubbletea.NewProgram(confirmModel{question: question}).Run()
+	if err != nil {
+		return false
+	}
+	return m.(confirmModel).answer
+}
+
+// confirmModel is the Bubble Tea model of Confirm
+type confirmModel struct {
+	question string
+	answer   bool
+	done     bool
+}
+
+func (m confirmModel) Init() bubbletea.Cmd {
+	return nil
+}
+
+func (m confirmModel) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
+	if msg, ok := msg.(bubbletea.KeyMsg); ok {
+		switch msg.String() {
+		case "y", "Y", "enter":
+			m.answer, m.done = true, true
+			return m, bubbletea.Quit
+		case "n", "N", "q", "esc", "ctrl+c":
+			m.answer, m.done = false, true
+			return m, bubbletea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m confirmModel) View() string {
+	if m.done {
+		return ""
+	}
+	return m.question + " [Y/n] "
+}
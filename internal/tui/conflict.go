@@ -0,0 +1,60 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// Answers of AskConflict
+const (
+	ConflictOverwrite = 'o'
+	ConflictRename    = 'r'
+	ConflictSkip      = 's'
+)
+
+// AskConflict asks what to do with an incoming file whose name already exists.
+// applyToAll is set when the answer should be used for the rest of the session.
+// Errors (e.g. no TTY) and cancelling answer skip.
+func AskConflict(name string, existing os.FileInfo, incoming models.FileInfo) (answer rune, applyToAll bool) {
+	question := fmt.Sprintf("File '%s' already exists (%s, %s). Incoming: %s%s. [O]verwrite / [R]ename / [S]kip / [A]pply to all",
+		name, FormatSize(existing.Size()), formatAge(time.Since(existing.ModTime())),
+		FormatSize(incoming.Size), incomingModified(incoming))
+	answer = Choose(question, "orsa")
+	if answer == 'a' {
+		applyToAll = true
+		answer = Choose("For all remaining conflicts: [O]verwrite / [R]ename / [S]kip", "ors")
+	}
+	if answer == 0 {
+		answer = ConflictSkip
+	}
+	return answer, applyToAll
+}
+
+// incomingModified describes the modification time the sender reported, if any
+func incomingModified(file models.FileInfo) string {
+	if file.Metadata == nil {
+		return ""
+	}
+	modified, err := time.Parse(time.RFC3339, file.Metadata.Modified)
+	if err != nil {
+		return ""
+	}
+	return ", " + formatAge(time.Since(modified))
+}
+
+// formatAge formats how long ago something happened, e.g. 3 days old
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just modified"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min old", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours old", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d days old", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"strings"
+
+	bubbletea "github.com/charmbracelet/bubbletea"
+)
+
+// AskPIN asks for a PIN with masked input. It returns false when cancelled or on
+// errors (e.g. no TTY).
+func AskPIN(question string) (string, bool) {
+	m, err := bubbletea.NewProgram(pinModel{question: question}).Run()
+	if err != nil {
+		return "", false
+	}
+	result := m.(pinModel)
+	return string(result.pin), result.entered
+}
+
+// pinModel is the Bubble Tea model of AskPIN
+type pinModel struct {
+	question string
+	pin      []rune
+	entered  bool
+	done     bool
+}
+
+func (m pinModel) Init() bubbletea.Cmd {
+	return nil
+}
+
+func (m pinModel) Update(msg bubbletea.Msg) (bubbletea.Model, bubbletea.Cmd) {
+	if msg, ok := msg.(bubbletea.KeyMsg); ok {
+		switch msg.Type {
+		case bubbletea.KeyEnter:
+			m.entered, m.done = len(m.pin) > 0, true
+			return m, bubbletea.Quit
+		case bubbletea.KeyEsc, bubbletea.KeyCtrlC:
+			m.done = true
+			return m, bubbletea.Quit
+		case bubbletea.KeyBackspace:
+			if len(m.pin) > 0 {
+				m.pin = m.pin[:len(m.pin)-1]
+			}
+		case bubbletea.KeyRunes:
+			m.pin = append(m.pin, msg.Runes...)
+		}
+	}
+	return m, nil
+}
+
+func (m pinModel) View() string {
+	if m.done {
+		return ""
+	}
+	return m.question + " " + strings.Repeat("*", len(m.pin))
+}
@@ -0,0 +1,118 @@
+package tui
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+// Limits of the incoming transfer preview
+const (
+	previewMaxFiles = 10
+	previewMaxLines = 3
+)
+
+var (
+	previewColumnStyle = lipgloss.NewStyle().Padding(0, 2, 0, 0)
+	previewTitleStyle  = lipgloss.NewStyle().Bold(true)
+	previewDimStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+)
+
+// RenderTransferPreview renders an incoming transfer for the accept/reject prompt:
+// the sender on the left, the files on the right with a short preview of text
+// files and a placeholder for images. Long file lists are truncated.
+func RenderTransferPreview(sender models.Info, files map[string]models.FileInfo) string {
+	left := []string{
+		previewTitleStyle.Render("From"),
+		sender.Alias,
+		previewDimStyle.Render(strings.TrimSpace(sender.DeviceModel + " " + sender.DeviceType)),
+	}
+	if sender.OS != "" {
+		left = append(left, previewDimStyle.Render(strings.TrimSuffix(sender.OS+"/"+sender.GOArch, "/")))
+	}
+	if sender.Fingerprint != "" {
+		left = append(left, previewDimStyle.Render(shortFingerprint(sender.Fingerprint)))
+	}
+
+	sorted := make([]models.FileInfo, 0, len(files))
+	var total int64
+	for _, file := range files {
+		sorted = append(sorted, file)
+		total += file.Size
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FileName < sorted[j].FileName })
+
+	right := []string{previewTitleStyle.Render(fmt.Sprintf("%d file(s), %s", len(files), FormatSize(total)))}
+	for i, file := range sorted {
+		if i == previewMaxFiles {
+			right = append(right, previewDimStyle.Render(fmt.Sprintf("...and %d more", len(sorted)-previewMaxFiles)))
+			break
+		}
+		right = append(right, fmt.Sprintf("%s  %s", file.FileName, previewDimStyle.Render(FormatSize(file.Size))))
+		switch {
+		case file.Preview != "" && isTextFile(file):
+			lines := strings.Split(strings.TrimRight(file.Preview, "\n"), "\n")
+			if len(lines) > previewMaxLines {
+				lines = append(lines[:previewMaxLines], "...")
+			}
+			for _, line := range lines {
+				right = append(right, previewDimStyle.Render("  │ "+line))
+			}
+		case isImageFile(file):
+			// The protocol carries no image metadata, so dimensions are never known here
+			right = append(right, previewDimStyle.Render("  [image]"))
+		}
+	}
+
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		previewColumnStyle.Render(strings.Join(left, "\n")),
+		strings.Join(right, "\n"))
+}
+
+// fileMIMEType returns the MIME type of a file; FileType is a MIME type for
+// LocalSend apps but an extension for localsend-go senders
+func fileMIMEType(file models.FileInfo) string {
+	if strings.Contains(file.FileType, "/") {
+		return file.FileType
+	}
+	ext := file.FileType
+	if ext == "" {
+		ext = path.Ext(file.FileName)
+	}
+	return mime.TypeByExtension(ext)
+}
+
+func isTextFile(file models.FileInfo) bool {
+	return strings.HasPrefix(fileMIMEType(file), "text/")
+}
+
+func isImageFile(file models.FileInfo) bool {
+	return strings.HasPrefix(fileMIMEType(file), "image/")
+}
+
+// shortFingerprint shortens a fingerprint for display
+func shortFingerprint(fingerprint string) string {
+	if len(fingerprint) <= 16 {
+		return fingerprint
+	}
+	return fingerprint[:16] + "…"
+}
+
+// FormatSize formats a byte count, e.g. 1.5 MB
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
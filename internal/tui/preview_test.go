@@ -0,0 +1,30 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meowrain/localsend-go/internal/models"
+)
+
+func TestRenderTransferPreview(t *testing.T) {
+	files := map[string]models.FileInfo{
+		"notes": {FileName: "notes.txt", FileType: "text/plain", Size: 12, Preview: "one\ntwo\nthree\nfour"},
+		"photo": {FileName: "photo.jpg", FileType: ".jpg", Size: 2048},
+	}
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("z%02d.bin", i)
+		files[name] = models.FileInfo{FileName: name, Size: 1}
+	}
+
+	out := RenderTransferPreview(models.Info{Alias: "Swift Fox", DeviceModel: "linux"}, files)
+	for _, want := range []string{"Swift Fox", "14 file(s)", "three", "[image]", "...and 4 more"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("preview is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "four") {
+		t.Errorf("preview shows more than %d lines:\n%s", previewMaxLines, out)
+	}
+}
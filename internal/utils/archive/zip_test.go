@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZipDirRoundtrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a.txt":     "hello",
+		"sub/b.txt": "world",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "src.zip")
+	if err := ZipDir(src, zipPath); err != nil {
+		t.Fatalf("ZipDir: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "src")
+	if err := Unzip(zipPath, dest); err != nil {
+		t.Fatalf("Unzip: %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
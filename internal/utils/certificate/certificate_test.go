@@ -0,0 +1,21 @@
+package certificate
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreate_KeepsCertificate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "localsend-go", "certificate.pem")
+	first, err := LoadOrCreate(path, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadOrCreate(path, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Fingerprint(second.Certificate[0]), Fingerprint(first.Certificate[0]); got != want {
+		t.Fatalf("fingerprint changed from %s to %s", want, got)
+	}
+}
@@ -1,15 +1,97 @@
 package clipboard
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	clipboard "github.com/atotto/clipboard"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
 )
 
-func WriteToClipBoard(text string) {
-	err := clipboard.WriteAll(text)
-	if err != nil {
-		logger.Errorf("Error copying to clipboard: %v\n", err)
-	} else {
+// ErrWriteFailed is returned, wrapped, when received text could not be copied
+var ErrWriteFailed = errors.New("clipboard write failed")
+
+const (
+	// writeTimeout bounds how long a caller waits for a write, some X11 setups block
+	writeTimeout = 5 * time.Second
+	// holdDuration is how long the owner keeps copied text available
+	holdDuration = 5 * time.Minute
+	// holdCheckInterval is how often the owner checks that the text is still there
+	holdCheckInterval = 2 * time.Second
+)
+
+type writeRequest struct {
+	text string
+	done chan error
+}
+
+var (
+	ownerOnce sync.Once
+	requests  chan writeRequest
+)
+
+// WriteToClipBoard copies text to the system clipboard. The write is done by a
+// long-lived owner goroutine, so a blocking clipboard does not hold up the caller
+// for more than a few seconds.
+func WriteToClipBoard(text string) error {
+	ownerOnce.Do(func() {
+		requests = make(chan writeRequest)
+		go owner()
+	})
+
+	req := writeRequest{text: text, done: make(chan error, 1)}
+	timeout := time.NewTimer(writeTimeout)
+	defer timeout.Stop()
+	select {
+	case requests <- req:
+	case <-timeout.C:
+		return fmt.Errorf("%w: clipboard busy", ErrWriteFailed)
+	}
+	select {
+	case err := <-req.done:
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrWriteFailed, err)
+		}
 		logger.Success("Text copied to clipboard!")
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("%w: timed out after %s", ErrWriteFailed, writeTimeout)
+	}
+}
+
+// owner serializes clipboard writes and holds the last text for holdDuration: where
+// the clipboard empties once the process that set it exits (X11 without a clipboard
+// manager), it copies the text again
+func owner() {
+	var held string
+	var expires time.Time
+	ticker := time.NewTicker(holdCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case req := <-requests:
+			err := clipboard.WriteAll(req.text)
+			req.done <- err
+			if err == nil {
+				held, expires = req.text, time.Now().Add(holdDuration)
+			}
+		case now := <-ticker.C:
+			if held == "" {
+				continue
+			}
+			if now.After(expires) {
+				held = ""
+				continue
+			}
+			// Only restore an emptied clipboard, never replace what the user copied since
+			if current, err := clipboard.ReadAll(); err != nil || current == "" {
+				logger.Debugf("Clipboard was cleared, copying the received text again")
+				if err := clipboard.WriteAll(held); err != nil {
+					held = ""
+				}
+			}
+		}
 	}
 }
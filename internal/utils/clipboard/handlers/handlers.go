@@ -0,0 +1,58 @@
+// Package handlers dispatches the preview content of received files to
+// clipboard-like actions, chosen by file type
+package handlers
+
+import (
+	"sync"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// Handler acts on the content of a received file
+type Handler interface {
+	CanHandle(fileInfo models.FileInfo) bool
+	Handle(content []byte) error
+}
+
+var (
+	registered []Handler
+	mu         sync.RWMutex
+)
+
+// Register adds a handler. Handlers are consulted in registration order.
+func Register(h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, h)
+}
+
+// RegisterDefaults registers the built-in handlers for text, URL, Markdown and vCard files
+func RegisterDefaults() {
+	Register(textHandler{})
+	Register(urlHandler{})
+	Register(markdownHandler{})
+	Register(vcardHandler{})
+}
+
+// Dispatch passes the preview of fileInfo to the first handler that accepts it.
+// It reports whether a handler was found, and the handler's error.
+func Dispatch(fileInfo models.FileInfo) (bool, error) {
+	if fileInfo.Preview == "" {
+		return false, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range registered {
+		if !h.CanHandle(fileInfo) {
+			continue
+		}
+		err := h.Handle([]byte(fileInfo.Preview))
+		if err != nil {
+			logger.Errorf("Failed to handle %s: %v", fileInfo.FileName, err)
+		}
+		return true, err
+	}
+	return false, nil
+}
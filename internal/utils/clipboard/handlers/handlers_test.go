@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	in := "# Title\n\nSome **bold** and _italic_ text with `code` and a [link](https://example.com).\n\n> quoted\n\n![logo](logo.png)"
+	want := "Title\n\nSome bold and italic text with code and a link.\n\nquoted\n\nlogo"
+	if got := stripMarkdown(in); got != want {
+		t.Fatalf("stripMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestParseShortcut(t *testing.T) {
+	got, err := parseShortcut([]byte("[InternetShortcut]\r\nURL=https://example.com/a?b=c\r\n"))
+	if err != nil || got != "https://example.com/a?b=c" {
+		t.Fatalf("parseShortcut() = %q, %v", got, err)
+	}
+	if _, err := parseShortcut([]byte("[InternetShortcut]\nURL=file:///etc/passwd\n")); err == nil {
+		t.Fatal("non-http URLs must be rejected")
+	}
+}
+
+func TestRemoveContactFiles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "localsend-contact-1.vcf")
+	if err := os.WriteFile(name, []byte("BEGIN:VCARD\nEND:VCARD\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	contactFilesMu.Lock()
+	contactFiles[name] = true
+	contactFilesMu.Unlock()
+
+	RemoveContactFiles()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("contact file still exists: %v", err)
+	}
+	// The delayed removal after the import must not fail once the file is gone
+	removeContactFile(name)
+}
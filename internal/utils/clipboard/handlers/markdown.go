@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/clipboard"
+)
+
+// markdownHandler copies Markdown to the clipboard as plain text
+type markdownHandler struct{}
+
+func (markdownHandler) CanHandle(fileInfo models.FileInfo) bool {
+	return hasExt(fileInfo.FileName, ".md") || hasExt(fileInfo.FileName, ".markdown")
+}
+
+func (markdownHandler) Handle(content []byte) error {
+	return clipboard.WriteToClipBoard(stripMarkdown(string(content)))
+}
+
+var (
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdHeading    = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+`)
+	mdQuote      = regexp.MustCompile(`(?m)^[ \t]{0,3}>[ \t]?`)
+	mdFence      = regexp.MustCompile("(?m)^[ \\t]*```.*$\n?")
+	mdEmphasis   = regexp.MustCompile(`(\*\*|__|\*|_|~~)([^*_~\n]+)(\*\*|__|\*|_|~~)`)
+	mdInlineCode = regexp.MustCompile("`([^`]*)`")
+	mdRule       = regexp.MustCompile(`(?m)^[ \t]{0,3}([-*_][ \t]*){3,}$`)
+)
+
+// stripMarkdown removes the most common Markdown formatting and keeps the text
+func stripMarkdown(s string) string {
+	s = mdFence.ReplaceAllString(s, "")
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdHeading.ReplaceAllString(s, "")
+	s = mdQuote.ReplaceAllString(s, "")
+	s = mdRule.ReplaceAllString(s, "")
+	s = mdInlineCode.ReplaceAllString(s, "$1")
+	s = mdEmphasis.ReplaceAllString(s, "$2")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/clipboard"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// hasExt reports whether fileName has the extension ext, ignoring case
+func hasExt(fileName, ext string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ext)
+}
+
+// textHandler copies plain text to the clipboard
+type textHandler struct{}
+
+func (textHandler) CanHandle(fileInfo models.FileInfo) bool {
+	return hasExt(fileInfo.FileName, ".txt")
+}
+
+func (textHandler) Handle(content []byte) error {
+	logger.Success("TXT file content preview:", string(content))
+	return clipboard.WriteToClipBoard(string(content))
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/open"
+)
+
+// urlHandler opens Internet shortcut (.url) files in the default browser
+type urlHandler struct{}
+
+func (urlHandler) CanHandle(fileInfo models.FileInfo) bool {
+	return hasExt(fileInfo.FileName, ".url")
+}
+
+func (urlHandler) Handle(content []byte) error {
+	target, err := parseShortcut(content)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Opening %s in browser", target)
+	return open.Open(target)
+}
+
+// parseShortcut extracts the URL= entry of an Internet shortcut. Only http(s)
+// links are accepted since the content comes from another device.
+func parseShortcut(content []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(strings.ToUpper(line), "URL=") {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(line[len("URL="):]))
+		if err != nil {
+			return "", fmt.Errorf("invalid URL in shortcut: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("refusing to open %q URL", u.Scheme)
+		}
+		return u.String(), nil
+	}
+	return "", fmt.Errorf("no URL entry in shortcut")
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/meowrain/localsend-go/internal/models"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/open"
+)
+
+// importGrace is how long a contact file is kept after the opener exits: open and
+// xdg-open return before the contacts application has read the file
+const importGrace = time.Minute
+
+var (
+	contactFilesMu sync.Mutex
+	contactFiles   = make(map[string]bool) // Temp files not yet removed
+)
+
+// vcardHandler hands vCard files to the platform contacts application for import
+type vcardHandler struct{}
+
+func (vcardHandler) CanHandle(fileInfo models.FileInfo) bool {
+	return hasExt(fileInfo.FileName, ".vcf")
+}
+
+func (vcardHandler) Handle(content []byte) error {
+	tmp, err := os.CreateTemp("", "localsend-contact-*.vcf")
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(name)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(name)
+		return err
+	}
+	logger.Info("Importing contact from ", name)
+	cmd := open.Command(name)
+	if err := cmd.Start(); err != nil {
+		os.Remove(name)
+		return err
+	}
+	contactFilesMu.Lock()
+	contactFiles[name] = true
+	contactFilesMu.Unlock()
+	go func() {
+		cmd.Wait()
+		time.Sleep(importGrace)
+		removeContactFile(name)
+	}()
+	return nil
+}
+
+// removeContactFile deletes a contact file unless RemoveContactFiles already did
+func removeContactFile(name string) {
+	contactFilesMu.Lock()
+	defer contactFilesMu.Unlock()
+	if !contactFiles[name] {
+		return
+	}
+	delete(contactFiles, name)
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		logger.Debugf("Failed to remove %s: %v", name, err)
+	}
+}
+
+// RemoveContactFiles deletes the contact files still waiting to be imported, on exit
+func RemoveContactFiles() {
+	contactFilesMu.Lock()
+	names := make([]string, 0, len(contactFiles))
+	for name := range contactFiles {
+		names = append(names, name)
+	}
+	contactFilesMu.Unlock()
+	for _, name := range names {
+		removeContactFile(name)
+	}
+}
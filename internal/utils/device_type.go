@@ -0,0 +1,36 @@
+package utils
+
+// Hardware classes reported by DetectHardwareClass
+const (
+	HardwareDesktop = "desktop"
+	HardwareLaptop  = "laptop"
+	HardwareServer  = "server"
+	HardwareMobile  = "mobile"
+)
+
+// chassisClass maps an SMBIOS chassis type code to a hardware class
+func chassisClass(code int) (string, bool) {
+	switch code {
+	case 8, 9, 10, 11, 12, 14, 18, 21, 30, 31, 32: // Portable, laptop, notebook, tablet, convertible...
+		return HardwareLaptop, true
+	case 17, 23, 28, 29: // Main server chassis, rack mount, blade
+		return HardwareServer, true
+	case 3, 4, 5, 6, 7, 13, 15, 16, 24, 35, 36: // Desktop, tower, all-in-one, mini PC...
+		return HardwareDesktop, true
+	}
+	return "", false
+}
+
+// DetectDeviceType returns the LocalSend device type to advertise for this machine.
+// The protocol has no laptop type, so laptops are announced as desktops.
+// https://github.com/localsend/protocol?tab=readme-ov-file#71-device-type
+func DetectDeviceType() string {
+	switch DetectHardwareClass() {
+	case HardwareServer:
+		return "server"
+	case HardwareMobile:
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// DetectHardwareClass reads the Mac model name from system_profiler. Defaults to desktop.
+func DetectHardwareClass() string {
+	out, err := exec.Command("system_profiler", "SPHardwareDataType").Output()
+	if err != nil {
+		return HardwareDesktop
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "Model Name:") && !strings.HasPrefix(line, "Model Identifier:") {
+			continue
+		}
+		if strings.Contains(line, "MacBook") {
+			return HardwareLaptop
+		}
+		if strings.Contains(line, "Xserve") {
+			return HardwareServer
+		}
+	}
+	return HardwareDesktop
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DetectHardwareClass guesses the hardware class from the DMI chassis type,
+// falling back to battery and display detection. Defaults to desktop.
+func DetectHardwareClass() string {
+	if data, err := os.ReadFile("/sys/class/dmi/id/chassis_type"); err == nil {
+		if code, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			if class, ok := chassisClass(code); ok {
+				return class
+			}
+		}
+	}
+
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*/type")
+	for _, supply := range supplies {
+		if data, err := os.ReadFile(supply); err == nil && strings.TrimSpace(string(data)) == "Battery" {
+			return HardwareLaptop
+		}
+	}
+
+	if !hasDisplay() {
+		return HardwareServer
+	}
+	return HardwareDesktop
+}
+
+// hasDisplay reports whether a graphical session or a connected monitor is present
+func hasDisplay() bool {
+	if os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" {
+		return true
+	}
+	connectors, _ := filepath.Glob("/sys/class/drm/*/status")
+	for _, connector := range connectors {
+		if data, err := os.ReadFile(connector); err == nil && strings.TrimSpace(string(data)) == "connected" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package utils
+
+import "runtime"
+
+// DetectHardwareClass has no detection on this platform. Defaults to desktop.
+func DetectHardwareClass() string {
+	if runtime.GOOS == "android" || runtime.GOOS == "ios" {
+		return HardwareMobile
+	}
+	return HardwareDesktop
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DetectHardwareClass queries the WMI chassis type. Defaults to desktop.
+func DetectHardwareClass() string {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command",
+		"(Get-CimInstance -ClassName Win32_SystemEnclosure).ChassisTypes").Output()
+	if err != nil {
+		return HardwareDesktop
+	}
+	for _, field := range strings.Fields(string(out)) {
+		if code, err := strconv.Atoi(field); err == nil {
+			if class, ok := chassisClass(code); ok {
+				return class
+			}
+		}
+	}
+	return HardwareDesktop
+}
@@ -0,0 +1,209 @@
+// Package encryption encrypts file contents with a passphrase, independent of TLS.
+// An encrypted stream is a header of Magic and a random salt, followed by chunks of
+// up to chunkSize bytes sealed with AES-256-GCM. The key is derived from the
+// passphrase and salt with Argon2id, so each stream has its own key and the chunk
+// number can serve as nonce. The last chunk is marked, a truncated stream fails to
+// decrypt.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Magic starts every encrypted stream
+var Magic = []byte("LSGOENC1")
+
+const (
+	saltSize   = 16
+	headerSize = 8 + saltSize // Magic and salt
+	chunkSize  = 64 << 10
+	tagSize    = 16 // GCM authentication tag of each chunk
+
+	// Argon2id parameters, as recommended by RFC 9106 for constrained memory
+	argonTime    = 3
+	argonMemory  = 64 << 10 // KiB
+	argonThreads = 4
+	keySize      = 32 // AES-256
+)
+
+// ErrDecrypt is returned for a wrong passphrase or a corrupted or truncated stream
+var ErrDecrypt = errors.New("decryption failed: wrong passphrase or corrupted data")
+
+// IsEncrypted reports whether data starts with the header of an encrypted stream
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+// EncryptedSize returns the size of the encrypted stream of size plaintext bytes
+func EncryptedSize(size int64) int64 {
+	chunks := max((size+chunkSize-1)/chunkSize, 1) // Empty input still has a last chunk
+	return headerSize + size + chunks*tagSize
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of chunk n
+func nonce(aead cipher.AEAD, n uint64) []byte {
+	b := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(b[len(b)-8:], n)
+	return b
+}
+
+// chunkData is the additional data of a chunk, it tells the last chunk apart
+func chunkData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// writer encrypts what is written to it, Close writes the last chunk
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte // Written with the first chunk
+	buf    []byte
+	n      uint64
+	closed bool
+}
+
+// NewWriter returns a writer that encrypts to w with passphrase. Nothing is written
+// to w before the first chunk is complete. Close must be called to complete the
+// stream; it does not close w.
+func NewWriter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	header := make([]byte, headerSize)
+	copy(header, Magic)
+	if _, err := rand.Read(header[len(Magic):]); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, header[len(Magic):])
+	if err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, header: header, buf: make([]byte, 0, chunkSize+tagSize)}, nil
+}
+
+func (e *writer) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("encryption: write after close")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, the last one is marked
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *writer) seal(last bool) error {
+	if e.header != nil {
+		if _, err := e.w.Write(e.header); err != nil {
+			return err
+		}
+		e.header = nil
+	}
+	sealed := e.aead.Seal(e.buf[:0], nonce(e.aead, e.n), e.buf, chunkData(last))
+	e.n++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *writer) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+// reader decrypts an encrypted stream
+type reader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	chunk []byte // Sealed chunk being read
+	plain []byte // Decrypted data not yet returned
+	n     uint64
+	done  bool
+}
+
+// NewReader returns a reader of the plaintext of the encrypted stream r
+func NewReader(r io.Reader, passphrase string) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDecrypt
+	}
+	if !IsEncrypted(header) {
+		return nil, errors.New("encryption: not an encrypted stream")
+	}
+	aead, err := newAEAD(passphrase, header[len(Magic):])
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: bufio.NewReaderSize(r, chunkSize+tagSize), aead: aead, chunk: make([]byte, chunkSize+tagSize)}, nil
+}
+
+func (d *reader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk
+func (d *reader) next() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	last := err == io.ErrUnexpectedEOF
+	switch {
+	case err == nil:
+		// A full chunk is the last one when nothing follows it
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case err == io.EOF:
+		return ErrDecrypt // Truncated before the last chunk
+	case !last:
+		return err
+	}
+	plain, err := d.aead.Open(d.chunk[:0], nonce(d.aead, d.n), d.chunk[:n], chunkData(last))
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.n++
+	d.plain = plain
+	d.done = last
+	return nil
+}
@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encrypt(t *testing.T, plain []byte, passphrase string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := NewWriter(&out, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd write sizes cross chunk boundaries
+	for rest := plain; len(rest) > 0; {
+		n := min(len(rest), 10007)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		sealed := encrypt(t, plain, "secret")
+		if !IsEncrypted(sealed) {
+			t.Fatalf("%d bytes: no header", size)
+		}
+		if int64(len(sealed)) != EncryptedSize(int64(size)) {
+			t.Errorf("%d bytes: encrypted to %d, EncryptedSize says %d", size, len(sealed), EncryptedSize(int64(size)))
+		}
+		r, err := NewReader(bytes.NewReader(sealed), "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: decrypted data differs", size)
+		}
+	}
+}
+
+func TestDecryptFails(t *testing.T) {
+	plain := make([]byte, 2*chunkSize+100)
+	sealed := encrypt(t, plain, "secret")
+
+	tampered := bytes.Clone(sealed)
+	tampered[headerSize+10] ^= 1
+	tests := map[string]struct {
+		data       []byte
+		passphrase string
+	}{
+		"wrong passphrase":       {sealed, "wrong"},
+		"tampered":               {tampered, "secret"},
+		"truncated in a chunk":   {sealed[:len(sealed)-50], "secret"},
+		"truncated at a chunk":   {sealed[:headerSize+2*(chunkSize+tagSize)], "secret"},
+		"truncated after header": {sealed[:headerSize], "secret"},
+	}
+	for name, tt := range tests {
+		r, err := NewReader(bytes.NewReader(tt.data), tt.passphrase)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrDecrypt)
+		}
+	}
+}
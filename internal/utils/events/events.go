@@ -0,0 +1,52 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	enabled bool
+	output  io.Writer = os.Stdout
+	mu      sync.Mutex
+)
+
+// Enable turns on machine-readable event output (--json)
+func Enable(on bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = on
+}
+
+// Enabled reports whether JSON events are emitted
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// SetOutput changes where events are written, stdout by default
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+// Emit writes one JSON line {"event": name, "ts": ..., fields...} when JSON mode is on
+func Emit(name string, fields map[string]interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return
+	}
+	event := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		event[k] = v
+	}
+	event["event"] = name
+	event["ts"] = time.Now().UTC().Format(time.RFC3339)
+	json.NewEncoder(output).Encode(event)
+}
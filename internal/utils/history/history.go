@@ -0,0 +1,162 @@
+// Package history keeps a log of completed and failed transfers in a JSON lines file.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxEntries caps the history file; the oldest entries are pruned
+const MaxEntries = 10000
+
+// Transfer directions
+const (
+	DirectionSend    = "send"
+	DirectionReceive = "receive"
+)
+
+// Record is one transferred file
+type Record struct {
+	Time       time.Time `json:"ts"`
+	Direction  string    `json:"direction"`
+	PeerAlias  string    `json:"peer_alias"`
+	PeerIP     string    `json:"peer_ip"`
+	File       string    `json:"file"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Filter selects records in Query. Zero values match everything.
+type Filter struct {
+	Last  int       // Only the last N matching records
+	Since time.Time // Records at or after this time
+	Peer  string    // Peer alias, case-insensitive
+}
+
+var (
+	mu     sync.Mutex
+	counts = make(map[string]int) // Entries per history file, counted on first append
+)
+
+// Append adds a record to the history file at path, pruning old entries beyond MaxEntries
+func Append(path string, record Record) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	count, ok := counts[path]
+	if !ok {
+		if count, err = countLines(path); err != nil {
+			return err
+		}
+	}
+	if count >= MaxEntries {
+		// Prune to 90% so the file isn't rewritten on every append
+		if count, err = prune(path, MaxEntries*9/10); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	counts[path] = count + 1
+	return nil
+}
+
+// Query reads the history file and returns the records matching filter, oldest first
+func Query(path string, filter Filter) ([]Record, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // Skip damaged lines
+		}
+		if !filter.Since.IsZero() && record.Time.Before(filter.Since) {
+			continue
+		}
+		if filter.Peer != "" && !strings.EqualFold(record.PeerAlias, filter.Peer) {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if filter.Last > 0 && len(records) > filter.Last {
+		records = records[len(records)-filter.Last:]
+	}
+	return records, nil
+}
+
+// countLines returns the number of lines in path, 0 if it doesn't exist
+func countLines(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return bytes.Count(data, []byte{'\n'}), nil
+}
+
+// prune keeps the last keep lines of path and returns how many are left
+func prune(path string, keep int) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= keep {
+		return len(lines), nil
+	}
+	lines = lines[len(lines)-keep:]
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bytes.Join(lines, nil), 0o600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return len(lines), nil
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	base := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
+	for i, peer := range []string{"Alice", "Bob", "alice", "Carol"} {
+		err := Append(path, Record{
+			Time:      base.Add(time.Duration(i) * time.Hour),
+			Direction: DirectionSend,
+			PeerAlias: peer,
+			File:      "photo.jpg",
+			OK:        true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := Query(path, Filter{})
+	if err != nil || len(all) != 4 {
+		t.Fatalf("got %d records, err %v", len(all), err)
+	}
+	if got, _ := Query(path, Filter{Peer: "ALICE"}); len(got) != 2 {
+		t.Errorf("peer filter: got %d records, want 2", len(got))
+	}
+	if got, _ := Query(path, Filter{Since: base.Add(90 * time.Minute)}); len(got) != 2 {
+		t.Errorf("since filter: got %d records, want 2", len(got))
+	}
+	got, _ := Query(path, Filter{Last: 1})
+	if len(got) != 1 || got[0].PeerAlias != "Carol" {
+		t.Errorf("last filter: got %+v", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	for i := 0; i < MaxEntries+5; i++ {
+		if err := Append(path, Record{File: "f", Size: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := Query(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) > MaxEntries {
+		t.Fatalf("history has %d entries, cap is %d", len(records), MaxEntries)
+	}
+	if last := records[len(records)-1]; last.Size != MaxEntries+4 {
+		t.Errorf("newest entry was pruned: %+v", last)
+	}
+}
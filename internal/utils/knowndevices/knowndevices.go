@@ -0,0 +1,114 @@
+// Package knowndevices remembers the certificates of devices connected to over TLS,
+// trusting each on first use like SSH known hosts. Devices are keyed by certificate
+// fingerprint, as aliases are neither unique nor authenticated, and the address a
+// device was last seen at is kept to recognize it when it announces nothing.
+package knowndevices
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device is a remembered device
+type Device struct {
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of its certificate, hex
+	Alias       string    `json:"alias"`
+	Address     string    `json:"address,omitempty"` // Where it was last connected to
+	QUIC        bool      `json:"quic,omitempty"`    // Only seen over HTTP/3, it may serve plain http over TCP
+	FirstSeen   time.Time `json:"firstSeen"`
+}
+
+var mu sync.Mutex
+
+// Find returns the device with the certificate fingerprint
+func Find(path, fingerprint string) (Device, bool, error) {
+	return find(path, func(device Device) bool { return strings.EqualFold(device.Fingerprint, fingerprint) })
+}
+
+// FindAddress returns the device last connected to at address
+func FindAddress(path, address string) (Device, bool, error) {
+	return find(path, func(device Device) bool { return device.Address != "" && device.Address == address })
+}
+
+func find(path string, match func(Device) bool) (Device, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	devices, err := read(path)
+	if err != nil {
+		return Device{}, false, err
+	}
+	for _, device := range devices {
+		if match(device) {
+			return device, true, nil
+		}
+	}
+	return Device{}, false, nil
+}
+
+// Remember records device, or updates the alias and address of the remembered device
+// with its fingerprint. Other devices last seen at its address lose that address. It
+// reports whether the device is new.
+func Remember(path string, device Device) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	devices, err := read(path)
+	if err != nil {
+		return false, err
+	}
+	device.Fingerprint = strings.ToLower(device.Fingerprint)
+	added := true
+	for i := range devices {
+		switch {
+		case devices[i].Fingerprint == device.Fingerprint:
+			added = false
+			if device.Alias != "" {
+				devices[i].Alias = device.Alias
+			}
+			devices[i].Address = device.Address
+			devices[i].QUIC = devices[i].QUIC && device.QUIC
+		case device.Address != "" && devices[i].Address == device.Address:
+			devices[i].Address = ""
+		}
+	}
+	if added {
+		device.FirstSeen = time.Now().UTC()
+		devices = append(devices, device)
+	}
+	return added, write(path, devices)
+}
+
+// read loads the file, empty if it doesn't exist
+func read(path string) ([]Device, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var devices []Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// write replaces the file atomically
+func write(path string, devices []Device) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
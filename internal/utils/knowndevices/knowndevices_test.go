@@ -0,0 +1,40 @@
+package knowndevices
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRemember(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_devices.json")
+	added, err := Remember(path, Device{Fingerprint: "ABC123", Alias: "phone", Address: "10.0.0.2"})
+	if err != nil || !added {
+		t.Fatalf("first device: added %v, %v", added, err)
+	}
+	device, ok, err := Find(path, "abc123")
+	if err != nil || !ok || device.Alias != "phone" || device.FirstSeen.IsZero() {
+		t.Fatalf("find: %+v %v %v", device, ok, err)
+	}
+
+	// Two devices may share an alias, they are told apart by fingerprint
+	if added, err := Remember(path, Device{Fingerprint: "def456", Alias: "phone", Address: "10.0.0.3"}); err != nil || !added {
+		t.Fatalf("same alias: added %v, %v", added, err)
+	}
+	for address, want := range map[string]string{"10.0.0.2": "abc123", "10.0.0.3": "def456"} {
+		if device, ok, err := FindAddress(path, address); err != nil || !ok || device.Fingerprint != want {
+			t.Errorf("%s: got %+v %v %v", address, device, ok, err)
+		}
+	}
+
+	// A known device that moved takes its address from the device seen there before
+	first := device.FirstSeen
+	if added, err := Remember(path, Device{Fingerprint: "abc123", Address: "10.0.0.3"}); err != nil || added {
+		t.Fatalf("moved: added %v, %v", added, err)
+	}
+	if device, _, _ := FindAddress(path, "10.0.0.3"); device.Fingerprint != "abc123" || device.Alias != "phone" || !device.FirstSeen.Equal(first) {
+		t.Errorf("moved device: %+v", device)
+	}
+	if _, ok, _ := FindAddress(path, "10.0.0.2"); ok {
+		t.Error("old address still known")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
@@ -25,6 +26,7 @@ type LogConfig struct {
 var (
 	logger *Logger
 	once   sync.Once
+	level  atomic.Int32 // Current level, consulted by every log call
 
 	// ANSI 颜色代码
 	green = "\033[32m"
@@ -57,6 +59,7 @@ func InitLogger(config ...LogConfig) {
 		log.SetOutput(cfg.Output)
 		log.SetFormatter(cfg.Formatter)
 		log.SetLevel(cfg.Level)
+		level.Store(int32(cfg.Level))
 		log.SetReportCaller(cfg.ReportCaller)
 
 		logger = &Logger{log}
@@ -70,6 +73,31 @@ func checkLogger() {
 	}
 }
 
+// SetOutput changes where messages are written
+func SetOutput(w io.Writer) {
+	checkLogger()
+	logger.SetOutput(w)
+}
+
+// enabled reports whether messages at l are logged
+func enabled(l logrus.Level) bool {
+	checkLogger()
+	return logrus.Level(level.Load()) >= l
+}
+
+// SetLevel changes the log level immediately, for all goroutines
+func SetLevel(l logrus.Level) {
+	checkLogger()
+	level.Store(int32(l))
+	logger.SetLevel(l)
+}
+
+// GetLevel returns the current log level
+func GetLevel() logrus.Level {
+	checkLogger()
+	return logrus.Level(level.Load())
+}
+
 // GetLogger 返回底层 Logger 实例
 func GetLogger() *Logger {
 	checkLogger()
@@ -78,71 +106,95 @@ func GetLogger() *Logger {
 
 // Success 打印带有绿色 [Success] 标签的信息
 func Success(args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.InfoLevel) {
+		return
+	}
 	logger.Infof("%s[Success]%s %s", green, reset, fmt.Sprint(args...))
 }
 
 // Successf 打印带有绿色 [Success] 标签的格式化信息
 func Successf(format string, args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.InfoLevel) {
+		return
+	}
 	logger.Infof("%s[Success]%s %s", green, reset, fmt.Sprintf(format, args...))
 }
 
 // Failed 打印带有红色 [Failed] 标签的信息
 func Failed(args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.ErrorLevel) {
+		return
+	}
 	logger.Errorf("%s[Failed]%s %s", red, reset, fmt.Sprint(args...))
 }
 
 // Failedf 打印带有红色 [Failed] 标签的格式化信息
 func Failedf(format string, args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.ErrorLevel) {
+		return
+	}
 	logger.Errorf("%s[Failed]%s %s", red, reset, fmt.Sprintf(format, args...))
 }
 
 func Debug(args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.DebugLevel) {
+		return
+	}
 	logger.Debug(args...)
 }
 
 func Debugf(format string, args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.DebugLevel) {
+		return
+	}
 	logger.Debugf(format, args...)
 }
 
 // Info 打印信息级别日志
 func Info(args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.InfoLevel) {
+		return
+	}
 	logger.Info(args...)
 }
 
 // Infof 打印信息级别日志（支持格式化）
 func Infof(format string, args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.InfoLevel) {
+		return
+	}
 	logger.Infof(format, args...)
 }
 
 // Warn 打印警告级别日志
 func Warn(args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.WarnLevel) {
+		return
+	}
 	logger.Warn(args...)
 }
 
 // Warnf 打印警告级别日志（支持格式化）
 func Warnf(format string, args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.WarnLevel) {
+		return
+	}
 	logger.Warnf(format, args...)
 }
 
 // Error 打印错误级别日志
 func Error(args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.ErrorLevel) {
+		return
+	}
 	logger.Error(args...)
 }
 
 // Errorf 打印错误级别日志（支持格式化）
 func Errorf(format string, args ...interface{}) {
-	checkLogger()
+	if !enabled(logrus.ErrorLevel) {
+		return
+	}
 	logger.Errorf(format, args...)
 }
 
@@ -0,0 +1,133 @@
+// Package manpage renders a roff man page from the command line flag definitions
+package manpage
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Entry is a term and its description, e.g. a file or environment variable
+type Entry struct {
+	Term        string
+	Description string
+}
+
+// Page holds the hand-written sections; OPTIONS is generated from the flags
+type Page struct {
+	Name        string
+	Section     int
+	Version     string
+	Date        time.Time
+	Summary     string   // One line for the NAME section
+	Synopsis    []string // Usage lines, without the program name
+	Description []string // Paragraphs
+	Commands    []Entry
+	Files       []Entry
+	Environment []Entry
+	Examples    []Entry // Description, then the command line
+	SeeAlso     []string
+}
+
+// Write renders page with an OPTIONS section listing every flag in flags
+func Write(w io.Writer, page Page, flags *flag.FlagSet) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, ".TH %s %d %q %q %q\n", strings.ToUpper(escape(page.Name)), page.Section,
+		page.Date.Format("2006-01-02"), page.Name+" "+page.Version, "User Commands")
+
+	fmt.Fprintln(out, ".SH NAME")
+	fmt.Fprintf(out, "%s \\- %s\n", escape(page.Name), escape(page.Summary))
+
+	fmt.Fprintln(out, ".SH SYNOPSIS")
+	for i, line := range page.Synopsis {
+		if i > 0 {
+			fmt.Fprintln(out, ".br")
+		}
+		fmt.Fprintf(out, ".B %s\n%s\n", escape(page.Name), escape(line))
+	}
+
+	fmt.Fprintln(out, ".SH DESCRIPTION")
+	for i, paragraph := range page.Description {
+		if i > 0 {
+			fmt.Fprintln(out, ".PP")
+		}
+		fmt.Fprintln(out, escape(paragraph))
+	}
+
+	writeEntries(out, "COMMANDS", page.Commands, true)
+
+	fmt.Fprintln(out, ".SH OPTIONS")
+	flags.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintln(out, ".TP")
+		if name != "" {
+			fmt.Fprintf(out, "\\fB\\-\\-%s\\fR=\\fI%s\\fR\n", escape(f.Name), escape(name))
+		} else {
+			fmt.Fprintf(out, "\\fB\\-\\-%s\\fR\n", escape(f.Name))
+		}
+		if hasDefault(f) {
+			usage += fmt.Sprintf(" (default: %s)", f.DefValue)
+		}
+		fmt.Fprintln(out, escape(usage))
+	})
+
+	writeEntries(out, "FILES", page.Files, false)
+	writeEntries(out, "ENVIRONMENT", page.Environment, false)
+
+	if len(page.Examples) > 0 {
+		fmt.Fprintln(out, ".SH EXAMPLES")
+		for _, example := range page.Examples {
+			fmt.Fprintf(out, ".PP\n%s\n.PP\n.RS\n.nf\n%s\n.fi\n.RE\n", escape(example.Description), escape(example.Term))
+		}
+	}
+
+	if len(page.SeeAlso) > 0 {
+		fmt.Fprintln(out, ".SH SEE ALSO")
+		refs := make([]string, len(page.SeeAlso))
+		for i, ref := range page.SeeAlso {
+			refs[i] = escape(ref)
+		}
+		fmt.Fprintln(out, strings.Join(refs, ", "))
+	}
+	return out.Flush()
+}
+
+// writeEntries writes a section of tagged paragraphs, the terms in bold or italics
+func writeEntries(out io.Writer, title string, entries []Entry, bold bool) {
+	if len(entries) == 0 {
+		return
+	}
+	font := "I"
+	if bold {
+		font = "B"
+	}
+	fmt.Fprintf(out, ".SH %s\n", title)
+	for _, entry := range entries {
+		fmt.Fprintf(out, ".TP\n\\f%s%s\\fR\n%s\n", font, escape(entry.Term), escape(entry.Description))
+	}
+}
+
+// hasDefault reports whether a flag's default is worth showing
+func hasDefault(f *flag.Flag) bool {
+	switch f.DefValue {
+	case "", "false", "0", "0s", "[]":
+		return false
+	}
+	return true
+}
+
+// escape quotes text for roff: backslashes, hyphens, and control characters at line starts
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,47 @@
+package manpage
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Int("port", 53317, "Server `port`")
+	flags.Bool("quiet", false, "Only print errors")
+
+	page := Page{
+		Name:     "localsend-go",
+		Section:  1,
+		Version:  "v1.2.3",
+		Date:     time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Summary:  "send files to LocalSend devices",
+		Synopsis: []string{"[options] send <path>..."},
+		Files:    []Entry{{Term: "~/.config/localsend-go/history.jsonl", Description: "Transfer history"}},
+		Examples: []Entry{{Term: ".hidden", Description: "Starts with a dot"}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, page, flags); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`.TH LOCALSEND\-GO 1 "2024-01-15" "localsend-go v1.2.3" "User Commands"`,
+		".SH NAME\nlocalsend\\-go \\- send files to LocalSend devices\n",
+		"\\fB\\-\\-port\\fR=\\fIport\\fR\nServer port (default: 53317)\n",
+		"\\fB\\-\\-quiet\\fR\nOnly print errors\n",
+		".SH FILES\n.TP\n\\fI~/.config/localsend\\-go/history.jsonl\\fR\n",
+		"\\&.hidden",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, ".SH ENVIRONMENT") {
+		t.Error("empty ENVIRONMENT section written")
+	}
+}
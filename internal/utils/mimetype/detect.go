@@ -0,0 +1,159 @@
+// Package mimetype finds the MIME type of files to send, from their first bytes
+// and their extension
+package mimetype
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default is the type of files with no extension, or of unknown binary content
+const Default = "application/octet-stream"
+
+// sniffLen is how much of a file http.DetectContentType looks at
+const sniffLen = 512
+
+// byExtension maps common extensions to their MIME type. mime.TypeByExtension
+// depends on the system's mime.types, this table gives the same answer everywhere.
+var byExtension = map[string]string{
+	".7z":   "application/x-7z-compressed",
+	".aac":  "audio/aac",
+	".apk":  "application/vnd.android.package-archive",
+	".avi":  "video/x-msvideo",
+	".bmp":  "image/bmp",
+	".csv":  "text/csv",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".epub": "application/epub+zip",
+	".flac": "audio/flac",
+	".gif":  "image/gif",
+	".gz":   "application/gzip",
+	".heic": "image/heic",
+	".htm":  "text/html",
+	".html": "text/html",
+	".ico":  "image/x-icon",
+	".jar":  "application/java-archive",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".js":   "text/javascript",
+	".json": "application/json",
+	".m4a":  "audio/mp4",
+	".md":   "text/markdown",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ogg":  "audio/ogg",
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".rar":  "application/vnd.rar",
+	".svg":  "image/svg+xml",
+	".tar":  "application/x-tar",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".txt":  "text/plain",
+	".vcf":  "text/vcard",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".webp": "image/webp",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xml":  "application/xml",
+	".zip":  "application/zip",
+}
+
+// containers are sniffed types that many formats are built on: a .docx is sniffed
+// as a ZIP archive, an .svg as XML. The extension tells those apart, so it wins.
+var containers = map[string]bool{
+	"application/zip":    true,
+	"application/x-gzip": true,
+	"text/xml":           true,
+	"application/ogg":    true,
+	"video/webm":         true, // Matroska
+	"video/mp4":          true, // Also M4A, MOV and HEIC
+	"audio/wave":         true, // Sniffed as audio/wave, the table says audio/wav
+}
+
+type cached struct {
+	size    int64
+	modTime time.Time
+	mime    string
+}
+
+var cache sync.Map // Path to cached
+
+// Detect returns the MIME type of the file at path. Content and extension usually
+// agree; where they don't, the content wins. Files without an extension are
+// application/octet-stream. Results are cached until the file changes.
+func Detect(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if entry, ok := cache.Load(path); ok {
+		if c := entry.(cached); c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+			return c.mime, nil
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return Default, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	byExt := byExtension[ext]
+	if byExt == "" {
+		byExt, _, _ = mime.ParseMediaType(mime.TypeByExtension(ext))
+	}
+	result := choose(byExt, sniff(head[:n]))
+	cache.Store(path, cached{size: info.Size(), modTime: info.ModTime(), mime: result})
+	return result, nil
+}
+
+// sniff returns the type http.DetectContentType finds, without parameters
+func sniff(head []byte) string {
+	if len(head) == 0 {
+		return ""
+	}
+	sniffed, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return ""
+	}
+	return sniffed
+}
+
+// choose picks between the type of the extension and the sniffed type
+func choose(byExt, sniffed string) string {
+	// Only "some binary" or "some text": the extension says more
+	generic := sniffed == "" || sniffed == Default || sniffed == "text/plain"
+	switch {
+	case byExt == "" && sniffed == "":
+		return Default
+	case byExt == "":
+		return sniffed
+	case generic, containers[sniffed]:
+		return byExt
+	}
+	return sniffed
+}
@@ -0,0 +1,53 @@
+package mimetype
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"photo.png", png, "image/png"},
+		{"photo.jpg", png, "image/png"}, // Conflict: the content wins
+		{"notes.txt", []byte("hello"), "text/plain"},
+		{"data.json", []byte(`{"a": 1}`), "application/json"},
+		{"letter.docx", zip, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"archive.zip", zip, "application/zip"},
+		{"README", []byte("hello"), Default},
+		{"image", png, Default},
+		{"blob.unknownext", []byte{0, 1, 2, 3}, Default},
+		{"page.unknownext", png, "image/png"},
+		{"empty.pdf", nil, "application/pdf"},
+		{"UPPER.PNG", png, "image/png"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Detect(path)
+		if err != nil || got != tt.want {
+			t.Errorf("Detect(%s) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestDetectCacheFollowsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(path, []byte{0, 1, 2}, 0o644)
+	if got, _ := Detect(path); got != Default {
+		t.Fatalf("got %q, want %q", got, Default)
+	}
+	os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644)
+	if got, _ := Detect(path); got != "image/png" {
+		t.Fatalf("got %q after the file changed, want image/png", got)
+	}
+}
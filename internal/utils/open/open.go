@@ -0,0 +1,43 @@
+package open
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+)
+
+// command returns the program and arguments that open target with the OS default application
+func command(target string) (string, []string) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "open", []string{target}
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", target}
+	default:
+		return "xdg-open", []string{target}
+	}
+}
+
+// Command returns the command that opens target (a file path or URL) with
+// the OS default application
+func Command(target string) *exec.Cmd {
+	name, args := command(target)
+	return exec.Command(name, args...)
+}
+
+// Open opens target with the OS default application without waiting for it to exit.
+// The opener is reaped in the background so it does not linger as a zombie.
+func Open(target string) error {
+	cmd := Command(target)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Run opens target and waits for the opener to exit, killing it when ctx is done
+func Run(ctx context.Context, target string) error {
+	name, args := command(target)
+	return exec.CommandContext(ctx, name, args...).Run()
+}
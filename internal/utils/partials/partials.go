@@ -0,0 +1,145 @@
+// Package partials keeps an index of the partial files of interrupted uploads in a
+// JSON file, so a later session sending the same file can continue where the
+// interrupted one stopped. The data received so far is the partial file itself, its
+// size is where the upload continues.
+package partials
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is the partial file of an interrupted upload. Fingerprint, Name, Size and
+// SHA256 identify the file; an upload only continues one of the same sender, name,
+// size and content hash.
+type Entry struct {
+	Fingerprint string    `json:"fingerprint"` // Sender
+	Name        string    `json:"name"`        // File name sent, may include directories
+	Size        int64     `json:"size"`        // Size of the whole file
+	SHA256      string    `json:"sha256"`      // SHA256 of the whole file
+	Path        string    `json:"path"`        // Partial file on disk
+	Updated     time.Time `json:"updated"`     // Last interruption, entries expire relative to it
+}
+
+// matches reports whether e and other are partial files of the same file
+func (e Entry) matches(other Entry) bool {
+	return e.Fingerprint == other.Fingerprint && e.Name == other.Name && e.Size == other.Size && e.SHA256 == other.SHA256
+}
+
+var mu sync.Mutex
+
+// Put records a partial file in the index at path, replacing the entry of the same
+// file. Entries without an update time get the current time.
+func Put(path string, entry Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := read(path)
+	if err != nil {
+		return err
+	}
+	if entry.Updated.IsZero() {
+		entry.Updated = time.Now().UTC()
+	}
+	kept := index[:0]
+	for _, existing := range index {
+		if !existing.matches(entry) {
+			kept = append(kept, existing)
+		}
+	}
+	return write(path, append(kept, entry))
+}
+
+// Find returns the partial file of the same file as match
+func Find(path string, match Entry) (Entry, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := read(path)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	for _, entry := range index {
+		if entry.matches(match) {
+			return entry, true, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// Take removes the partial file of the same file as match from the index and
+// returns it. The file itself is left on disk.
+func Take(path string, match Entry) (Entry, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := read(path)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	for i, entry := range index {
+		if entry.matches(match) {
+			return entry, true, write(path, append(index[:i], index[i+1:]...))
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// Expire removes the entries last updated longer than expiry ago from the index and
+// returns them, so their files can be deleted
+func Expire(path string, expiry time.Duration) ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	var expired []Entry
+	kept := make([]Entry, 0, len(index))
+	for _, entry := range index {
+		if time.Since(entry.Updated) > expiry {
+			expired = append(expired, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	return expired, write(path, kept)
+}
+
+// read loads the index file, empty if it doesn't exist
+func read(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index []Entry
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// write replaces the index file atomically
+func write(path string, index []Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if index == nil {
+		index = []Entry{}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
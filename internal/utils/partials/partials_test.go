@@ -0,0 +1,60 @@
+package partials
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutFindTake(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partials.json")
+	entry := Entry{Fingerprint: "abc", Name: "big.iso", Size: 100, SHA256: "ff", Path: "/r/big.iso.part"}
+	if err := Put(path, entry); err != nil {
+		t.Fatal(err)
+	}
+	// A later interruption of the same file replaces the entry
+	entry.Path = "/r/big.iso.part2"
+	if err := Put(path, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, other := range map[string]Entry{
+		"other sender": {Fingerprint: "def", Name: "big.iso", Size: 100, SHA256: "ff"},
+		"other size":   {Fingerprint: "abc", Name: "big.iso", Size: 101, SHA256: "ff"},
+		"other hash":   {Fingerprint: "abc", Name: "big.iso", Size: 100, SHA256: "00"},
+	} {
+		if _, ok, _ := Find(path, other); ok {
+			t.Errorf("%s: found", name)
+		}
+	}
+	found, ok, err := Find(path, Entry{Fingerprint: "abc", Name: "big.iso", Size: 100, SHA256: "ff"})
+	if err != nil || !ok || found.Path != "/r/big.iso.part2" || found.Updated.IsZero() {
+		t.Fatalf("Find = %+v, %v, %v", found, ok, err)
+	}
+
+	if taken, ok, err := Take(path, entry); err != nil || !ok || taken.Path != found.Path {
+		t.Fatalf("Take = %+v, %v, %v", taken, ok, err)
+	}
+	if _, ok, _ := Find(path, entry); ok {
+		t.Error("taken entry still in the index")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partials.json")
+	old := Entry{Fingerprint: "abc", Name: "old.bin", Updated: time.Now().Add(-48 * time.Hour)}
+	fresh := Entry{Fingerprint: "abc", Name: "new.bin"}
+	Put(path, old)
+	Put(path, fresh)
+
+	expired, err := Expire(path, 24*time.Hour)
+	if err != nil || len(expired) != 1 || expired[0].Name != "old.bin" {
+		t.Fatalf("Expire = %+v, %v", expired, err)
+	}
+	if _, ok, _ := Find(path, old); ok {
+		t.Error("expired entry still in the index")
+	}
+	if _, ok, _ := Find(path, fresh); !ok {
+		t.Error("fresh entry removed")
+	}
+}
@@ -0,0 +1,227 @@
+// Package progress draws the progress bars of concurrent transfers together, one
+// line per active transfer, so bars of parallel uploads and downloads don't
+// overwrite each other. Bars report to the Manager over a channel; only its render
+// goroutine writes to the terminal.
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/meowrain/localsend-go/internal/tui"
+)
+
+const (
+	barWidth = 15
+	// DefaultInterval is how often changed bars are redrawn
+	DefaultInterval = 200 * time.Millisecond
+)
+
+type updateKind int
+
+const (
+	updateAdd updateKind = iota
+	updateStart
+	updateDone
+	updateFlush
+	updatePrint
+)
+
+type update struct {
+	kind updateKind
+	bar  *Bar
+	n    int64
+	out  io.Writer // Where data of a print goes
+	data []byte
+	done chan struct{} // Closed after a flush or print
+}
+
+// Manager owns the bars of all running transfers and renders them to out
+type Manager struct {
+	out     io.Writer
+	width   int // Terminal width lines are cut to, 0 for no limit
+	updates chan update
+
+	// Owned by the render goroutine
+	bars  []*Bar // Active bars in start order
+	lines int    // Lines drawn by the last render
+	dirty bool
+	now   func() time.Time
+}
+
+// NewManager starts a manager that redraws changed bars on out every interval.
+// Lines are cut to width columns, so long names can't wrap and break the layout.
+func NewManager(out io.Writer, width int, interval time.Duration) *Manager {
+	m := &Manager{out: out, width: width, updates: make(chan update, 64), now: time.Now}
+	go m.run(interval)
+	return m
+}
+
+// Bar is the progress of one transfer. Its methods may be called from any goroutine.
+type Bar struct {
+	m           *Manager
+	description string
+	total       int64 // Negative when unknown
+	closeOnce   sync.Once
+
+	// Owned by the render goroutine
+	current int64
+	start   time.Time
+}
+
+// NewBar adds a bar for a transfer of total bytes, or an unknown size when total is
+// negative. Close removes it.
+func (m *Manager) NewBar(total int64, description string) *Bar {
+	b := &Bar{m: m, description: description, total: total}
+	m.updates <- update{kind: updateStart, bar: b}
+	return b
+}
+
+// Add advances the bar by n bytes
+func (b *Bar) Add(n int) error {
+	if n != 0 {
+		b.m.updates <- update{kind: updateAdd, bar: b, n: int64(n)}
+	}
+	return nil
+}
+
+// Write advances the bar by len(p), so a bar can be used with io.MultiWriter
+func (b *Bar) Write(p []byte) (int, error) {
+	b.Add(len(p))
+	return len(p), nil
+}
+
+// Close removes the bar; the bars below it move up
+func (b *Bar) Close() error {
+	b.closeOnce.Do(func() {
+		b.m.updates <- update{kind: updateDone, bar: b}
+	})
+	return nil
+}
+
+// printer writes through the manager, see Writer
+type printer struct {
+	m   *Manager
+	out io.Writer
+}
+
+func (p printer) Write(data []byte) (int, error) {
+	done := make(chan struct{})
+	p.m.updates <- update{kind: updatePrint, out: p.out, data: append([]byte(nil), data...), done: done}
+	<-done
+	return len(data), nil
+}
+
+// Writer returns a writer to out, a stream on the same terminal such as stdout, that
+// prints above the bars instead of being overwritten by them
+func (m *Manager) Writer(out io.Writer) io.Writer {
+	return printer{m: m, out: out}
+}
+
+// flush renders pending changes and waits until they are written
+func (m *Manager) flush() {
+	done := make(chan struct{})
+	m.updates <- update{kind: updateFlush, done: done}
+	<-done
+}
+
+func (m *Manager) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case u := <-m.updates:
+			m.apply(u)
+		case <-ticker.C:
+			if m.dirty {
+				m.render()
+			}
+		}
+	}
+}
+
+func (m *Manager) apply(u update) {
+	switch u.kind {
+	case updateStart:
+		u.bar.start = m.now()
+		m.bars = append(m.bars, u.bar)
+		m.render()
+	case updateAdd:
+		u.bar.current += u.n
+		m.dirty = true
+	case updateDone:
+		for i, b := range m.bars {
+			if b == u.bar {
+				m.bars = append(m.bars[:i], m.bars[i+1:]...)
+				break
+			}
+		}
+		m.render()
+	case updateFlush:
+		m.render()
+		close(u.done)
+	case updatePrint:
+		// Clear the bars, print where they were and draw them again below
+		if m.lines > 0 {
+			fmt.Fprintf(m.out, "\x1b[%dA\r\x1b[J", m.lines)
+			m.lines = 0
+		}
+		u.out.Write(u.data)
+		if len(m.bars) > 0 {
+			m.render()
+		}
+		close(u.done)
+	}
+}
+
+// render redraws all bars in place: it moves the cursor back to the first line of
+// the last render, rewrites one line per bar and clears the lines of removed bars
+func (m *Manager) render() {
+	var buf bytes.Buffer
+	if m.lines > 0 {
+		fmt.Fprintf(&buf, "\x1b[%dA", m.lines)
+	}
+	now := m.now()
+	for _, b := range m.bars {
+		buf.WriteString("\r\x1b[2K")
+		buf.WriteString(m.cut(b.line(now)))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("\x1b[J")
+	m.lines = len(m.bars)
+	m.dirty = false
+	m.out.Write(buf.Bytes())
+}
+
+// cut shortens line to the terminal width
+func (m *Manager) cut(line string) string {
+	if m.width <= 0 || utf8.RuneCountInString(line) < m.width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:m.width-1])
+}
+
+// line renders the bar, e.g. "Uploading a.iso  40% |██████░░░░░░░░░| (4.0 MB/10.0 MB, 2.0 MB/s)"
+func (b *Bar) line(now time.Time) string {
+	rate := ""
+	if elapsed := now.Sub(b.start).Seconds(); elapsed > 0 {
+		rate = tui.FormatSize(int64(float64(b.current)/elapsed)) + "/s"
+	}
+	if b.total < 0 {
+		return fmt.Sprintf("%s %s (%s)", b.description, tui.FormatSize(b.current), rate)
+	}
+	fraction := 1.0
+	if b.total > 0 {
+		fraction = min(float64(b.current)/float64(b.total), 1)
+	}
+	filled := int(fraction * barWidth)
+	return fmt.Sprintf("%s %3d%% |%s%s| (%s/%s, %s)", b.description, int(fraction*100),
+		strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled),
+		tui.FormatSize(b.current), tui.FormatSize(b.total), rate)
+}
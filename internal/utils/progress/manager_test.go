@@ -0,0 +1,112 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestManager(width int) (*Manager, *bytes.Buffer) {
+	var out bytes.Buffer
+	m := &Manager{out: &out, width: width, updates: make(chan update, 64), now: time.Now}
+	go m.run(time.Hour)
+	return m, &out
+}
+
+// lastRender returns the lines drawn by the last render and the number of lines it
+// moved the cursor up first
+func lastRender(out *bytes.Buffer) (string, []string) {
+	renders := strings.Split(out.String(), "\x1b[J")
+	last := renders[len(renders)-2] // The output ends with a clear
+	up := ""
+	if strings.HasPrefix(last, "\x1b[") {
+		up = last[:strings.Index(last, "A")+1]
+		last = last[len(up):]
+	}
+	var lines []string
+	for _, line := range strings.Split(last, "\n") {
+		if line != "" {
+			lines = append(lines, strings.TrimPrefix(line, "\r\x1b[2K"))
+		}
+	}
+	return up, lines
+}
+
+func TestManager(t *testing.T) {
+	m, out := newTestManager(0)
+	a := m.NewBar(1000, "Uploading a")
+	b := m.NewBar(-1, "Uploading b")
+	a.Add(400)
+	b.Write(make([]byte, 2048))
+	m.flush()
+
+	// Each render starts at the first line of the previous one
+	up, lines := lastRender(out)
+	if up != "\x1b[2A" || len(lines) != 2 {
+		t.Fatalf("moved %q, drew %q", up, lines)
+	}
+	if !strings.HasPrefix(lines[0], "Uploading a  40%") || !strings.HasPrefix(lines[1], "Uploading b 2.0 KB") {
+		t.Errorf("drew %q", lines)
+	}
+
+	// A finished bar is removed and the next one moves up
+	a.Close()
+	a.Close()
+	m.flush()
+	if up, lines = lastRender(out); up != "\x1b[1A" || len(lines) != 1 || !strings.HasPrefix(lines[0], "Uploading b") {
+		t.Errorf("after close: moved %q, drew %q", up, lines)
+	}
+	b.Close()
+	m.flush()
+	if _, lines = lastRender(out); len(lines) != 0 {
+		t.Errorf("bars left after close: %q", lines)
+	}
+}
+
+func TestManagerCutsLines(t *testing.T) {
+	m, out := newTestManager(20)
+	bar := m.NewBar(10, strings.Repeat("x", 40))
+	defer bar.Close()
+	m.flush()
+	if _, lines := lastRender(out); len(lines) != 1 || len([]rune(lines[0])) != 19 {
+		t.Errorf("line not cut to the width: %q", lines)
+	}
+}
+
+func TestBarLine(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		bar  *Bar
+		want string
+	}{
+		{&Bar{description: "Uploading a", total: 1000, current: 400, start: start},
+			"Uploading a  40% |██████░░░░░░░░░| (400 B/1000 B, 200 B/s)"},
+		{&Bar{description: "Uploading b", total: 2048, current: 2048, start: start},
+			"Uploading b 100% |███████████████| (2.0 KB/2.0 KB, 1.0 KB/s)"},
+		{&Bar{description: "Downloading c", total: -1, current: 4096, start: start},
+			"Downloading c 4.0 KB (2.0 KB/s)"},
+		{&Bar{description: "Uploading empty", total: 0, start: start},
+			"Uploading empty 100% |███████████████| (0 B/0 B, 0 B/s)"},
+	}
+	for _, tt := range tests {
+		if got := tt.bar.line(start.Add(2 * time.Second)); got != tt.want {
+			t.Errorf("got  %q\nwant %q", got, tt.want)
+		}
+	}
+}
+
+func TestManagerWriter(t *testing.T) {
+	m, out := newTestManager(0)
+	bar := m.NewBar(10, "Uploading a")
+	defer bar.Close()
+	// A stream on the same terminal, here one buffer for both
+	w := m.Writer(out)
+	w.Write([]byte("File saved\n"))
+
+	// The bar is cleared, the message takes its line and the bar is drawn below it
+	tail := out.String()[strings.LastIndex(out.String(), "\x1b[1A"):]
+	if !strings.HasPrefix(tail, "\x1b[1A\r\x1b[JFile saved\n\r\x1b[2KUploading a") {
+		t.Errorf("printed %q", tail)
+	}
+}
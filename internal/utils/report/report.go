@@ -0,0 +1,99 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// Entry describes the outcome of one transferred file
+type Entry struct {
+	File       string  `json:"file"`
+	Size       int64   `json:"size"`
+	SHA256     string  `json:"sha256"`
+	Status     string  `json:"status"`
+	DurationMs int64   `json:"duration_ms"`
+	SpeedMbps  float64 `json:"speed_mbps"`
+}
+
+// Summary totals all entries of a report
+type Summary struct {
+	Summary    bool    `json:"summary"`
+	Files      int     `json:"files"`
+	OK         int     `json:"ok"`
+	Failed     int     `json:"failed"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs int64   `json:"duration_ms"`
+	SpeedMbps  float64 `json:"speed_mbps"`
+}
+
+// NewEntry builds an entry and derives its transfer speed
+func NewEntry(file string, size int64, sha256 string, duration time.Duration, err error) Entry {
+	status := StatusOK
+	if err != nil {
+		status = StatusFailed
+	}
+	return Entry{
+		File:       file,
+		Size:       size,
+		SHA256:     sha256,
+		Status:     status,
+		DurationMs: duration.Milliseconds(),
+		SpeedMbps:  speedMbps(size, duration),
+	}
+}
+
+// Summarize computes the totals of entries
+func Summarize(entries []Entry) Summary {
+	summary := Summary{Summary: true, Files: len(entries)}
+	for _, e := range entries {
+		if e.Status == StatusOK {
+			summary.OK++
+		} else {
+			summary.Failed++
+		}
+		summary.Bytes += e.Size
+		summary.DurationMs += e.DurationMs
+	}
+	summary.SpeedMbps = speedMbps(summary.Bytes, time.Duration(summary.DurationMs)*time.Millisecond)
+	return summary
+}
+
+// Write renders entries and their summary as "text" or "json" (newline-delimited)
+func Write(w io.Writer, format string, entries []Entry) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return enc.Encode(Summarize(entries))
+	case "text", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tSIZE\tSHA256\tSTATUS\tDURATION\tSPEED")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%dms\t%.2f Mbps\n", e.File, e.Size, e.SHA256, e.Status, e.DurationMs, e.SpeedMbps)
+		}
+		s := Summarize(entries)
+		fmt.Fprintf(tw, "TOTAL: %d files (%d ok, %d failed)\t%d\t\t\t%dms\t%.2f Mbps\n", s.Files, s.OK, s.Failed, s.Bytes, s.DurationMs, s.SpeedMbps)
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+func speedMbps(bytes int64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / 1e6 / duration.Seconds()
+}
@@ -0,0 +1,127 @@
+// Package retryqueue keeps files whose upload failed in a JSON file, so the send can be
+// attempted again later with the retry-queue command.
+package retryqueue
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Entry is a file whose upload failed
+type Entry struct {
+	ID        string    `json:"id"`
+	Queued    time.Time `json:"queued"` // First failure, entries expire relative to it
+	PeerIP    string    `json:"peer_ip"`
+	PeerAlias string    `json:"peer_alias,omitempty"`
+	Path      string    `json:"path"` // Local path of the file
+	Name      string    `json:"name"` // File name sent to the receiver, may include directories
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+var mu sync.Mutex
+
+// Add appends entries to the queue file at path. Entries without an ID or queue time get one.
+func Add(path string, entries ...Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	queue, err := read(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.ID == "" {
+			entry.ID = uuid.NewString()
+		}
+		if entry.Queued.IsZero() {
+			entry.Queued = time.Now().UTC()
+		}
+		queue = append(queue, entry)
+	}
+	return write(path, queue)
+}
+
+// Load returns the queued entries, oldest first, dropping those queued longer than expiry ago.
+// An expiry of zero or less keeps everything.
+func Load(path string, expiry time.Duration) ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	queue, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	if expiry <= 0 {
+		return queue, nil
+	}
+	kept := queue[:0]
+	for _, entry := range queue {
+		if time.Since(entry.Queued) <= expiry {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(queue) {
+		return kept, nil
+	}
+	return kept, write(path, kept)
+}
+
+// Remove deletes the entries with the given IDs
+func Remove(path string, ids ...string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	queue, err := read(path)
+	if err != nil {
+		return err
+	}
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := queue[:0]
+	for _, entry := range queue {
+		if !remove[entry.ID] {
+			kept = append(kept, entry)
+		}
+	}
+	return write(path, kept)
+}
+
+// read loads the queue file, empty if it doesn't exist
+func read(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var queue []Entry
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// write replaces the queue file atomically
+func write(path string, queue []Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if queue == nil {
+		queue = []Entry{}
+	}
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
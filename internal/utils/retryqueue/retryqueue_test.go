@@ -0,0 +1,40 @@
+package retryqueue
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddLoadRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retry_queue.json")
+	old := Entry{Queued: time.Now().Add(-48 * time.Hour), PeerIP: "192.168.1.42", Path: "/tmp/old.txt", Name: "old.txt"}
+	fresh := Entry{PeerIP: "192.168.1.42", Path: "/tmp/new.txt", Name: "new.txt", LastError: "timeout"}
+	if err := Add(path, old, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := Load(path, 0)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("got %d entries, err %v", len(all), err)
+	}
+	if all[1].ID == "" || all[1].Queued.IsZero() {
+		t.Errorf("ID and queue time not set: %+v", all[1])
+	}
+
+	// The expired entry is dropped from the file too
+	kept, err := Load(path, 24*time.Hour)
+	if err != nil || len(kept) != 1 || kept[0].Name != "new.txt" {
+		t.Fatalf("got %+v, err %v", kept, err)
+	}
+	if all, _ := Load(path, 0); len(all) != 1 {
+		t.Errorf("expired entry still in the file: %+v", all)
+	}
+
+	if err := Remove(path, kept[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := Load(path, 0); len(all) != 0 {
+		t.Errorf("got %+v after Remove", all)
+	}
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Resolve returns when a deferred send should start. at accepts "15:04" (today,
+// local time) or an RFC 3339 timestamp; in accepts a duration such as "2h30m".
+// The zero time means "now". Scheduled times must lie in the future.
+func Resolve(at, in string, now time.Time) (time.Time, error) {
+	if at != "" && in != "" {
+		return time.Time{}, errors.New("--at and --in cannot be combined")
+	}
+
+	switch {
+	case in != "":
+		d, err := time.ParseDuration(in)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid --in duration %q: %w", in, err)
+		}
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("--in duration must be positive, got %s", in)
+		}
+		return now.Add(d), nil
+	case at != "":
+		when, err := parseAt(at, now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !when.After(now) {
+			return time.Time{}, fmt.Errorf("scheduled time %s is in the past", when.Format(time.RFC3339))
+		}
+		return when, nil
+	}
+	return time.Time{}, nil
+}
+
+func parseAt(at string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("15:04", at, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --at time %q, expected HH:MM or RFC 3339", at)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location()), nil
+}
+
+// Wait blocks until when, doing nothing for the zero time
+func Wait(when time.Time) {
+	if when.IsZero() {
+		return
+	}
+	timer := time.NewTimer(time.Until(when))
+	defer timer.Stop()
+	<-timer.C
+}
@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	when, err := Resolve("", "2h30m", now)
+	if err != nil || !when.Equal(now.Add(150*time.Minute)) {
+		t.Fatalf("Resolve(in=2h30m) = %v, %v", when, err)
+	}
+
+	when, err = Resolve("14:30", "", now)
+	if err != nil || !when.Equal(time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)) {
+		t.Fatalf("Resolve(at=14:30) = %v, %v", when, err)
+	}
+
+	when, err = Resolve("", "", now)
+	if err != nil || !when.IsZero() {
+		t.Fatalf("Resolve() without schedule = %v, %v", when, err)
+	}
+
+	for _, c := range []struct{ at, in string }{
+		{"09:00", ""},    // in the past
+		{"", "-5m"},      // negative
+		{"", "soon"},     // not a duration
+		{"25:00", ""},    // not a clock time
+		{"14:30", "30m"}, // both given
+		{"2020-01-01T00:00:00Z", ""},
+	} {
+		if _, err := Resolve(c.at, c.in, now); err == nil {
+			t.Errorf("Resolve(%q, %q) should fail", c.at, c.in)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package trust keeps the trusted and untrusted device fingerprint lists, reloading
+// them when their files change.
+package trust
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/meowrain/localsend-go/internal/utils/logger"
+)
+
+// List file names inside the watched directory, one fingerprint per line
+const (
+	TrustedFile   = "trusted_fingerprints.txt"
+	UntrustedFile = "untrusted_fingerprints.txt"
+)
+
+// debounce collapses the bursts of events an editor save produces
+const debounce = 100 * time.Millisecond
+
+var (
+	trusted   sync.Map // Fingerprint -> struct{}
+	untrusted sync.Map
+)
+
+// IsTrusted reports whether fingerprint is in the trusted list
+func IsTrusted(fingerprint string) bool {
+	_, ok := trusted.Load(fingerprint)
+	return ok
+}
+
+// IsUntrusted reports whether fingerprint is in the untrusted list
+func IsUntrusted(fingerprint string) bool {
+	_, ok := untrusted.Load(fingerprint)
+	return ok
+}
+
+// Watch loads both lists from dir and reloads them whenever they change.
+// The returned function stops watching.
+func Watch(dir string) (func(), error) {
+	lists := map[string]*sync.Map{TrustedFile: &trusted, UntrustedFile: &untrusted}
+	for name, list := range lists {
+		reload(filepath.Join(dir, name), list)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directory, editors often replace files instead of writing to them
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		var mu sync.Mutex
+		timers := make(map[string]*time.Timer)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Base(event.Name)
+				list, ok := lists[name]
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				if timer, ok := timers[name]; ok {
+					timer.Reset(debounce)
+				} else {
+					path := filepath.Join(dir, name)
+					timers[name] = time.AfterFunc(debounce, func() { reload(path, list) })
+				}
+				mu.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnf("Fingerprint list watcher: %v", err)
+			}
+		}
+	}()
+	return func() { watcher.Close() }, nil
+}
+
+// reload replaces list with the fingerprints in path and logs the differences.
+// A missing file is an empty list.
+func reload(path string, list *sync.Map) {
+	next, err := readList(path)
+	if err != nil {
+		logger.Errorf("Failed to read %s: %v", path, err)
+		return
+	}
+
+	var added, removed []string
+	list.Range(func(key, _ interface{}) bool {
+		if _, ok := next[key.(string)]; !ok {
+			removed = append(removed, key.(string))
+			list.Delete(key)
+		}
+		return true
+	})
+	for fingerprint := range next {
+		if _, loaded := list.LoadOrStore(fingerprint, struct{}{}); !loaded {
+			added = append(added, fingerprint)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	if len(added) > 0 || len(removed) > 0 {
+		logger.Infof("Reloaded %s: added %v, removed %v", filepath.Base(path), added, removed)
+	}
+}
+
+// readList parses a newline-delimited fingerprint file, ignoring blank lines and # comments
+func readList(path string) (map[string]struct{}, error) {
+	fingerprints := make(map[string]struct{})
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fingerprints, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fingerprints[line] = struct{}{}
+	}
+	return fingerprints, scanner.Err()
+}
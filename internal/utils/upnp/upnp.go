@@ -0,0 +1,90 @@
+// Package upnp maps the LocalSend port on the router with UPnP IGD, so peers
+// outside the local network can reach this device.
+package upnp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/huin/goupnp/dcps/internetgateway2"
+)
+
+const description = "localsend-go"
+
+// portAttempts is how many external ports are tried when the preferred one is taken
+const portAttempts = 10
+
+// router is the part of the WAN connection services used here
+type router interface {
+	AddPortMappingCtx(ctx context.Context, remoteHost string, externalPort uint16, protocol string,
+		internalPort uint16, internalClient string, enabled bool, description string, leaseDuration uint32) error
+	DeletePortMappingCtx(ctx context.Context, remoteHost string, externalPort uint16, protocol string) error
+	GetExternalIPAddressCtx(ctx context.Context) (string, error)
+	LocalAddr() net.IP
+}
+
+var (
+	mu      sync.Mutex
+	current router // Router holding the mapping, nil when none
+	mapped  uint16 // External port of the mapping
+)
+
+// Map forwards TCP port on the router to this device and returns the external
+// address. The external port is port if it is free, otherwise the next free one.
+func Map(ctx context.Context, port int) (string, error) {
+	client, err := findRouter(ctx)
+	if err != nil {
+		return "", err
+	}
+	internalIP := client.LocalAddr()
+	if internalIP == nil {
+		return "", errors.New("no local address towards the router")
+	}
+	externalIP, err := client.GetExternalIPAddressCtx(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting the external IP: %w", err)
+	}
+
+	for i := 0; i < portAttempts; i++ {
+		external := uint16(port + i)
+		err = client.AddPortMappingCtx(ctx, "", external, "TCP", uint16(port), internalIP.String(), true, description, 0)
+		if err != nil {
+			continue
+		}
+		mu.Lock()
+		current, mapped = client, external
+		mu.Unlock()
+		return net.JoinHostPort(externalIP, strconv.Itoa(int(external))), nil
+	}
+	return "", fmt.Errorf("adding the port mapping: %w", err)
+}
+
+// Release removes the mapping made by Map, if any
+func Release() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return nil
+	}
+	err := current.DeletePortMappingCtx(context.Background(), "", mapped, "TCP")
+	current = nil
+	return err
+}
+
+// findRouter discovers an Internet gateway, preferring the IGDv2 service
+func findRouter(ctx context.Context) (router, error) {
+	if clients, _, err := internetgateway2.NewWANIPConnection2ClientsCtx(ctx); err == nil && len(clients) > 0 {
+		return clients[0], nil
+	}
+	if clients, _, err := internetgateway2.NewWANIPConnection1ClientsCtx(ctx); err == nil && len(clients) > 0 {
+		return clients[0], nil
+	}
+	if clients, _, err := internetgateway2.NewWANPPPConnection1ClientsCtx(ctx); err == nil && len(clients) > 0 {
+		return clients[0], nil
+	}
+	return nil, errors.New("no UPnP Internet gateway found")
+}
@@ -0,0 +1,71 @@
+// Package webhook notifies external services about received files.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Timeout bounds each delivery attempt
+const Timeout = 10 * time.Second
+
+// retryDelay is the wait before the single retry of a failed delivery
+var retryDelay = 5 * time.Second
+
+// WebhookPayload is the JSON body posted to the webhook URL
+type WebhookPayload struct {
+	Event     string `json:"event"`
+	File      string `json:"file"`
+	Sender    string `json:"sender"`
+	Size      int64  `json:"size"`
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Notify posts payload to url, retrying once after a failure
+func Notify(ctx context.Context, url string, payload WebhookPayload) error {
+	if payload.Timestamp == "" {
+		payload.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = post(ctx, url, body)
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-time.After(retryDelay):
+	case <-ctx.Done():
+		return err
+	}
+	return post(ctx, url, body)
+}
+
+// post makes one delivery attempt, any non-2xx status is an error
+func post(ctx context.Context, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifyRetriesOnce(t *testing.T) {
+	retryDelay = 10 * time.Millisecond
+	defer func() { retryDelay = 5 * time.Second }()
+
+	var calls int
+	var got WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	err := Notify(context.Background(), srv.URL, WebhookPayload{Event: "received", File: "a.txt", Size: 5})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+	if got.File != "a.txt" || got.Size != 5 || got.Timestamp == "" {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	retryDelay = 10 * time.Millisecond
+	defer func() { retryDelay = 5 * time.Second }()
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := Notify(context.Background(), srv.URL, WebhookPayload{Event: "received"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls)
+	}
+}
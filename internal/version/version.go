@@ -0,0 +1,19 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build metadata, overridden at build time via -ldflags "-X ..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// String returns a human readable summary of the build metadata
+func String() string {
+	return fmt.Sprintf("localsend-go %s\n  commit:     %s\n  built:      %s\n  go version: %s %s/%s",
+		Version, Commit, BuildTime, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -1,24 +1,49 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	bubbletea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/meowrain/localsend-go/internal/config"
 	"github.com/meowrain/localsend-go/internal/discovery"
+	"github.com/meowrain/localsend-go/internal/discovery/shared"
+	"github.com/meowrain/localsend-go/internal/fusefs"
 	"github.com/meowrain/localsend-go/internal/handlers"
 	"github.com/meowrain/localsend-go/internal/pkg/server"
+	"github.com/meowrain/localsend-go/internal/relay"
+	"github.com/meowrain/localsend-go/internal/transport"
+	"github.com/meowrain/localsend-go/internal/tray"
+	"github.com/meowrain/localsend-go/internal/utils/certificate"
+	cliphandlers "github.com/meowrain/localsend-go/internal/utils/clipboard/handlers"
+	"github.com/meowrain/localsend-go/internal/utils/events"
+	"github.com/meowrain/localsend-go/internal/utils/history"
 	"github.com/meowrain/localsend-go/internal/utils/logger"
+	"github.com/meowrain/localsend-go/internal/utils/manpage"
+	"github.com/meowrain/localsend-go/internal/utils/open"
+	"github.com/meowrain/localsend-go/internal/utils/schedule"
+	"github.com/meowrain/localsend-go/internal/utils/trust"
+	"github.com/meowrain/localsend-go/internal/utils/upnp"
+	"github.com/meowrain/localsend-go/internal/version"
 	"github.com/meowrain/localsend-go/static"
+	"github.com/sirupsen/logrus"
 	qrcode "github.com/skip2/go-qrcode"
 )
 
@@ -308,9 +333,9 @@ func (m model) View() string {
 }
 
 func WebServerMode(httpServer *http.ServeMux, port int) {
-	err := os.MkdirAll("uploads", 0o755)
+	err := os.MkdirAll(config.ConfigData.WebDir(), 0o755)
 	if err != nil {
-		logger.Errorf("Failed to create uploads directory: %v", err)
+		logger.Errorf("Failed to create the web upload directory: %v", err)
 		return
 	}
 	if config.ConfigData.Functions.HttpFileServer {
@@ -332,7 +357,7 @@ func WebServerMode(httpServer *http.ServeMux, port int) {
 	}
 	qr, err := qrcode.New(fmt.Sprintf("http://%s:%d", localIP, port), qrcode.Highest)
 	if err != nil {
-		fmt.Println("Failed to generate QR code:", err)
+		logger.Errorf("Failed to generate QR code: %v", err)
 		return
 	}
 
@@ -342,40 +367,622 @@ func WebServerMode(httpServer *http.ServeMux, port int) {
 }
 
 func ReceiveMode() {
-	err := os.MkdirAll("uploads", 0o755)
+	err := os.MkdirAll(config.ConfigData.ReceiveDir, 0o755)
 	if err != nil {
 		logger.Errorf("Failed to create uploads directory: %v", err)
 		return
 	}
+	if config.ConfigData.FuseMount != "" {
+		if err := fusefs.Mount(config.ConfigData.FuseMount); err != nil {
+			logger.Errorf("Failed to mount FUSE filesystem: %v", err)
+			os.Exit(1)
+		}
+		logger.Infof("Received files are available under %s", config.ConfigData.FuseMount)
+	}
+	if config.ConfigData.AutoAccept && len(config.ConfigData.AllowFrom) == 0 {
+		logger.Warn("Auto-accept is on and all senders are trusted, use --allow-fingerprint to restrict it")
+	}
 	discovery.ListenAndStartBroadcasts(nil)
 	logger.Info("Waiting to receive files...")
 	select {}
 }
 
-func SendMode(filePath string) {
-	err := handlers.SendFile(filePath)
+// SendMode sends the files and directories in paths in one session
+func SendMode(paths ...string) {
+	when, err := schedule.Resolve(config.ConfigData.SendAt, config.ConfigData.SendIn, time.Now())
+	if err != nil {
+		logger.Errorf("Invalid schedule: %v", err)
+		os.Exit(1)
+	}
+	if !when.IsZero() {
+		logger.Infof("Send of %s scheduled for %s", strings.Join(paths, ", "), when.Format(time.RFC1123))
+		schedule.Wait(when)
+		logger.Info("Scheduled time reached, starting send")
+	}
+
+	_, err = handlers.SendFiles(paths)
+	if errors.Is(err, handlers.ErrTransferCancelled) {
+		logger.Info("Transfer cancelled")
+		events.Emit("cancelled", nil)
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Errorf("Send failed: %v", err)
+		events.Emit("error", map[string]interface{}{"message": err.Error()})
+		os.Exit(1)
+	}
+}
+
+// SendURLMode downloads a URL and forwards it to the device given as the first argument or picked
+func SendURLMode(rawURL string, args []string) {
+	if len(args) > 0 {
+		config.ConfigData.SendTo = args[0]
+	}
+	err := handlers.SendURL(rawURL, sendName)
+	if errors.Is(err, handlers.ErrTransferCancelled) {
+		logger.Info("Transfer cancelled")
+		events.Emit("cancelled", nil)
+		os.Exit(1)
+	}
 	if err != nil {
 		logger.Errorf("Send failed: %v", err)
+		events.Emit("error", map[string]interface{}{"message": err.Error()})
+		os.Exit(1)
 	}
 }
 
-func ExitMode() {
-	fmt.Println("Exiting program...")
+// ScanMode probes --subnet, or the subnet of the default route, for LocalSend devices and prints them
+func ScanMode() {
+	subnets := scanSubnets
+	if len(subnets) == 0 {
+		subnets = discovery.DefaultRouteSubnets()
+	}
+	if len(subnets) == 0 {
+		subnets = discovery.LocalSubnets()
+	}
+	if len(subnets) == 0 {
+		logger.Error("No subnet to scan, use --subnet")
+		os.Exit(1)
+	}
+
+	results := discovery.Scan(context.Background(), subnets, config.DefaultPort, scanTimeout)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !config.ConfigData.JSON {
+		fmt.Fprintln(w, "IP\tALIAS\tMODEL\tTYPE\tPROTOCOL")
+	}
+	for _, result := range results {
+		events.Emit("device_found", map[string]interface{}{
+			"ip":           result.IP,
+			"alias":        result.Info.Alias,
+			"device_model": result.Info.DeviceModel,
+			"device_type":  result.Info.DeviceType,
+			"protocol":     result.Info.Protocol,
+			"fingerprint":  result.Info.Fingerprint,
+		})
+		if !config.ConfigData.JSON {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.IP, result.Info.Alias, result.Info.DeviceModel, result.Info.DeviceType, result.Info.Protocol)
+		}
+	}
+	w.Flush()
+	logger.Infof("Found %d device(s)", len(results))
 	os.Exit(0)
 }
 
-func flagParse(httpServer *http.ServeMux, port int, flagOpen *bool) {
-	showHelp := func() {
-		fmt.Println("Usage: <command> [arguments]")
-		fmt.Println("Commands:")
-		fmt.Println("  web                 Start Web mode")
-		fmt.Println("  send <file_path>    Start Send mode (file path required)")
-		fmt.Println("  receive             Start Receive mode")
-		fmt.Println("  help                Display this help information")
-		fmt.Println("Options:")
-		fmt.Println("  --help              Display this help information")
-		fmt.Println("  --port=<number>     Specify server port (default: 53317)")
+// DevicesMode reports devices as they are discovered and when they disappear, until interrupted
+func DevicesMode() {
+	discovery.ListenAndStartBroadcasts(nil)
+	discovery.WatchDevices(context.Background(), func(event discovery.DeviceEvent) {
+		device := event.Device
+		if event.Lost {
+			events.Emit("device_lost", map[string]interface{}{"alias": device.Alias, "ip": event.IP})
+			if !config.ConfigData.JSON {
+				logger.Infof("Lost %s (%s)", device.Alias, event.IP)
+			}
+			return
+		}
+		events.Emit("device_found", map[string]interface{}{
+			"alias":       device.Alias,
+			"ip":          event.IP,
+			"port":        device.Port,
+			"fingerprint": device.Fingerprint,
+			"device_type": device.DeviceType,
+			"os":          device.OS,
+			"version":     device.Version,
+			"first_seen":  event.FirstSeen.UTC().Format(time.RFC3339),
+			"last_seen":   device.LastSeen.UTC().Format(time.RFC3339),
+		})
+		if !config.ConfigData.JSON {
+			logger.Infof("Found %s at %s:%d (%s, %s)", device.Alias, event.IP, device.Port, device.DeviceType, device.OS)
+		}
+	})
+}
+
+// SyncMode exchanges missing files between dir and the peer's receive directory
+func SyncMode(with, dir string) {
+	host, port := with, config.ConfigData.Port
+	if h, p, err := net.SplitHostPort(with); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			logger.Errorf("Invalid port in %q", with)
+			os.Exit(2)
+		}
+		host, port = h, n
+	} else if net.ParseIP(with) == nil {
+		logger.Errorf("--with needs an IP address, got %q", with)
+		os.Exit(2)
+	}
+
+	if err := handlers.Sync(host, port, dir, config.ConfigData.ConflictPolicy); err != nil {
+		logger.Errorf("Sync failed: %v", err)
+		events.Emit("error", map[string]interface{}{"message": err.Error()})
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// ManMode prints the man page, its OPTIONS generated from the registered flags
+func ManMode() {
+	date, err := time.Parse(time.RFC3339, version.BuildTime)
+	if err != nil {
+		date = time.Now()
+	}
+	page := manpage.Page{
+		Name:    "localsend-go",
+		Section: 1,
+		Version: version.Version,
+		Date:    date,
+		Summary: "send and receive files with LocalSend devices on the local network",
+		Synopsis: []string{
+			"[options] web|receive|scan|devices|retry-queue",
+			"[options] send <path>...",
+			"[options] sync --with <ip[:port]> <dir>",
+			"history [--last N] [--since <date>] [--peer <alias>]",
+			"config init [--format toml|yaml]",
+		},
+		Description: []string{
+			"localsend-go is a command line client of the LocalSend protocol. It discovers devices with UDP multicast, " +
+				"sends files and directories to them over HTTPS and receives files into a directory.",
+			"Options may be given before or after the command. Most options default to the value in the config file.",
+		},
+		Commands: []manpage.Entry{
+			{Term: "web", Description: "Serve the web interface for sending and receiving in a browser."},
+			{Term: "send <path>...", Description: "Send files or directories to a device chosen from the discovered devices, or --to."},
+			{Term: "receive", Description: "Receive files into the receive directory."},
+			{Term: "scan", Description: "Probe the subnet for LocalSend devices without UDP discovery."},
+			{Term: "devices", Description: "Watch for devices, one JSON line per device found or lost with --json."},
+			{Term: "sync", Description: "Exchange missing files with a peer's receive directory."},
+			{Term: "retry-queue", Description: "Show failed uploads, or send them again with --attempt-now."},
+			{Term: "history", Description: "Show past transfers."},
+			{Term: "relay", Description: "Run a relay server that bridges peers that can't connect directly, for --relay. The relay forwards TLS and can't read the transferred files."},
+			{Term: "clean", Description: "Delete partial files left in the receive directories by interrupted transfers. This also runs when the server starts."},
+			{Term: "config init", Description: "Write the default config file, with comments on each setting, to ~/.config/localsend-go. TOML unless --format yaml is given; an existing file is kept."},
+			{Term: "version", Description: "Display version information."},
+			{Term: "man", Description: "Print this man page."},
+		},
+		Files: []manpage.Entry{
+			{Term: "~/.config/localsend-go/config.toml", Description: "Config file, see config init. When it is missing, config.yaml in the same directory or internal/config/config.yaml in the working directory is read, else the built-in defaults are used. Reloaded on SIGHUP."},
+			{Term: "~/.config/localsend-go/history.jsonl", Description: "Transfer history, see the history command."},
+			{Term: "~/.config/localsend-go/retry_queue.json", Description: "Failed uploads, see the retry-queue command."},
+			{Term: "~/.config/localsend-go/" + trust.TrustedFile, Description: "Fingerprints of devices whose transfers are always accepted."},
+			{Term: "~/.config/localsend-go/" + trust.UntrustedFile, Description: "Fingerprints of devices whose transfers are always rejected."},
+			{Term: "~/.config/localsend-go/certificate.pem", Description: "Certificate and key of this device, created on first use. It is served over HTTP/3 with --transport quic, where its fingerprint is announced as the device fingerprint, and to senders through --relay."},
+			{Term: "~/.config/localsend-go/known_devices.json", Description: "Certificate fingerprints of devices connected to over https or HTTP/3, with their alias and last address, remembered on first use. A device that announces a remembered fingerprint, or is at the address of a remembered device, must present its certificate, and is only connected to over https; sending fails until its entry is removed. Devices that only serve plain http, like localsend-go over TCP, are not verified."},
+		},
+		Environment: []manpage.Entry{
+			{Term: "HTTP_PROXY, HTTPS_PROXY, NO_PROXY", Description: "Proxy for file transfers unless --proxy is given. Discovery is never proxied."},
+			{Term: "HOME", Description: "Location of ~/.config/localsend-go and of ~ in paths from the config file."},
+		},
+		Examples: []manpage.Entry{
+			{Term: "localsend-go receive --organize-by sender", Description: "Receive into one directory per sender:"},
+			{Term: "localsend-go receive --pin 4821", Description: "Receive only from senders that know the PIN:"},
+			{Term: "localsend-go receive --auto-accept=false", Description: "Confirm each transfer, or pick the files to receive:"},
+			{Term: "localsend-go send --to 192.168.1.42 photos/ notes.txt", Description: "Send a directory and a file to a known device:"},
+			{Term: "localsend-go send --exclude '*.tmp' project/", Description: "Send a directory without temporary files:"},
+			{Term: "localsend-go --json devices", Description: "Watch devices as JSON lines:"},
+			{Term: "localsend-go --tray", Description: "Run in the system tray, with notifications of received files (build with -tags tray):"},
+		},
+		SeeAlso: []string{"https://localsend.org"},
+	}
+	if err := manpage.Write(os.Stdout, page, flag.CommandLine); err != nil {
+		logger.Errorf("Failed to write the man page: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// HistoryMode prints past transfers from the history file
+func HistoryMode() {
+	filter := history.Filter{Last: historyLast, Peer: historyPeer}
+	if historySince != "" {
+		since, err := parseHistoryDate(historySince)
+		if err != nil {
+			logger.Errorf("Invalid --since %q: use YYYY-MM-DD or RFC 3339", historySince)
+			os.Exit(2)
+		}
+		filter.Since = since
+	}
+	records, err := history.Query(config.HistoryFile(), filter)
+	if err != nil {
+		logger.Errorf("Failed to read history: %v", err)
+		os.Exit(1)
+	}
+
+	if config.ConfigData.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, record := range records {
+			enc.Encode(record)
+		}
+		os.Exit(0)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tDIRECTION\tPEER\tFILE\tSIZE\tDURATION\tSTATUS")
+	for _, record := range records {
+		status := "ok"
+		if !record.OK {
+			status = "failed: " + record.Error
+		}
+		peer := record.PeerAlias
+		if peer == "" {
+			peer = record.PeerIP
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", record.Time.Local().Format("2006-01-02 15:04:05"), record.Direction,
+			peer, record.File, record.Size, time.Duration(record.DurationMs)*time.Millisecond, status)
+	}
+	w.Flush()
+	os.Exit(0)
+}
+
+// RetryQueueMode lists the failed uploads waiting for a retry, or sends them with --attempt-now
+func RetryQueueMode() {
+	if retryAttemptNow {
+		sent, err := handlers.RetryQueued()
+		if err != nil {
+			logger.Errorf("Failed to read the retry queue: %v", err)
+			os.Exit(1)
+		}
+		logger.Infof("Sent %d queued file(s)", sent)
+	}
+	queue, err := handlers.RetryQueue()
+	if err != nil {
+		logger.Errorf("Failed to read the retry queue: %v", err)
+		os.Exit(1)
+	}
+
+	if config.ConfigData.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, entry := range queue {
+			enc.Encode(entry)
+		}
+		os.Exit(0)
 	}
+	if len(queue) == 0 {
+		fmt.Println("The retry queue is empty")
+		os.Exit(0)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUED\tPEER\tFILE\tATTEMPTS\tLAST ERROR")
+	for _, entry := range queue {
+		peer := entry.PeerAlias
+		if peer == "" {
+			peer = entry.PeerIP
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", entry.Queued.Local().Format("2006-01-02 15:04:05"), peer, entry.Path, entry.Attempts, entry.LastError)
+	}
+	w.Flush()
+	os.Exit(0)
+}
+
+// CleanMode deletes the partial files that interrupted transfers left in the receive directories
+func CleanMode() {
+	removed, err := handlers.RemoveStaleTempFiles(receiveDirs()...)
+	if err != nil {
+		logger.Errorf("Cleanup failed: %v", err)
+		os.Exit(1)
+	}
+	logger.Infof("Removed %d temp file(s)", removed)
+	os.Exit(0)
+}
+
+// ConfigMode runs the config subcommands: init writes the default config file
+func ConfigMode() {
+	// Options may also follow the subcommand, e.g. "config init --format yaml"
+	if len(commandArgs) > 0 {
+		if err := flag.CommandLine.Parse(commandArgs[1:]); err != nil {
+			os.Exit(2)
+		}
+	}
+	if len(commandArgs) == 0 || commandArgs[0] != "init" || flag.NArg() > 0 {
+		logger.Error("Usage: config init [--format toml|yaml]")
+		os.Exit(2)
+	}
+	path, err := config.Init(configFormat)
+	if err != nil {
+		logger.Errorf("Failed to write the config file: %v", err)
+		os.Exit(1)
+	}
+	logger.Successf("Wrote %s", path)
+	os.Exit(0)
+}
+
+// TrayMode receives files and runs the system tray menu until Quit is chosen
+func TrayMode() {
+	if err := os.MkdirAll(config.ConfigData.ReceiveDir, 0o755); err != nil {
+		logger.Errorf("Failed to create uploads directory: %v", err)
+		os.Exit(1)
+	}
+	handlers.OnFileReceived(func(file, sender string) {
+		tray.Notify("File received", fmt.Sprintf("%s from %s", filepath.Base(file), sender))
+	})
+	discovery.ListenAndStartBroadcasts(nil)
+	err := tray.Run(tray.Actions{
+		SendFile: traySend,
+		SetReceiving: func(on bool) {
+			handlers.SetReceiving(on)
+			if on {
+				logger.Info("Receiving switched on")
+			} else {
+				logger.Info("Receiving switched off, incoming transfers are rejected")
+			}
+		},
+		Receiving: handlers.Receiving(),
+		ViewHistory: func() {
+			if _, err := os.Stat(config.HistoryFile()); err != nil {
+				tray.ShowError("No transfers yet")
+				return
+			}
+			if err := open.Open(config.HistoryFile()); err != nil {
+				tray.ShowError(fmt.Sprintf("Failed to open the history: %v", err))
+			}
+		},
+		Settings: func() {
+			path := config.File()
+			if path == "" {
+				var err error
+				if path, err = config.Init(config.FormatTOML); err != nil {
+					tray.ShowError(fmt.Sprintf("Failed to create the config file: %v", err))
+					return
+				}
+			}
+			if err := open.Open(path); err != nil {
+				tray.ShowError(fmt.Sprintf("Failed to open %s: %v", path, err))
+			}
+		},
+		Quit: func() {
+			cleanup()
+			os.Exit(0)
+		},
+	})
+	if err != nil {
+		logger.Errorf("System tray unavailable: %v", err)
+		os.Exit(1)
+	}
+}
+
+// traySend asks for files and one of the discovered devices, then sends the files
+func traySend() {
+	paths, err := tray.SelectFiles()
+	if errors.Is(err, tray.ErrCancelled) {
+		return
+	}
+	if err != nil {
+		tray.ShowError(fmt.Sprintf("Failed to select files: %v", err))
+		return
+	}
+
+	shared.DevicesMutex.RLock()
+	names := make([]string, 0, len(shared.DiscoveredDevices))
+	ips := make(map[string]string, len(shared.DiscoveredDevices))
+	for ip, device := range shared.DiscoveredDevices {
+		name := fmt.Sprintf("%s (%s)", device.Alias, ip)
+		names = append(names, name)
+		ips[name] = ip
+	}
+	shared.DevicesMutex.RUnlock()
+	if len(names) == 0 {
+		tray.ShowError("No devices found yet, try again in a few seconds")
+		return
+	}
+	sort.Strings(names)
+	name, err := tray.SelectDevice(names)
+	if errors.Is(err, tray.ErrCancelled) {
+		return
+	}
+	if err != nil {
+		tray.ShowError(fmt.Sprintf("Failed to select a device: %v", err))
+		return
+	}
+
+	if _, err := handlers.SendFilesTo(ips[name], paths); err != nil {
+		logger.Errorf("Send failed: %v", err)
+		tray.Notify("Send failed", err.Error())
+		return
+	}
+	tray.Notify("Files sent", fmt.Sprintf("%d sent to %s", len(paths), name))
+}
+
+// RelayMode runs a relay server until the process is stopped
+func RelayMode() {
+	if err := relay.ListenAndServe(relayListen); err != nil {
+		logger.Errorf("Relay failed: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// serveRelay receives through the --relay server in a room named after the alias.
+// Relayed connections use TLS with the device certificate, so the relay can't read
+// them and senders recognize the receiver across restarts.
+func serveRelay(handler http.Handler) {
+	cert, err := certificate.LoadOrCreate(config.CertificateFile(), config.ConfigData.NameOfDevice)
+	if err != nil {
+		log.Fatalf("Relay certificate failed: %v", err)
+	}
+	ln, err := relay.Listen(config.ConfigData.Relay, shared.Message.Alias)
+	if err != nil {
+		log.Fatalf("Relay failed: %v", err)
+	}
+	logger.Infof("Waiting for senders at relay %s as %s", config.ConfigData.Relay, shared.Message.Alias)
+	tlsListener := tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err := newHTTPServer(handler).Serve(tlsListener); err != nil {
+		log.Fatalf("Relay server failed: %v", err)
+	}
+}
+
+// newHTTPServer returns the server for the LocalSend API with the configured timeouts
+func newHTTPServer(handler http.Handler) *http.Server {
+	return server.NewHTTPServer(localOnly(handler), server.Timeouts{
+		Read:  config.ConfigData.ServerReadTimeout,
+		Write: config.ConfigData.ServerWriteTimeout,
+		Idle:  config.ConfigData.ServerIdleTimeout,
+	})
+}
+
+// localOnly restricts handler to clients on this machine with --local-only
+func localOnly(handler http.Handler) http.Handler {
+	if config.ConfigData.LocalOnly {
+		return server.LoopbackOnly(handler)
+	}
+	return handler
+}
+
+// receiveDirs returns the receive directory and those set in device profiles
+func receiveDirs() []string {
+	dirs := []string{config.ConfigData.ReceiveDir}
+	for _, device := range config.ConfigData.Devices {
+		if device.ReceiveDir != "" {
+			dirs = append(dirs, config.ExpandHome(device.ReceiveDir))
+		}
+	}
+	return dirs
+}
+
+// parseHistoryDate accepts a local date (YYYY-MM-DD) or an RFC 3339 timestamp
+func parseHistoryDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// cleanup undoes what the server set up outside the process before it exits
+func cleanup() {
+	if err := fusefs.Unmount(); err != nil {
+		logger.Errorf("Failed to unmount FUSE filesystem: %v", err)
+	}
+	if err := upnp.Release(); err != nil {
+		logger.Errorf("Failed to remove UPnP port mapping: %v", err)
+	}
+	cliphandlers.RemoveContactFiles()
+}
+
+func ExitMode() {
+	logger.Info("Exiting program...")
+	os.Exit(0)
+}
+
+func showHelp() {
+	fmt.Println("Usage: <command> [arguments]")
+	fmt.Println("Commands:")
+	fmt.Println("  web                 Start Web mode")
+	fmt.Println("  send <path>...      Start Send mode with one or more files or directories")
+	fmt.Println("  receive             Start Receive mode")
+	fmt.Println("  scan [--subnet <CIDR>]... [--scan-timeout <d>]  Probe subnets for LocalSend devices without UDP discovery")
+	fmt.Println("                      (default: the default route's subnet, at most /16; probes time out after 500ms)")
+	fmt.Println("  devices             Watch for devices, one JSON line per device found or lost with --json")
+	fmt.Println("  sync --with <ip> <dir>  Exchange missing files with a peer's receive directory")
+	fmt.Println("  retry-queue [--attempt-now]  Show failed uploads, or send them again")
+	fmt.Println("  history [--last N] [--since <date>] [--peer <alias>]  Show past transfers")
+	fmt.Println("  relay [--relay-listen <addr>]  Run a relay server for peers behind firewalls (default: :53319)")
+	fmt.Println("  clean               Delete partial files left by interrupted transfers (also done at startup)")
+	fmt.Println("  config init [--format toml|yaml]  Write the default config to ~/.config/localsend-go (default: toml)")
+	fmt.Println("  version             Display version information")
+	fmt.Println("  man                 Print the man page (roff) to stdout")
+	fmt.Println("  help                Display this help information")
+	fmt.Println("Options:")
+	fmt.Println("  --help              Display this help information")
+	fmt.Println("  --version           Display version information")
+	fmt.Printf("  --port=<number>     Specify server port (default: %d)\n", config.DefaultPort)
+	fmt.Println("  --alias=<name>      Device name shown to other devices (default: <hostname>-go)")
+	fmt.Println("  --alias-format=<t>  Generate the name from {hostname}, {os}, {arch}, {username} and {random4}")
+	fmt.Println("  --device-type=<t>   Advertised device type: desktop, server, headless... (default: detected)")
+	fmt.Println("  --device-model=<m>  Advertised device model (default: the OS)")
+	fmt.Println("  --auto-port         Use the next free port (up to 53377) if the port is in use")
+	fmt.Println("  --transport=<t>     Transport to peers: tcp or quic (experimental, needs -tags quic)")
+	fmt.Println("  --quic-port=<n>     UDP port of the HTTP/3 server, advertised to peers (default: port+1)")
+	fmt.Println("  --local-only        Only accept connections from 127.0.0.1 and ::1 and disable discovery,")
+	fmt.Println("                      e.g. to pass files between processes on this machine")
+	fmt.Println("  --upnp              Forward the port on the router with UPnP so peers outside the LAN can connect")
+	fmt.Println("  --proxy=<url>       HTTP proxy for file transfers, overrides HTTP_PROXY/HTTPS_PROXY.")
+	fmt.Println("                      Discovery (UDP multicast/broadcast) is never proxied")
+	fmt.Println("  --relay=<url>       Connect through a relay server (ws:// or wss://) when peers can't reach each")
+	fmt.Println("                      other; receivers wait in a room named after their alias, senders need --to <alias>")
+	fmt.Println("  --max-sessions=<n>  Maximum concurrent receive sessions (default: 3)")
+	fmt.Println("  --queue-mode=<m>    At the session limit: wait for a slot or reject right away (default: wait)")
+	fmt.Println("  --queue-size=<n>    Senders that may wait for a slot, more get 503 (default: 8)")
+	fmt.Println("  --queue-timeout=<d> How long a sender waits for a slot (default: 30s)")
+	fmt.Println("  --session-idle-timeout=<d> Expire sessions that see no upload or ping for d (default: 5m)")
+	fmt.Println("  --server-read-timeout=<d> Close connections that send nothing for d (default: 1m, 0 = never)")
+	fmt.Println("  --server-write-timeout=<d> Close connections that read no response for d (default: 1m, 0 = never)")
+	fmt.Println("  --server-idle-timeout=<d> Close idle keep-alive connections after d (default: 2m, 0 = never)")
+	fmt.Println("  --discovery=<mode>  Discovery mode: multicast, broadcast, both or avahi (Linux, DNS-SD")
+	fmt.Println("                      through the Avahi daemon) (default: multicast)")
+	fmt.Println("  --discovery-interval=<d> Maximum interval between announcements (default: 30s)")
+	fmt.Println("  --discovery-jitter=<d>   Random delay added to each announcement (default: 1s)")
+	fmt.Println("  --discover-upnp     Also find devices that register with UPnP, when multicast is blocked")
+	fmt.Println("  --quiet             Suppress all output except errors")
+	fmt.Println("  --json              Emit machine-readable JSON events on stdout")
+	fmt.Println("  --no-progress       Log transfer speed as text instead of drawing progress bars")
+	fmt.Println("  --compress          Compress file content during transfer (zstd, falls back to gzip)")
+	fmt.Println("  --zip               Bundle a directory into a ZIP archive before sending")
+	fmt.Println("  --follow-symlinks   Send symlink targets instead of skipping symlinks (cycles are skipped)")
+	fmt.Println("  --preserve-empty-dirs Send empty directories so the receiver recreates them")
+	fmt.Println("  --preserve-permissions Apply the sender's file permissions (only for trusted senders:")
+	fmt.Println("                      they can make received files executable or world-readable)")
+	fmt.Println("  --fuse-mount=<dir>  Stream received files through a FUSE mount (Linux, needs -tags fuse)")
+	fmt.Println("  --tray              Run in the system tray instead of the terminal (needs -tags tray)")
+	fmt.Println("  --unzip             Extract received ZIP archives into a subdirectory")
+	fmt.Println("  --strict-clipboard  Answer 500 when received text can't be copied to the clipboard")
+	fmt.Println("  --auto-open         Open received files with the default application")
+	fmt.Println("  --auto-open-types=<list> Only open these MIME types, e.g. 'image/*,application/pdf'")
+	fmt.Println("  --session-retry-delay=<d>  Delay between upload retries: receiver busy, timeouts, 5xx (default: 5s)")
+	fmt.Println("  --session-retry-count=<n>  Upload retries: receiver busy, timeouts, 5xx (default: 6)")
+	fmt.Println("  --progress-interval=<d> Log upload progress every d (0 = off, default: 10s with --json)")
+	fmt.Println("  --auto-tune         Run a speed test before sends of 10MB or more")
+	fmt.Println("  --auto-accept       Accept incoming transfers without asking (default: true)")
+	fmt.Println("  --allow-fingerprint=<fp> Only auto-accept senders with this fingerprint")
+	fmt.Println("  --allow-alias=<name> Only auto-accept senders with this alias; with --allow-fingerprint both must match")
+	fmt.Println("  --allow-sync        Let peers list and pull the receive directory with sync")
+	fmt.Println("  --conflict-policy=<p> Sync conflicts: newer-wins, local-wins, remote-wins or skip (default: newer-wins)")
+	fmt.Println("                      prompt: ask per received file that already exists (overwrite, rename or skip)")
+	fmt.Println("  --encrypt=<pass>    Encrypt sent files with a passphrase, end to end (AES-256-GCM)")
+	fmt.Println("  --decrypt=<pass>    Decrypt received files that were sent with --encrypt")
+	fmt.Println("  --pin=<pin>         Require senders to give this PIN, 5 wrong ones lock a sender out for a minute")
+	fmt.Println("  --send-pin=<pin>    PIN for receivers that require one, asked for when not set")
+	fmt.Println("  --to=<alias|ip>     Send to this device without the device picker. https and QUIC receivers must")
+	fmt.Println("                      present the certificate remembered on first use (known_devices.json),")
+	fmt.Println("                      plain http receivers are not verified")
+	fmt.Println("  --at=<HH:MM>        Schedule the send for a time of day (or RFC 3339 timestamp)")
+	fmt.Println("  --in=<duration>     Schedule the send after a delay, e.g. 30m or 2h30m")
+	fmt.Println("  --retry-duration=<d> How long to wait for the --to device (default: 30m)")
+	fmt.Println("  --reconnect-timeout=<d> How long to wait for a receiver that timed out to reappear (default: 30s)")
+	fmt.Println("  --report-format=<f> Print an integrity report after sending (text|json)")
+	fmt.Println("  --report-file=<p>   Write the integrity report to a file")
+	fmt.Println("  --url=<url>         With send: download the URL and forward it, e.g. send --url <url> <device>")
+	fmt.Println("  --name=<name>       File name for --url (default: last element of the URL path)")
+	fmt.Println("  --exclude=<glob>    Don't send matching files, e.g. '*.tmp' or '**/.git/**' (repeatable)")
+	fmt.Println("  --include=<glob>    Send matching files excluded by an earlier --exclude; the last match wins")
+	fmt.Println("  --exclude-hashes=<f> Skip files whose SHA256 is listed in f (one hex hash per line)")
+	fmt.Println("  --organize-by=<k>   Receive into subdirectories: sender (uploads/Alice), date (uploads/2024/01/15) or type (uploads/images)")
+	fmt.Println("  --receive-mode=<m>  overwrite (default) or append: continue existing files, the sender only uploads the rest")
+	fmt.Println("  --verify-manifest=<f> Check each received session against a sha256sum manifest and report mismatches")
+	fmt.Println("  --webhook-url=<url> POST a JSON notification after each received file (repeatable)")
+	fmt.Println("  --retry-expiry=<d>  How long failed uploads stay in the retry queue (default: 24h)")
+	fmt.Println("  --no-history        Don't record transfers in ~/.config/localsend-go/history.jsonl")
+}
+
+// parseFlags parses command line flags and handles the options that exit early
+func parseFlags() {
 	flag.Usage = showHelp
 	// Parse standard flag arguments
 	flag.Parse()
@@ -388,24 +995,275 @@ func flagParse(httpServer *http.ServeMux, port int, flagOpen *bool) {
 		}
 	}
 
-	if len(os.Args) > 1 {
+	// Allow flags after the command, e.g. "send --report-format json <path>"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			os.Exit(2)
+		}
+		commandArgs = flag.Args()
+	}
+
+	if showVersion || command == "version" {
+		fmt.Println(version.String())
+		os.Exit(0)
+	}
+	if command == "man" {
+		ManMode()
+	}
+
+	applyOutputFlags()
+	// history only reads the log, it needs no server
+	if command == "history" {
+		HistoryMode()
+	}
+	if command == "clean" {
+		CleanMode()
+	}
+	// The relay only forwards connections, it needs no LocalSend server
+	if command == "relay" {
+		RelayMode()
+	}
+	if command == "config" {
+		ConfigMode()
+	}
+	applyAlias()
+	applyDeviceType()
+	applyAllowFrom()
+	switch config.ConfigData.OrganizeBy {
+	case "", handlers.OrganizeBySender, handlers.OrganizeByDate, handlers.OrganizeByType:
+	default:
+		logger.Errorf("Invalid --organize-by %q (sender|date|type)", config.ConfigData.OrganizeBy)
+		os.Exit(2)
+	}
+	switch config.ConfigData.ReceiveMode {
+	case "", "overwrite", handlers.ReceiveModeAppend:
+	default:
+		logger.Errorf("Invalid --receive-mode %q (overwrite|append)", config.ConfigData.ReceiveMode)
+		os.Exit(2)
+	}
+	switch config.ConfigData.ReportFormat {
+	case "", "text", "json":
+	default:
+		logger.Errorf("Invalid --report-format %q (text|json)", config.ConfigData.ReportFormat)
+		os.Exit(2)
+	}
+	if err := transport.ValidateProxy(); err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(2)
+	}
+	if config.ConfigData.Relay != "" {
+		if err := relay.ValidateURL(config.ConfigData.Relay); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(2)
+		}
+		if config.ConfigData.Transport == transport.QUIC {
+			logger.Error("--relay works over TCP only, not with --transport quic")
+			os.Exit(2)
+		}
+	}
+	if config.ConfigData.LocalOnly && (config.ConfigData.Relay != "" || config.ConfigData.UPnP) {
+		logger.Error("--local-only can't be combined with --relay or --upnp")
+		os.Exit(2)
+	}
+}
+
+// applyAllowFrom adds the --allow-fingerprint/--allow-alias pair to the auto-accept allow list
+func applyAllowFrom() {
+	if allowFingerprint == "" && allowAlias == "" {
+		return
+	}
+	config.ConfigData.AllowFrom = append(config.ConfigData.AllowFrom, config.AllowedSender{
+		Fingerprint: allowFingerprint,
+		Alias:       allowAlias,
+	})
+	if allowFingerprint == "" {
+		logger.Warn("--allow-alias alone is easy to spoof, prefer --allow-fingerprint")
+	}
+}
+
+// applyDeviceType overrides the detected device type and model with --device-type
+// and --device-model
+func applyDeviceType() {
+	if config.ConfigData.DeviceModel != "" {
+		shared.Message.DeviceModel = config.ConfigData.DeviceModel
+	}
+	switch config.ConfigData.DeviceType {
+	case "":
+	case "mobile", "desktop", "web", "headless", "server":
+		shared.Message.DeviceType = config.ConfigData.DeviceType
+	default:
+		logger.Errorf("Invalid device type %q (mobile|desktop|web|headless|server)", config.ConfigData.DeviceType)
+		os.Exit(2)
+	}
+}
+
+// applyAlias sets the advertised device alias from --alias or the hostname
+func applyAlias() {
+	if config.ConfigData.Alias != "" {
+		if err := config.ValidateAlias(config.ConfigData.Alias); err != nil {
+			logger.Errorf("Invalid alias: %v", err)
+			os.Exit(2)
+		}
+		config.ConfigData.NameOfDevice = config.ConfigData.Alias
+	} else if config.ConfigData.AliasFormat != "" {
+		name, err := config.FormatAlias(config.ConfigData.AliasFormat)
+		if err != nil {
+			logger.Errorf("Invalid alias format: %v", err)
+			os.Exit(2)
+		}
+		config.ConfigData.NameOfDevice = name
+	}
+	shared.Message.Alias = config.ConfigData.NameOfDevice
+	logger.Infof("Device alias: %s", shared.Message.Alias)
+}
+
+// applyOutputFlags configures logging for --quiet and --json
+func applyOutputFlags() {
+	if err := applyLogLevel(); err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(2)
+	}
+	if config.ConfigData.JSON {
+		// Keep stdout clean for events
+		logger.GetLogger().SetOutput(os.Stderr)
+		events.Enable(true)
+		if !flagGiven("progress-interval") && config.ConfigData.ProgressInterval == 0 {
+			config.ConfigData.ProgressInterval = handlers.DefaultJSONProgressInterval
+		}
+	}
+}
+
+// flagGiven reports whether a flag was set on the command line
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// applyLogLevel sets the log level from the config, --quiet and --json only log errors
+func applyLogLevel() error {
+	level := logrus.InfoLevel
+	if config.ConfigData.LogLevel != "" {
+		var err error
+		if level, err = logrus.ParseLevel(config.ConfigData.LogLevel); err != nil {
+			return fmt.Errorf("invalid log level %q (debug|info|warn|error)", config.ConfigData.LogLevel)
+		}
+	}
+	if config.ConfigData.Quiet || config.ConfigData.JSON {
+		level = logrus.ErrorLevel
+	}
+	logger.SetLevel(level)
+	return nil
+}
+
+// mapPort forwards the server port on the router with UPnP and advertises the external address
+func mapPort() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr, err := upnp.Map(ctx, config.ConfigData.Port)
+	if err != nil {
+		logger.Warnf("UPnP port mapping failed: %v", err)
+		return
+	}
+	shared.Message.ExternalAddress = addr
+	logger.Infof("External address: %s", addr)
+}
+
+// watchReload reloads the config file on SIGHUP
+func watchReload() {
+	sighupChan := make(chan os.Signal, 1)
+	signal.Notify(sighupChan, syscall.SIGHUP)
+	go func() {
+		for range sighupChan {
+			reloadConfig()
+		}
+	}()
+}
+
+// generatedAlias is the device name used when no alias is set
+func generatedAlias() string {
+	if config.ConfigData.AliasFormat != "" {
+		if name, err := config.FormatAlias(config.ConfigData.AliasFormat); err == nil {
+			return name
+		}
+	}
+	return config.HostnameAlias()
+}
+
+// reloadConfig applies the config file changes that don't need a restart
+func reloadConfig() {
+	result, err := config.Reload()
+	if err != nil {
+		logger.Errorf("Config reload failed: %v", err)
+		return
+	}
+	for _, key := range result.Applied {
+		switch key {
+		case "alias":
+			name := config.ConfigData.Alias
+			if name == "" {
+				name = generatedAlias()
+			} else if err := config.ValidateAlias(name); err != nil {
+				logger.Errorf("Invalid alias: %v", err)
+				continue
+			}
+			config.ConfigData.NameOfDevice = name
+			shared.Message.Alias = name
+		}
+	}
+	// Also reverts a level changed with PUT /api/admin/log-level
+	if err := applyLogLevel(); err != nil {
+		logger.Errorf("%v", err)
+	}
+	for _, key := range result.RestartRequired {
+		logger.Warnf("%s changed: Restart required for this change to take effect.", key)
+	}
+	logger.GetLogger().WithFields(logrus.Fields{
+		"changed":          result.Applied,
+		"restart_required": result.RestartRequired,
+	}).Info("Configuration reloaded")
+	events.Emit("config_reloaded", map[string]interface{}{
+		"changed":          result.Applied,
+		"restart_required": result.RestartRequired,
+	})
+}
+
+func flagParse(httpServer *http.ServeMux, port int, flagOpen *bool) {
+	if command != "" {
 		*flagOpen = true
-		mode := os.Args[1]
+		mode := command
 
 		switch mode {
 		case "web":
 			WebServerMode(httpServer, port)
 		case "send":
-			filePath := ""
-			if len(os.Args) > 2 {
-				filePath = os.Args[2]
-				SendMode(filePath)
+			if sendURL != "" {
+				SendURLMode(sendURL, commandArgs)
+			} else if len(commandArgs) > 0 {
+				SendMode(commandArgs...)
 			} else {
 				logger.Error("Need file path")
 				ExitMode()
 			}
 		case "receive":
 			ReceiveMode()
+		case "retry-queue":
+			RetryQueueMode()
+		case "scan":
+			ScanMode()
+		case "devices":
+			DevicesMode()
+		case "sync":
+			if len(commandArgs) == 0 || syncWith == "" {
+				logger.Error("Usage: sync --with <ip[:port]> <local_dir>")
+				os.Exit(2)
+			}
+			SyncMode(syncWith, commandArgs[0])
 		case "help":
 			showHelp()
 			ExitMode()
@@ -413,10 +1271,154 @@ func flagParse(httpServer *http.ServeMux, port int, flagOpen *bool) {
 	}
 }
 
-var port int
+// addSendFilter appends an --exclude or --include pattern, kept in command line order
+func addSendFilter(pattern string, include bool) error {
+	if err := handlers.ValidatePathFilter(pattern); err != nil {
+		return err
+	}
+	config.ConfigData.SendFilters = append(config.ConfigData.SendFilters, config.PathFilter{Pattern: pattern, Include: include})
+	return nil
+}
+
+// stringList is a flag that can be given more than once
+type stringList struct{ values *[]string }
+
+func (l stringList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l stringList) Set(value string) error {
+	*l.values = append(*l.values, value)
+	return nil
+}
+
+var (
+	showVersion  bool
+	syncWith     string   // Peer for the sync command
+	historyLast  int      // Number of records shown by the history command
+	historySince string   // Earliest date shown by the history command
+	historyPeer  string   // Peer alias filter for the history command
+	sendURL      string   // URL downloaded and forwarded by send --url
+	sendName     string   // File name for send --url, taken from the URL when empty
+	command      string   // Command given on the command line
+	commandArgs  []string // Positional arguments following the command
+
+	// Auto-accept filter, appended to allow_from
+	allowFingerprint string
+	allowAlias       string
+
+	retryAttemptNow bool // Send the queued files with the retry-queue command
+
+	// Options of the scan command
+	scanSubnets []*net.IPNet  // Subnets given with --subnet, the default route's subnet when empty
+	scanTimeout time.Duration // Connect timeout of each probe
+
+	relayListen string // Address of the relay command
+
+	configFormat string // Format of the file written by config init
+
+	trayMode bool // Run as a system tray application
+
+	quicCert tls.Certificate // Certificate of the HTTP/3 server, its fingerprint is announced
+)
 
 func init() {
-	flag.IntVar(&port, "port", 53317, "Port to listen on")
+	flag.IntVar(&config.ConfigData.Port, "port", config.ConfigData.Port, "Port to listen on")
+	flag.StringVar(&config.ConfigData.Alias, "alias", config.ConfigData.Alias, "Device name shown to other devices (default: hostname)")
+	flag.StringVar(&config.ConfigData.AliasFormat, "alias-format", config.ConfigData.AliasFormat, "Template for the generated device name, e.g. {hostname}-{os}")
+	flag.StringVar(&config.ConfigData.DeviceType, "device-type", config.ConfigData.DeviceType, "Advertised device type (default: detected)")
+	flag.StringVar(&config.ConfigData.DeviceModel, "device-model", config.ConfigData.DeviceModel, "Advertised device model (default: the OS)")
+	flag.BoolVar(&config.ConfigData.AutoPort, "auto-port", config.ConfigData.AutoPort, "Try the next free port if the port is in use")
+	flag.BoolVar(&showVersion, "version", false, "Display version information")
+	flag.BoolVar(&config.ConfigData.AutoAccept, "auto-accept", config.ConfigData.AutoAccept, "Accept incoming transfers without asking")
+	flag.StringVar(&allowFingerprint, "allow-fingerprint", "", "Only auto-accept senders with this fingerprint")
+	flag.StringVar(&allowAlias, "allow-alias", "", "Only auto-accept senders with this alias (easy to spoof)")
+	flag.BoolVar(&config.ConfigData.AllowSync, "allow-sync", config.ConfigData.AllowSync, "Let peers sync with the receive directory")
+	flag.Func("subnet", "IPv4 `subnet` to scan in CIDR notation, at most a /16 (repeatable, default: the default route's subnet)", func(value string) error {
+		subnet, err := discovery.ParseScanSubnet(value)
+		if err != nil {
+			return err
+		}
+		scanSubnets = append(scanSubnets, subnet)
+		return nil
+	})
+	flag.DurationVar(&scanTimeout, "scan-timeout", discovery.DefaultScanTimeout, "Connect timeout of each scan probe")
+	flag.StringVar(&syncWith, "with", "", "Peer to sync with (ip or ip:port)")
+	flag.StringVar(&config.ConfigData.ConflictPolicy, "conflict-policy", config.ConfigData.ConflictPolicy, "How sync resolves conflicts (newer-wins|local-wins|remote-wins|skip), or prompt when a received file exists")
+	flag.StringVar(&config.ConfigData.Transport, "transport", config.ConfigData.Transport, "Transport to peers: tcp or quic (experimental)")
+	flag.IntVar(&config.ConfigData.QUICPort, "quic-port", config.ConfigData.QUICPort, "UDP port of the HTTP/3 server with --transport quic (default: port+1)")
+	flag.BoolVar(&config.ConfigData.LocalOnly, "local-only", config.ConfigData.LocalOnly, "Only accept connections from this machine and disable discovery")
+	flag.BoolVar(&config.ConfigData.UPnP, "upnp", config.ConfigData.UPnP, "Forward the port on the router with UPnP")
+	flag.StringVar(&config.ConfigData.Proxy, "proxy", config.ConfigData.Proxy, "HTTP proxy URL for file transfers (default: HTTP_PROXY/HTTPS_PROXY)")
+	flag.StringVar(&config.ConfigData.Relay, "relay", config.ConfigData.Relay, "Relay server `url` (ws or wss) for peers that can't connect directly")
+	flag.StringVar(&relayListen, "relay-listen", relay.DefaultAddr, "Listen `address` of the relay command")
+	flag.StringVar(&configFormat, "format", config.FormatTOML, "Format of the file written by config init (toml|yaml)")
+	flag.IntVar(&config.ConfigData.MaxSessions, "max-sessions", config.ConfigData.MaxSessions, "Maximum number of concurrent receive sessions")
+	flag.StringVar(&config.ConfigData.QueueMode, "queue-mode", config.ConfigData.QueueMode, "At the session limit, wait for a free slot or reject (wait|reject)")
+	flag.IntVar(&config.ConfigData.QueueSize, "queue-size", config.ConfigData.QueueSize, "Maximum number of senders waiting for a session slot")
+	flag.DurationVar(&config.ConfigData.QueueTimeout, "queue-timeout", config.ConfigData.QueueTimeout, "How long a sender waits for a session slot")
+	flag.DurationVar(&config.ConfigData.ServerReadTimeout, "server-read-timeout", config.ConfigData.ServerReadTimeout, "Close connections that send nothing for this long, 0 = never")
+	flag.DurationVar(&config.ConfigData.ServerWriteTimeout, "server-write-timeout", config.ConfigData.ServerWriteTimeout, "Close connections that read no response for this long, 0 = never")
+	flag.DurationVar(&config.ConfigData.ServerIdleTimeout, "server-idle-timeout", config.ConfigData.ServerIdleTimeout, "Close idle keep-alive connections after this long, 0 = never")
+	flag.DurationVar(&config.ConfigData.SessionIdleTimeout, "session-idle-timeout", config.ConfigData.SessionIdleTimeout, "Expire prepared sessions without uploads after this long")
+	flag.StringVar(&config.ConfigData.DiscoveryMode, "discovery", config.ConfigData.DiscoveryMode, "Discovery mode (multicast|broadcast|both|avahi)")
+	flag.DurationVar(&config.ConfigData.DiscoveryInterval, "discovery-interval", config.ConfigData.DiscoveryInterval, "Maximum interval between discovery announcements")
+	flag.DurationVar(&config.ConfigData.DiscoveryJitter, "discovery-jitter", config.ConfigData.DiscoveryJitter, "Random delay added to each discovery announcement")
+	flag.BoolVar(&config.ConfigData.DiscoverUPnP, "discover-upnp", config.ConfigData.DiscoverUPnP, "Also search for devices with UPnP SSDP")
+	flag.BoolVar(&config.ConfigData.Quiet, "quiet", config.ConfigData.Quiet, "Suppress all output except errors")
+	flag.BoolVar(&config.ConfigData.JSON, "json", config.ConfigData.JSON, "Emit machine-readable JSON events on stdout")
+	flag.BoolVar(&config.ConfigData.NoProgress, "no-progress", config.ConfigData.NoProgress, "Log transfer speed as text instead of drawing progress bars")
+	flag.BoolVar(&config.ConfigData.Compress, "compress", config.ConfigData.Compress, "Compress uploads with zstd or gzip if the receiver supports it")
+	flag.BoolVar(&config.ConfigData.Zip, "zip", config.ConfigData.Zip, "Bundle a directory into a ZIP archive before sending")
+	flag.BoolVar(&config.ConfigData.FollowSymlinks, "follow-symlinks", config.ConfigData.FollowSymlinks, "Follow symlinks when sending (skipped by default)")
+	flag.BoolVar(&config.ConfigData.PreserveEmptyDirs, "preserve-empty-dirs", config.ConfigData.PreserveEmptyDirs, "Send empty directories so the receiver recreates them")
+	flag.BoolVar(&config.ConfigData.PreservePermissions, "preserve-permissions", config.ConfigData.PreservePermissions, "Apply the sender's file permissions; a sender can then make received files executable or world-readable")
+	flag.BoolVar(&trayMode, "tray", false, "Run as a system tray application (-tags tray)")
+	flag.StringVar(&config.ConfigData.FuseMount, "fuse-mount", config.ConfigData.FuseMount, "Expose received files in a FUSE filesystem at this mountpoint (Linux, -tags fuse)")
+	flag.BoolVar(&config.ConfigData.Unzip, "unzip", config.ConfigData.Unzip, "Extract received ZIP archives")
+	flag.BoolVar(&config.ConfigData.StrictClipboard, "strict-clipboard", config.ConfigData.StrictClipboard, "Fail transfers whose text can't be copied to the clipboard")
+	flag.BoolVar(&config.ConfigData.AutoOpen, "auto-open", config.ConfigData.AutoOpen, "Open received files with the default application")
+	flag.Func("auto-open-types", "Comma-separated MIME types to open with --auto-open, e.g. 'image/*,application/pdf'", func(s string) error {
+		config.ConfigData.AutoOpenTypes = strings.Split(s, ",")
+		return nil
+	})
+	flag.DurationVar(&config.ConfigData.SessionRetryDelay, "session-retry-delay", config.ConfigData.SessionRetryDelay, "Delay between upload retries when the receiver is busy, times out or answers 5xx")
+	flag.IntVar(&config.ConfigData.SessionRetryCount, "session-retry-count", config.ConfigData.SessionRetryCount, "Number of upload retries when the receiver is busy, times out or answers 5xx")
+	flag.DurationVar(&config.ConfigData.ProgressInterval, "progress-interval", config.ConfigData.ProgressInterval, "Log upload progress at this interval, 0 = off (default: 10s with --json)")
+	flag.BoolVar(&config.ConfigData.AutoTune, "auto-tune", config.ConfigData.AutoTune, "Measure bandwidth before large sends to tune buffers and ETA")
+	flag.StringVar(&config.ConfigData.Encrypt, "encrypt", config.ConfigData.Encrypt, "Encrypt sent files with this passphrase (AES-256-GCM), independent of TLS")
+	flag.StringVar(&config.ConfigData.Decrypt, "decrypt", config.ConfigData.Decrypt, "Decrypt received files encrypted with this passphrase")
+	flag.StringVar(&config.ConfigData.PIN, "pin", config.ConfigData.PIN, "Require senders to give this PIN")
+	flag.StringVar(&config.ConfigData.SendPIN, "send-pin", config.ConfigData.SendPIN, "PIN for receivers that require one (asked for when not set)")
+	flag.StringVar(&config.ConfigData.SendTo, "to", config.ConfigData.SendTo, "Alias or IP of the device to send to (skips the device picker)")
+	flag.StringVar(&config.ConfigData.SendAt, "at", config.ConfigData.SendAt, "Start the send at a time (HH:MM or RFC 3339)")
+	flag.StringVar(&config.ConfigData.SendIn, "in", config.ConfigData.SendIn, "Start the send after a delay, e.g. 30m or 2h30m")
+	flag.DurationVar(&config.ConfigData.RetryDuration, "retry-duration", config.ConfigData.RetryDuration, "How long to wait for the --to device to appear")
+	flag.DurationVar(&config.ConfigData.ReconnectTimeout, "reconnect-timeout", config.ConfigData.ReconnectTimeout, "How long to wait for a receiver that timed out to reappear, 0 = don't wait")
+	flag.StringVar(&config.ConfigData.ReportFormat, "report-format", config.ConfigData.ReportFormat, "Print an integrity report after sending (text|json)")
+	flag.StringVar(&config.ConfigData.ReportFile, "report-file", config.ConfigData.ReportFile, "Write the integrity report to a file")
+	flag.Func("exclude", "Don't send files matching this glob, e.g. '*.tmp' or '**/.git/**' (repeatable)", func(s string) error {
+		return addSendFilter(s, false)
+	})
+	flag.Func("include", "Send files matching this glob even if excluded earlier (repeatable)", func(s string) error {
+		return addSendFilter(s, true)
+	})
+	flag.StringVar(&config.ConfigData.ExcludeHashes, "exclude-hashes", config.ConfigData.ExcludeHashes, "Skip sending files whose SHA256 is listed in this file")
+	flag.StringVar(&config.ConfigData.OrganizeBy, "organize-by", config.ConfigData.OrganizeBy, "Receive into subdirectories by sender, date or type")
+	flag.StringVar(&config.ConfigData.ReceiveMode, "receive-mode", config.ConfigData.ReceiveMode, "overwrite or append to existing files")
+	flag.StringVar(&config.ConfigData.VerifyManifest, "verify-manifest", config.ConfigData.VerifyManifest, "Check received sessions against this sha256sum manifest")
+	flag.Var(stringList{&config.ConfigData.WebhookURLs}, "webhook-url", "POST a JSON notification to this URL after each received file (repeatable)")
+	flag.BoolVar(&config.ConfigData.NoHistory, "no-history", config.ConfigData.NoHistory, "Don't record transfers in the history file")
+	flag.StringVar(&sendURL, "url", "", "Download this URL and send it instead of a local file")
+	flag.StringVar(&sendName, "name", "", "File name for --url (default: from the URL path)")
+	flag.BoolVar(&retryAttemptNow, "attempt-now", false, "With retry-queue: send the queued files again")
+	flag.DurationVar(&config.ConfigData.RetryExpiry, "retry-expiry", config.ConfigData.RetryExpiry, "How long failed uploads stay in the retry queue")
+	flag.IntVar(&historyLast, "last", 0, "Show only the last N history records")
+	flag.StringVar(&historySince, "since", "", "Show history records since a date (YYYY-MM-DD or RFC 3339)")
+	flag.StringVar(&historyPeer, "peer", "", "Show history records for a peer alias")
 }
 
 func main() {
@@ -424,30 +1426,100 @@ func main() {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-signalChan
-		fmt.Println("\nReceived interrupt signal, exiting...")
-		os.Exit(0)
+		cancelling := false
+		for range signalChan {
+			// The first interrupt cancels a running send, the next one exits
+			if !cancelling && handlers.CancelSends() > 0 {
+				cancelling = true
+				logger.Info("Cancelling transfer...")
+				continue
+			}
+			logger.Info("Received interrupt signal, exiting...")
+			cleanup()
+			os.Exit(0)
+		}
 	}()
 	logger.InitLogger()
+	parseFlags()
+	watchReload()
+	handlers.WatchPauseSignals()
+	cliphandlers.RegisterDefaults()
 
 	// Start HTTP server
 	httpServer := server.New()
 
 	/* Send and receive section */
 	if config.ConfigData.Functions.LocalSendServer {
-		httpServer.HandleFunc("/api/localsend/v2/prepare-upload", handlers.PrepareReceive)
-		httpServer.HandleFunc("/api/localsend/v2/upload", handlers.ReceiveHandler)
-		httpServer.HandleFunc("/api/localsend/v2/info", handlers.GetInfoHandler)
-		httpServer.HandleFunc("/api/localsend/v2/cancel", handlers.HandleCancel)
+		handlers.RegisterAPI(httpServer)
+	}
+	httpServer.HandleFunc("/api/admin/log-level", handlers.LogLevelHandler)
+	httpServer.HandleFunc("/api/admin/pause-transfers", handlers.PauseTransfersHandler)
+	httpServer.HandleFunc("/api/admin/resume-transfers", handlers.ResumeTransfersHandler)
+	if config.ConfigData.Functions.LocalSendServer {
+		// Partial files left by a previous run that was killed or crashed
+		if _, err := handlers.RemoveStaleTempFiles(receiveDirs()...); err != nil {
+			logger.Warnf("Failed to remove stale temp files: %v", err)
+		}
+		// Trusted fingerprints are accepted without auto-accept, untrusted ones are always rejected
+		if _, err := trust.Watch(config.ConfigDir()); err != nil {
+			logger.Warnf("Not watching fingerprint lists: %v", err)
+		}
+	}
+	ln, err := server.Listen(config.ConfigData.Port, config.ConfigData.AutoPort)
+	if err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+	if boundPort := server.Port(ln); boundPort != config.ConfigData.Port {
+		logger.Infof("Bound to port %d (%d was in use)", boundPort, config.ConfigData.Port)
+		config.ConfigData.Port = boundPort
+	}
+	shared.Message.Port = config.ConfigData.Port
+	if config.ConfigData.Transport == transport.QUIC {
+		if transport.QUICPort() == discovery.DiscoveryPort {
+			log.Fatalf("QUIC port %d is the discovery port, use --quic-port", discovery.DiscoveryPort)
+		}
+		shared.Message.QUICPort = transport.QUICPort()
+		// The announced fingerprint is the one of the HTTP/3 certificate, so peers can
+		// verify it like the certificate of an https peer
+		cert, err := certificate.LoadOrCreate(config.CertificateFile(), config.ConfigData.NameOfDevice)
+		if err != nil {
+			log.Fatalf("QUIC certificate failed: %v", err)
+		}
+		quicCert = cert
+		shared.Message.Fingerprint = certificate.Fingerprint(cert.Certificate[0])
+	}
+	shared.Message.Addresses = discovery.LocalAddresses()
+	shared.BuildMessage()
+	if config.ConfigData.UPnP {
+		mapPort()
+		defer upnp.Release()
+	}
+	if config.ConfigData.Relay != "" && config.ConfigData.Functions.LocalSendServer {
+		go serveRelay(httpServer)
 	}
 	go func() {
-		logger.Info("Server started at :" + fmt.Sprintf("%d", port))
-		if err := http.ListenAndServe(":"+fmt.Sprintf("%d", port), httpServer); err != nil {
+		logger.Info("Server started at :" + fmt.Sprintf("%d", config.ConfigData.Port))
+		if err := newHTTPServer(httpServer).Serve(ln); err != nil {
 			log.Fatalf("Server failed: %v", err)
 		}
 	}()
+	if config.ConfigData.Transport == transport.QUIC {
+		if err := transport.Supported(); err != nil {
+			log.Fatalf("QUIC transport unavailable: %v", err)
+		}
+		go func() {
+			logger.Infof("HTTP/3 (QUIC) server started at udp :%d", transport.QUICPort())
+			if err := transport.ServeQUIC(fmt.Sprintf(":%d", transport.QUICPort()), localOnly(httpServer), quicCert); err != nil {
+				log.Fatalf("QUIC server failed: %v", err)
+			}
+		}()
+	}
+	if trayMode {
+		TrayMode()
+		return
+	}
 	// Argument parsing
-	flagParse(httpServer, port, &flagOpen)
+	flagParse(httpServer, config.ConfigData.Port, &flagOpen)
 
 	if !flagOpen {
 		// Run Bubble Tea program
@@ -467,7 +1539,7 @@ func main() {
 		if mode == "📤 Send" {
 			filePath := mTyped.textInput.Value()
 			if filePath == "" {
-				fmt.Println("Send mode requires a file path")
+				logger.Error("Send mode requires a file path")
 				os.Exit(1)
 			}
 			SendMode(filePath)
@@ -477,7 +1549,7 @@ func main() {
 			ReceiveMode()
 		}
 		if mode == "🌎 Web" {
-			WebServerMode(httpServer, port)
+			WebServerMode(httpServer, config.ConfigData.Port)
 		}
 	}
 }